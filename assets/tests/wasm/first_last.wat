@@ -0,0 +1,37 @@
+;; Splits the "name" key of the current scope into "first_name" and "last_name" using the json-dom host ABI.
+;; Assemble with: wat2wasm first_last.wat -o first_last.wasm
+(module
+  (import "json_dom" "scope_get" (func $scope_get (param i32 i32) (result i32)))
+  (import "json_dom" "scope_set" (func $scope_set (param i32 i32)))
+  (import "json_dom" "path_get" (func $path_get (param i32 i32 i32 i32) (result i32)))
+  (import "json_dom" "path_set" (func $path_set (param i32 i32 i32 i32)))
+  (import "json_dom" "console_log" (func $console_log (param i32 i32)))
+  (memory (export "memory") 1)
+  (data (i32.const 0) "$.name")
+  (data (i32.const 16) "$.first_name")
+  (data (i32.const 32) "$.last_name")
+  (data (i32.const 48) "null")
+  (func (export "run")
+    (local $n i32) (local $s i32)
+    ;; Read the scope and write it straight back
+    (local.set $n (call $scope_get (i32.const 4096) (i32.const 4096)))
+    (call $scope_set (i32.const 4096) (local.get $n))
+    ;; Read ["John Smith"] into memory at 1024 and log it
+    (local.set $n (call $path_get (i32.const 0) (i32.const 6) (i32.const 1024) (i32.const 1024)))
+    (call $console_log (i32.const 1024) (local.get $n))
+    ;; Find the index of the space
+    (local.set $s (i32.const 2))
+    (block $found
+      (loop $next
+        (br_if $found (i32.eq (i32.load8_u (i32.add (local.get $s) (i32.const 1024))) (i32.const 32)))
+        (local.set $s (i32.add (local.get $s) (i32.const 1)))
+        (br_if $next (i32.lt_u (local.get $s) (local.get $n))))
+      unreachable)
+    ;; Replace the space with a quote so that ["John"Smith"] contains both "John" and "Smith"
+    (i32.store8 (i32.add (local.get $s) (i32.const 1024)) (i32.const 34))
+    (call $path_set (i32.const 16) (i32.const 12) (i32.const 1025) (local.get $s))
+    (call $path_set (i32.const 32) (i32.const 11)
+      (i32.add (local.get $s) (i32.const 1024))
+      (i32.sub (i32.sub (local.get $n) (i32.const 1)) (local.get $s)))
+    ;; Setting a value to null deletes it
+    (call $path_set (i32.const 0) (i32.const 6) (i32.const 48) (i32.const 4))))
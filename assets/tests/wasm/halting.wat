@@ -0,0 +1,6 @@
+;; Loops forever so that the module is interrupted after globals.HaltingDelay.
+;; Assemble with: wat2wasm halting.wat -o halting.wasm
+(module
+  (func (export "run")
+    (loop $forever
+      (br $forever))))
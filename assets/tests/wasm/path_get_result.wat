@@ -0,0 +1,12 @@
+;; An expression script (#//!wasm=) which evaluates to the values pointed to by "$.a" using the json-dom host ABI.
+;; Assemble with: wat2wasm path_get_result.wat -o path_get_result.wasm
+(module
+  (import "json_dom" "path_get" (func $path_get (param i32 i32 i32 i32) (result i32)))
+  (import "json_dom" "result_set" (func $result_set (param i32 i32)))
+  (memory (export "memory") 1)
+  (data (i32.const 0) "$.a")
+  (func (export "run")
+    (local $n i32)
+    ;; Read [40] into memory at 1024 and set it as the result
+    (local.set $n (call $path_get (i32.const 0) (i32.const 3) (i32.const 1024) (i32.const 1024)))
+    (call $result_set (i32.const 1024) (local.get $n))))
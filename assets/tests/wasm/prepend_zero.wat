@@ -0,0 +1,14 @@
+;; Prepends 0 to the current scope, which must be an array root, using the json-dom host ABI.
+;; Assemble with: wat2wasm prepend_zero.wat -o prepend_zero.wasm
+(module
+  (import "json_dom" "scope_get" (func $scope_get (param i32 i32) (result i32)))
+  (import "json_dom" "scope_set" (func $scope_set (param i32 i32)))
+  (memory (export "memory") 1)
+  (data (i32.const 4094) "[0")
+  (func (export "run")
+    (local $n i32)
+    ;; Read the array (e.g. [1,2]) into memory at 4096, straight after "[0"
+    (local.set $n (call $scope_get (i32.const 4096) (i32.const 4096)))
+    ;; Replace the opening bracket with a comma so that memory at 4094 contains [0,1,2]
+    (i32.store8 (i32.const 4096) (i32.const 44))
+    (call $scope_set (i32.const 4094) (i32.add (local.get $n) (i32.const 2)))))
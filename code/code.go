@@ -10,10 +10,14 @@
 package code
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/andygello555/json-dom/jom/json_map"
 	"github.com/andygello555/json-dom/globals"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type ScriptLangType int
@@ -24,14 +28,132 @@ type ScriptLangType int
 const (
 	JS ScriptLangType = iota
 	GO ScriptLangType = iota
+	LUA ScriptLangType = iota
+	STAR ScriptLangType = iota
+	ES ScriptLangType = iota
+	WASM ScriptLangType = iota
+	JQ ScriptLangType = iota
+	GOSRC ScriptLangType = iota
+	TMPL ScriptLangType = iota
 )
 
+type ScriptMode int
+
+// Script modes which determine what happens to the script's key once it has been run.
+const (
+	// The script is run as a series of statements which modify the JOM. The script's key is deleted once run.
+	Statement ScriptMode = iota
+	// The script is evaluated as an expression and the resulting value is assigned to the script's key. Marked by
+	// suffixing the shebang with globals.ExpressionModeSuffix (e.g. "#//!js=").
+	Expression ScriptMode = iota
+)
+
+type Phase int
+
+// Phases which determine whether a script is run before or after the subtrees (nested objects and objects within arrays)
+// of its scope are evaluated.
+const (
+	// The script's phase is taken from RunOptions.Phase. This is the zero value of the "phase" attribute.
+	DefaultPhase Phase = iota
+	// The script is run before the subtrees of its scope are evaluated (pre-order). This is the default.
+	Pre Phase = iota
+	// The script is run after the subtrees of its scope have been evaluated (post-order), so it can see the results of
+	// the scripts within its subtrees.
+	Post Phase = iota
+)
+
+// The attributes which can be given after the script language within a shebang line. Each attribute is a key-value pair
+// separated by globals.AttributeDelim and attributes are separated by whitespace (e.g. "#//!js timeout=10s").
+type Attributes struct {
+	// The "timeout" attribute. The maximum amount of time the script can run for, which is capped by
+	// RunOptions.MaxScriptTimeout. Zero if not given.
+	Timeout     time.Duration
+	// The "after" attribute. The keys of the scripts on the same level which must be run before this script, separated
+	// by globals.AttributeListDelim (e.g. "after=normalise,validate"). See Order.
+	After       []string
+	// The "priority" attribute. Scripts on the same level with a higher priority are run first, as long as the scripts
+	// they must run after have been run. Zero if not given. See Order.
+	Priority    int
+	// The "phase" attribute. Either "pre" or "post". DefaultPhase if not given. See RunOptions.PhaseFor.
+	Phase       Phase
+	// Whether "root" is within the "write" attribute, separated by globals.AttributeListDelim (e.g. "write=root,parent").
+	// If so, any changes the script makes to the root of the document (json.root) are written back to the document.
+	// Only used by languages which expose the root and parent of a script's scope.
+	WriteRoot   bool
+	// Whether "parent" is within the "write" attribute. If so, any changes the script makes to the scope enclosing its
+	// scope (json.parent) are written back to the document.
+	WriteParent bool
+}
+
+// Parses the given whitespace separated attributes. Returns an error if an attribute is not a key-value pair, is not
+// recognised, or has an invalid value.
+func ParseAttributes(attributes string) (parsed Attributes, err error) {
+	for _, attribute := range strings.Fields(attributes) {
+		keyValue := strings.SplitN(attribute, globals.AttributeDelim, 2)
+		if len(keyValue) != 2 {
+			return parsed, errors.New(fmt.Sprintf("\"%s\" is not a key-value pair", attribute))
+		}
+		key, value := keyValue[0], keyValue[1]
+		switch key {
+		case "timeout":
+			if parsed.Timeout, err = time.ParseDuration(value); err != nil {
+				return parsed, err
+			}
+			if parsed.Timeout <= 0 {
+				return parsed, errors.New(fmt.Sprintf("timeout must be positive not %s", value))
+			}
+		case "after":
+			parsed.After = strings.Split(value, globals.AttributeListDelim)
+			for _, after := range parsed.After {
+				if after == "" {
+					return parsed, errors.New(fmt.Sprintf("after must be a list of keys separated by \"%s\" not \"%s\"", globals.AttributeListDelim, value))
+				}
+			}
+		case "priority":
+			if parsed.Priority, err = strconv.Atoi(value); err != nil {
+				return parsed, err
+			}
+		case "write":
+			for _, scope := range strings.Split(value, globals.AttributeListDelim) {
+				switch scope {
+				case "root":
+					parsed.WriteRoot = true
+				case "parent":
+					parsed.WriteParent = true
+				default:
+					return parsed, errors.New(fmt.Sprintf("write must be a list of \"root\" and/or \"parent\" not \"%s\"", value))
+				}
+			}
+		case "phase":
+			switch value {
+			case "pre":
+				parsed.Phase = Pre
+			case "post":
+				parsed.Phase = Post
+			default:
+				return parsed, errors.New(fmt.Sprintf("phase must be either \"pre\" or \"post\" not \"%s\"", value))
+			}
+		default:
+			return parsed, errors.New(fmt.Sprintf("\"%s\" is not a recognised attribute", key))
+		}
+	}
+	return parsed, nil
+}
+
 // Wrapper for any "runnable" script/callback.
 type Code struct {
 	// The script/callback which can be run in either a VM of the language's type/in Go if it is a callback.
 	Script 	   interface{}
 	// The script's language which determines what it will be run inside.
 	ScriptLang ScriptLangType
+	// The key of the script within its scope. Set when the script is found by json_map.JsonMapInt.FindScriptFields.
+	Key        string
+	// Whether the script is run as statements or evaluated as an expression.
+	Mode       ScriptMode
+	// The attributes given within the script's shebang line.
+	Attributes Attributes
+	// The options the script is being run with. Set by RunWithOptions.
+	options    RunOptions
 }
 
 // Uses globals.ScriptErrorFormatString to return a string with both the script and the script language.
@@ -39,11 +161,34 @@ func (code *Code) String() string {
 	return fmt.Sprintf(globals.ScriptErrorFormatString, code.ScriptLangShebang(), fmt.Sprintf("%v", code.Script))
 }
 
+// The maximum amount of time the Code can run for before a globals.HaltingProblem error is returned. This is resolved
+// from the RunOptions the Code is run with, and defaults to globals.HaltingDelay.
+func (code *Code) Timeout() time.Duration {
+	return code.options.ScriptTimeoutFor(*code)
+}
+
+// The RunOptions the Code is being run with.
+func (code *Code) Options() RunOptions {
+	return code.options
+}
+
+// Whether the Code is in Expression mode.
+func (code *Code) IsExpression() bool {
+	return code.Mode == Expression
+}
+
 // Gets all the shebang suffixes for the given ScriptLangType.
 func (code *Code) ScriptLangShebang() string {
 	return map[ScriptLangType]string{
 		JS: "js",
 		GO: "go",
+		LUA: "lua",
+		STAR: "star",
+		ES: "es",
+		WASM: "wasm",
+		JQ: "jq",
+		GOSRC: "gosrc",
+		TMPL: "tmpl",
 	}[code.ScriptLang]
 }
 
@@ -52,27 +197,52 @@ func ShebangScriptLang(shebang string) ScriptLangType {
 	return map[string]ScriptLangType{
 		"js": JS,
 		"go": GO,
+		"lua": LUA,
+		"star": STAR,
+		"es": ES,
+		"wasm": WASM,
+		"jq": JQ,
+		"gosrc": GOSRC,
+		"tmpl": TMPL,
 	}[shebang]
 }
 
-// Creates a new Code object from the given string source code (must include shebang) or a func(json json_map.JsonMapInt).
+// Creates a new Code object from the given string source code (must include shebang) or a Go callback with one of the
+// following signatures:
+//  func(ctx context.Context, json json_map.JsonMapInt) error
+//  func(ctx context.Context, json json_map.JsonMapInt) (interface{}, error)
+//  func(json json_map.JsonMapInt)
+//  func(json json_map.JsonMapInt) interface{}
 // If the given value is not one of these an empty Code object will be returned and ok will be false.
 // If the given value is a string the following will happen:
 //
 // • Checking the first line of the string and seeing if it starts with the ShebangPrefix and ends with one of the supported languages.
 //
+// • If the shebang ends with globals.ExpressionModeSuffix then the Code will be in Expression mode.
+//
 // • Panics if the shebang fits the required length for a shebang but is not a supported script language.
 //
+// • Any Attributes following the shebang are parsed. Panics if they are invalid.
+//
 // • ok is true if the script does contain a json-dom script, false otherwise.
 //
-// If the given value is a func(json json_map.JsonMapInt) then there will be no checks as a function callback will be
-// run rather than a script in a virtual environment.
+// If the given value is a callback then there will be no checks as a function callback will be run rather than a script
+// in a virtual environment. Callbacks which return an interface{} will be run in Expression mode.
 func NewFrom(from interface{}) (code Code, ok bool) {
 	ok = false
 	switch from.(type) {
 	case string:
 		script := from.(string)
 		firstLine := strings.Split(script, "\n")[0]
+		// Attributes are separated from the shebang by whitespace
+		attributes := ""
+		if i := strings.IndexAny(firstLine, " \t"); i >= 0 {
+			firstLine, attributes = firstLine[:i], firstLine[i + 1:]
+		}
+		if strings.HasSuffix(firstLine, globals.ExpressionModeSuffix) {
+			firstLine = strings.TrimSuffix(firstLine, globals.ExpressionModeSuffix)
+			code.Mode = Expression
+		}
 		firstLen := len(firstLine)
 
 		// First check the bounds of the line so that we won't panic
@@ -92,12 +262,30 @@ func NewFrom(from interface{}) (code Code, ok bool) {
 				panic(globals.UnsupportedScriptLang.FillError(shebangScriptLang, fmt.Sprintf(globals.ScriptErrorFormatString, globals.AnonymousScriptPath, script)))
 			}
 			code.ScriptLang = ShebangScriptLang(shebangScriptLang)
+			var err error
+			if code.Attributes, err = ParseAttributes(attributes); err != nil {
+				panic(globals.InvalidAttribute.FillError(err.Error(), fmt.Sprintf(globals.ScriptErrorFormatString, globals.AnonymousScriptPath, script)))
+			}
 			ok = true
 		}
 	case func(json json_map.JsonMapInt):
 		code.Script = from.(func(json json_map.JsonMapInt))
 		code.ScriptLang = GO
 		ok = true
+	case func(json json_map.JsonMapInt) interface{}:
+		code.Script = from.(func(json json_map.JsonMapInt) interface{})
+		code.ScriptLang = GO
+		code.Mode = Expression
+		ok = true
+	case func(ctx context.Context, json json_map.JsonMapInt) error:
+		code.Script = from.(func(ctx context.Context, json json_map.JsonMapInt) error)
+		code.ScriptLang = GO
+		ok = true
+	case func(ctx context.Context, json json_map.JsonMapInt) (interface{}, error):
+		code.Script = from.(func(ctx context.Context, json json_map.JsonMapInt) (interface{}, error))
+		code.ScriptLang = GO
+		code.Mode = Expression
+		ok = true
 	}
 	return code, ok
 }
\ No newline at end of file
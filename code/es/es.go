@@ -0,0 +1,464 @@
+// Contains runner and getter/setter functions for the execution of ES2015+ JS scripts within a goja.Runtime.
+//
+// This is an alternative to the js package for scripts that need modern JS features (let/const, arrow functions,
+// template literals, typed arrays, etc.). The same builtins are exposed as in the js package.
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/andygello555/json-dom/code"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"github.com/dop251/goja"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Register this language in the code package.
+func init() {
+	code.RegisterLang("es", RunScript)
+	code.RegisterFilterLang("es", RunFilter)
+}
+
+// These can be set when testing to check output.
+var (
+	ExternalConsoleLogStdout io.Writer = os.Stdout
+	ExternalConsoleLogStderr io.Writer = os.Stderr
+)
+
+// Marshals the given value into JSON and parses it within the given runtime using JSON.parse.
+//
+// This makes sure that maps and slices are converted into native JS objects and arrays rather than wrapped Go values.
+func parse(vm *goja.Runtime, value interface{}) (goja.Value, error) {
+	literal, err := json.Marshal(value)
+	if err != nil {
+		return goja.Null(), err
+	}
+	jsonParse, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+	return jsonParse(goja.Undefined(), vm.ToValue(string(literal)))
+}
+
+// Stringifies the given value within the given runtime using JSON.stringify and unmarshals it into the given pointer.
+func stringify(vm *goja.Runtime, value goja.Value, out interface{}) error {
+	stringified, err := stringifyString(vm, value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(stringified), out)
+}
+
+// Stringifies the given value within the given runtime using JSON.stringify.
+func stringifyString(vm *goja.Runtime, value goja.Value) (string, error) {
+	jsonStringify, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("stringify"))
+	stringified, err := jsonStringify(goja.Undefined(), value)
+	if err != nil {
+		return "", err
+	}
+	if goja.IsUndefined(stringified) || goja.IsNull(stringified) {
+		return "", errors.New(fmt.Sprintf("\"%v\" is not JSON stringifiable", value))
+	}
+	return stringified.String(), nil
+}
+
+// Composes a string to print from the given goja.FunctionCall.
+func composePrint(vm *goja.Runtime, call goja.FunctionCall) *strings.Builder {
+	// Print the caller location
+	var out strings.Builder
+	var callLocation string
+
+	if jom := vm.Get(globals.JOMVariableName); jom == nil || goja.IsUndefined(jom) || goja.IsNull(jom) {
+		callLocation = "json.scopePath not found"
+	} else {
+		// Check if json.scopePath is not a string (it has been overridden by user)
+		scopePath, ok := jom.ToObject(vm).Get("scopePath").Export().(string)
+		if !ok {
+			panic(vm.NewGoError(globals.OverriddenBuiltin.FillError("json.scopePath")))
+		}
+		callLocation = fmt.Sprintf("<%s>", scopePath)
+	}
+
+	// Find the first frame on the call stack that is within the script
+	caller := globals.AnonymousScriptPath
+	for _, frame := range vm.CaptureCallStack(0, nil) {
+		if frame.SrcName() == globals.AnonymousScriptPath {
+			caller = frame.Position().String()
+			break
+		}
+	}
+	_, _ = fmt.Fprintln(&out, "call from:", strings.Replace(caller, globals.AnonymousScriptPath, callLocation, -1))
+
+	var b strings.Builder
+	for i, arg := range call.Arguments {
+		if goja.IsUndefined(arg) {
+			_, _ = fmt.Fprint(&b, "undefined")
+		} else {
+			_, _ = fmt.Fprintf(&b, "%v", arg.Export())
+		}
+
+		// Add space between args
+		if i < len(call.Arguments) - 1 {
+			_, _ = fmt.Fprint(&b, " ")
+		}
+	}
+
+	// Tabulate all lines that are being output and write them to out
+	for _, line := range strings.Split(b.String(), "\n") {
+		_, _ = fmt.Fprintf(&out, "\t%s\n", line)
+	}
+	return &out
+}
+
+// Given a JSON path will return a "NodeSet" object which contains the absolute paths to all values denoted by the JSON
+// path as well as getter and setter functions.
+//
+// • The JSON path will be parsed into json_map.AbsolutePaths.
+//
+// • json_map.AbsolutePaths will be converted into JS values.
+//
+// • The returned object will be constructed (_absolutePaths, getValues, setValues).
+func jsonPathSelector(vm *goja.Runtime, scope json_map.JsonMapInt) func(call goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		throw := func(message string) {
+			err := vm.NewGoError(errors.New(message))
+			_ = err.Set("name", "JSONPathError")
+			panic(err)
+		}
+
+		// Check number of arguments and argument types
+		if len(call.Arguments) != 1 {
+			throw("jsonPathSelector takes a single string argument")
+		}
+		jsonPath, ok := call.Argument(0).Export().(string)
+		if !ok {
+			throw("jsonPathSelector takes a single string argument")
+		}
+
+		// We set up a function to retrieve the JsonMap so we can retrieve the most up to date version of json.trail
+		getJsonMap := func() json_map.JsonMapInt {
+			jMap := scope.Clone(true)
+			trail := vm.Get(globals.JOMVariableName).ToObject(vm).Get("trail")
+			if err := stringify(vm, trail, jMap.GetInsides()); err != nil {
+				throw(fmt.Sprintf("\"%s.trail\" cannot be converted to a JsonMap: %v", globals.JOMVariableName, err))
+			}
+			return jMap
+		}
+
+		// Then we will compile the JSON path, which is cached, and take a copy of its absolute paths
+		compiled, err := json_map.Compile(jsonPath)
+		if err != nil {
+			throw(err.Error())
+		}
+		absolutePaths := compiled.AbsolutePaths()
+
+		var setupKeyObject func(path json_map.AbsolutePathKey) map[string]interface{}
+		setupKeyObject = func(path json_map.AbsolutePathKey) map[string]interface{} {
+			absolutePathKeyMap := make(map[string]interface{})
+			absolutePathKeyMap["typeId"]   = path.KeyType
+			absolutePathKeyMap["typeName"] = json_map.AbsolutePathKeyTypeNames[path.KeyType]
+			switch path.KeyType {
+			case json_map.Slice:
+				// In cases of slices we have to setup a new array
+				sliceArray := make([]interface{}, 0)
+				for _, slice := range path.Value.([]json_map.AbsolutePathKey) {
+					sliceArray = append(sliceArray, setupKeyObject(slice))
+				}
+				absolutePathKeyMap["key"] = sliceArray
+			default:
+				absolutePathKeyMap["key"] = path.Value
+			}
+			return absolutePathKeyMap
+		}
+
+		absoluteValues := make([]interface{}, 0)
+		for _, paths := range absolutePaths {
+			currentPath := make([]interface{}, 0)
+			for _, path := range paths {
+				currentPath = append(currentPath, setupKeyObject(path))
+			}
+			absoluteValues = append(absoluteValues, currentPath)
+		}
+
+		// Create a node set object which will store the object we need to return
+		nodeSet := vm.NewObject()
+		absoluteValuesValue, err := parse(vm, absoluteValues)
+		if err != nil {
+			throw(err.Error())
+		}
+		_ = nodeSet.Set("_absolutePaths", absoluteValuesValue)
+
+		// Set getter and setter funcs
+		_ = nodeSet.Set("getValues", func(call goja.FunctionCall) goja.Value {
+			// Get the most "up to date" json map from json.trail
+			nodes, errs := getJsonMap().GetAbsolutePaths(&absolutePaths)
+			if errs != nil {
+				throw(globals.JsonPathError.FillFromErrors(errs).Error())
+			}
+
+			// Expand the first element if we only have one element and its an array
+			if len(nodes) == 1 {
+				switch nodes[0].Value.(type) {
+				case []interface{}:
+					expandedNodes := make([]*json_map.JsonPathNode, 0)
+					for _, node := range nodes[0].Value.([]interface{}) {
+						expandedNodes = append(expandedNodes, &json_map.JsonPathNode{
+							Absolute: nodes[0].Absolute,
+							Value:    node,
+						})
+					}
+					nodes = expandedNodes
+				}
+			}
+
+			nodeValues := make([]interface{}, len(nodes))
+			for i, value := range nodes {
+				nodeValues[i] = value.Value
+			}
+			nodeValuesValue, err := parse(vm, nodeValues)
+			if err != nil {
+				throw(err.Error())
+			}
+			return nodeValuesValue
+		})
+
+		_ = nodeSet.Set("setValues", func(call goja.FunctionCall) goja.Value {
+			if len(call.Arguments) != 1 {
+				throw("setValues takes a single argument")
+			}
+			// Get the most "up to date" json map from json.trail
+			jsonMap := getJsonMap()
+
+			// Convert the value to Go by stringifying it so that it only contains JSON types
+			var value interface{}
+			if !goja.IsNull(call.Argument(0)) {
+				if err := stringify(vm, call.Argument(0), &value); err != nil {
+					throw(err.Error())
+				}
+			}
+
+			// Then we call SetAbsolutePaths
+			// NOTE: Same as in the js package, the absolute paths might be out of date if the user has changed the
+			//       structure of json.trail since creating the NodeSet
+			if err := jsonMap.SetAbsolutePaths(&absolutePaths, value); err != nil {
+				throw(err.Error())
+			}
+
+			// Then we update the current json.trail object with the modified JsonMap
+			trail, err := createJom(vm, jsonMap)
+			if err != nil {
+				throw("Could not JOM-ify modified JsonMap")
+			}
+			_ = vm.Get(globals.JOMVariableName).ToObject(vm).Set("trail", trail)
+			return goja.Null()
+		})
+		return nodeSet
+	}
+}
+
+// Construct a list of all the builtin functions to register when creating the environment.
+var builtinFuncs = []struct{
+	name     string
+	function func(vm *goja.Runtime) func(call goja.FunctionCall) goja.Value
+}{
+	// printlnExternal is a legacy version of the console.log
+	{"printlnExternal", func(vm *goja.Runtime) func(call goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			_, _ = fmt.Fprintf(ExternalConsoleLogStdout, "Print %s", composePrint(vm, call))
+			return goja.Null()
+		}
+	}},
+}
+
+var builtinVars = []struct{
+	name   string
+	getter func(vm *goja.Runtime, jsonMap json_map.JsonMapInt) goja.Value
+}{
+	// Construct the main JOM object
+	{globals.JOMVariableName, func(vm *goja.Runtime, jsonMap json_map.JsonMapInt) goja.Value {
+		trail, err := createJom(vm, jsonMap)
+		if err != nil {
+			panic(globals.BuiltinGetterError.FillError("json.trail", "Could not JOM-ify", err.Error()))
+		}
+		vars, err := parse(vm, jsonMap.Vars())
+		if err != nil {
+			panic(globals.BuiltinGetterError.FillError("json.vars", "Could not JOM-ify", err.Error()))
+		}
+		jom := vm.NewObject()
+		_ = jom.Set("trail", trail)
+		_ = jom.Set("vars", vars)
+		_ = jom.Set("jsonPathSelector", jsonPathSelector(vm, jsonMap))
+		_ = jom.Set("scopePath", jsonMap.GetCurrentScopePath())
+		return jom
+	}},
+	{"console", func(vm *goja.Runtime, jsonMap json_map.JsonMapInt) goja.Value {
+		// Sets up the console object
+		console := vm.NewObject()
+		_ = console.Set("log", func(call goja.FunctionCall) goja.Value {
+			_, _ = fmt.Fprintf(ExternalConsoleLogStdout, "Print %s", composePrint(vm, call))
+			return goja.Null()
+		})
+		_ = console.Set("error", func(call goja.FunctionCall) goja.Value {
+			// Redirect to stderr
+			_, _ = fmt.Fprintf(ExternalConsoleLogStderr, "Error %s", composePrint(vm, call))
+			return goja.Null()
+		})
+		return console
+	}},
+}
+
+// Create the JOM within the given runtime.
+//
+// Unlike the js package, the JOM is parsed within the same runtime that the script is run in.
+func createJom(vm *goja.Runtime, jsonMap json_map.JsonMapInt) (goja.Value, error) {
+	return parse(vm, jsonMap.GetInsides())
+}
+
+// Given a JS environment, retrieve the JOM and generate the json_map.JsonMapInt for the object.
+//
+// Returns the json_map.JsonMapInt of the converted JOM and any errors (if there are any).
+func deJomIfy(code code.Code, jsonMap json_map.JsonMapInt, vm *goja.Runtime) (data json_map.JsonMapInt, err error) {
+	data = jsonMap.Clone(true)
+
+	// NOTE JSON.stringify will strip keys that are functions out from the object
+	jom := vm.Get(globals.JOMVariableName)
+	if jom == nil || goja.IsUndefined(jom) || goja.IsNull(jom) {
+		return nil, globals.OverriddenBuiltin.FillError(globals.JOMVariableName)
+	}
+	trail, err := stringifyString(vm, jom.ToObject(vm).Get("trail"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the size of the JSON string against the budget before it is unmarshalled
+	if err = code.CheckScopeBytes(jsonMap, len(trail)); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(trail), data.GetInsides()); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Runs the given program within the given runtime. If the program doesn't finish within the given timeout then the
+// runtime will be interrupted and a HaltingProblem error will be returned. If the given context is done before the
+// program finishes then the runtime will be interrupted and a Cancelled error will be returned.
+func runWithHalting(ctx context.Context, timeout time.Duration, vm *goja.Runtime, program *goja.Program, scriptErrorInfo string) (value goja.Value, halted bool, err error) {
+	// To stop infinite loops start a timer which will interrupt the runtime once the timer stops
+	start := time.Now()
+	timer := time.AfterFunc(timeout, func() {
+		vm.Interrupt(globals.HaltingProblem)
+	})
+	defer timer.Stop()
+	stop := context.AfterFunc(ctx, func() {
+		vm.Interrupt(globals.Cancelled)
+	})
+	defer stop()
+
+	value, err = vm.RunProgram(program)
+	// If the runtime was interrupted by the timer/context then package it up using FillError/WrapError
+	if interrupted, ok := err.(*goja.InterruptedError); ok {
+		switch interrupted.Value() {
+		case globals.HaltingProblem:
+			return nil, true, globals.HaltingProblem.FillError(time.Since(start).String(), scriptErrorInfo)
+		case globals.Cancelled:
+			return nil, true, globals.Cancelled.WrapError(ctx.Err(), time.Since(start).String(), scriptErrorInfo)
+		}
+	}
+	return value, false, err
+}
+
+// Run the given script, with the given json_map.JsonMapInt and return the new json_map.JsonMapInt for the scope.
+//
+// Order of execution
+//
+// • The runtime is created.
+//
+// • The JOM is created within the runtime.
+//
+// • The builtins and the JOM is passed into the environment.
+//
+// • Interrupt for the halting problem and for the cancellation of the given context is setup.
+//
+// • The script is run.
+//
+// • The environment is De-JOM-ified.
+//
+// • If the script is an expression then the value it evaluated to is assigned to the script's key.
+//
+// • The new json_map.JsonMapInt is returned.
+func RunScript(ctx context.Context, code code.Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error) {
+	script := code.Script.(string)
+	scriptErrorInfo := fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), script)
+
+	// Create the runtime and register all builtins
+	vm := goja.New()
+	for _, builtin := range builtinFuncs {
+		if err := vm.Set(builtin.name, builtin.function(vm)); err != nil {
+			panic(err)
+		}
+	}
+	for _, builtin := range builtinVars {
+		if err := vm.Set(builtin.name, builtin.getter(vm, jsonMap)); err != nil {
+			panic(err)
+		}
+	}
+
+	// Compile and run the script
+	halted := false
+	var value goja.Value
+	program, err := goja.Compile(globals.AnonymousScriptPath, script, false)
+	if err == nil {
+		value, halted, err = runWithHalting(ctx, code.Timeout(), vm, program, scriptErrorInfo)
+	}
+	if err != nil {
+		if halted {
+			return nil, err
+		}
+		// Re-wrap the error as a ScriptError
+		return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
+	}
+
+	// De-JOM-ify the environment and return the json_map.JsonMapInt
+	data, err = deJomIfy(code, jsonMap, vm)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the script is an expression then assign the value it evaluated to, to the script's key
+	if code.IsExpression() {
+		if err = code.Assign(data, value.Export()); err != nil {
+			return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
+		}
+	}
+	return data, nil
+}
+
+// Evaluates the given filter expression against the given current node.
+//
+// The current node is parsed into the runtime and stored within the variable named globals.CurrentNodeValueVarName.
+// The expression is wrapped in "!!()" so that it is converted to a boolean.
+func RunFilter(expression string, currentNode interface{}) (truer bool, err error) {
+	vm := goja.New()
+	currentNodeValue, err := parse(vm, currentNode)
+	if err != nil {
+		return false, err
+	}
+	if err = vm.Set(globals.CurrentNodeValueVarName, currentNodeValue); err != nil {
+		return false, err
+	}
+
+	program, err := goja.Compile(globals.AnonymousScriptPath, fmt.Sprintf("!!(%s)", expression), false)
+	if err != nil {
+		return false, err
+	}
+	// Filter expressions are given the same time limit as those evaluated by the otto filter runner within the jom package
+	value, _, err := runWithHalting(context.Background(), 1 * globals.HaltingDelayUnits, vm, program, expression)
+	if err != nil {
+		return false, err
+	}
+	return value.ToBoolean(), nil
+}
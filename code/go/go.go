@@ -4,10 +4,13 @@
 package _go
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/andygello555/json-dom/code"
 	"github.com/andygello555/json-dom/jom/json_map"
 	"github.com/andygello555/json-dom/globals"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,82 +19,193 @@ func init() {
 	code.RegisterLang("go", RunCallback)
 }
 
+// Describes a callback which has been abandoned by RunCallback because it did not return before its context was done.
+type LeakEvent struct {
+	// The JSON path to the scope the callback was run in.
+	ScopePath string
+	// The callback.
+	Callback  interface{}
+	// The error RunCallback returned when the callback was abandoned (a globals.HaltingProblem or globals.Cancelled).
+	Err       error
+	// Whether the abandoned callback has since returned.
+	Returned  bool
+	// How long the callback has been running for.
+	Elapsed   time.Duration
+}
+
+// Called whenever a callback is abandoned (LeakEvent.Returned is false), and again when that callback eventually
+// returns (LeakEvent.Returned is true). This can be used to log or record metrics for callbacks that do not respect
+// their context.
+//
+// Note: LeakHook should be set before any callbacks are run. It can be called concurrently from multiple goroutines.
+var LeakHook func(event LeakEvent)
+
+// How long a callback has to return once its context is done before it is abandoned. This gives callbacks that respect
+// their context time to return, so that they are not reported as leaked and do not modify the scope after RunCallback
+// has returned.
+var LeakGracePeriod = 100 * time.Millisecond
+
+// The number of abandoned callbacks which have not yet returned.
+var leaked int64
+
+// Returns the number of callbacks which have been abandoned by RunCallback and have not yet returned.
+func Leaked() int64 {
+	return atomic.LoadInt64(&leaked)
+}
+
+// The result of a callback which is sent from the callback's goroutine.
+type result struct {
+	// The value returned by expression callbacks.
+	value  interface{}
+	// The error returned by the callback.
+	err    error
+	// The value recovered if the callback panicked.
+	caught interface{}
+}
+
+// Converts the given callback into a func(ctx context.Context, json json_map.JsonMapInt) (interface{}, error).
+// Callbacks which do not take a context will not be able to stop when the context is done.
+func normalise(callback interface{}) func(ctx context.Context, json json_map.JsonMapInt) (interface{}, error) {
+	switch callback.(type) {
+	case func(json json_map.JsonMapInt):
+		return func(ctx context.Context, json json_map.JsonMapInt) (interface{}, error) {
+			callback.(func(json json_map.JsonMapInt))(json)
+			return nil, nil
+		}
+	case func(json json_map.JsonMapInt) interface{}:
+		return func(ctx context.Context, json json_map.JsonMapInt) (interface{}, error) {
+			return callback.(func(json json_map.JsonMapInt) interface{})(json), nil
+		}
+	case func(ctx context.Context, json json_map.JsonMapInt) error:
+		return func(ctx context.Context, json json_map.JsonMapInt) (interface{}, error) {
+			return nil, callback.(func(ctx context.Context, json json_map.JsonMapInt) error)(ctx, json)
+		}
+	default:
+		return callback.(func(ctx context.Context, json json_map.JsonMapInt) (interface{}, error))
+	}
+}
+
 // Runs a Go callback.
 //
-// Callback must have the signature:
+// Callback must have one of the signatures:
+//  func(ctx context.Context, json json_map.JsonMapInt) error
+//  func(ctx context.Context, json json_map.JsonMapInt) (interface{}, error)
 //  func(json json_map.JsonMapInt)
-// Otherwise RunCallback will panic.
+//  func(json json_map.JsonMapInt) interface{}
+// Otherwise RunCallback will panic. The value returned by expression callbacks (the second and fourth) will be
+// assigned to the callback's key. Any error returned by the callback will be returned as a globals.ScriptError, and
+// any panic will be re-panicked.
 //
 // Halting Problem
 //
-// The given callback within code will be wrapped in a goroutine which will push an interrupt once the callback has finished.
-// If the callback doesn't finish within globals.HaltingDelay seconds a separate goroutine will push the interrupt which
-// will cause RunCallback to return early.
+// The callback is run in its own goroutine and is passed a context which is done once the callback's timeout
+// (code.Code.Timeout) has elapsed or the given context is done. In which case RunCallback will return a
+// globals.HaltingProblem or globals.Cancelled error respectively.
 //
-// Note: If a halting problem issue occurs then there will be a goroutine running the callback until it has finished, which may be never.
-// Keep this in mind if you have a long running program which utilises native Go callback execution.
-func RunCallback(code code.Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error) {
-	// Get the callback from the code object
-	callback := code.Script.(func(json json_map.JsonMapInt))
-	interrupts := make(chan func() bool)
-
-	// Construct a wrapper around the callback which will write to the interrupts channel once finished
-	callbackSafe := func() {
+// Callbacks should return as soon as possible once their context is done, by returning the context's error. Any other
+// errors returned, or panics raised, by callbacks after their context is done are still reported. Callbacks which don't return within the
+// LeakGracePeriod (including those that don't take a context) are abandoned and are counted by Leaked until they
+// return. LeakHook is called when this happens.
+func RunCallback(ctx context.Context, code code.Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error) {
+	callback := normalise(code.Script)
+	scopePath := jsonMap.GetCurrentScopePath()
+	scriptErrorInfo := fmt.Sprintf(globals.ScriptErrorFormatString, scopePath, fmt.Sprintf("%v", code.Script))
+
+	// The timer within the context is stopped by cancel once we return
+	start := time.Now()
+	haltCtx, cancel := context.WithTimeout(ctx, code.Timeout())
+	defer cancel()
+
+	// The results channel is buffered so that the callback's goroutine can always send its result, even if it has been
+	// abandoned
+	results := make(chan result, 1)
+	var abandoned int32
+	go func() {
+		var r result
 		defer func() {
-			// Here we catch any panics that may have happened in the callback and add them to the interrupts channel
-			// so they will re-panic in the outer scope
+			// Catch any panics that may have happened in the callback so that they can be re-panicked in the outer scope
 			if caught := recover(); caught != nil {
-				interrupts <- func() bool {
-					panic(caught)
-				}
-			} else {
-				// Otherwise we have finished then we will signal to everyone that we have using an interrupt which
-				// returns true
-				interrupts <- func() bool {
-					return true
+				r.caught = caught
+			}
+			results <- r
+			// If the callback was abandoned then report that it has finally returned
+			if !atomic.CompareAndSwapInt32(&abandoned, 0, 1) {
+				atomic.AddInt64(&leaked, -1)
+				if LeakHook != nil {
+					LeakHook(LeakEvent{
+						ScopePath: scopePath,
+						Callback:  code.Script,
+						Returned:  true,
+						Elapsed:   time.Since(start),
+					})
 				}
 			}
 		}()
-		callback(jsonMap)
+		r.value, r.err = callback(haltCtx, jsonMap)
+	}()
+
+	// Returns the error for when the callback's context is done
+	doneErr := func() error {
+		if ctx.Err() != nil {
+			return globals.Cancelled.WrapError(ctx.Err(), time.Since(start).String(), scriptErrorInfo)
+		}
+		return globals.HaltingProblem.FillError(time.Since(start).String(), scriptErrorInfo)
 	}
 
-	// To stop infinite loops start a timer which will panic once the timer stops and be caught in a deferred func
-	start := time.Now()
-	// This will catch any panics thrown by running the script/the timer
-	defer func() {
-		duration := time.Since(start)
-		if caught := recover(); caught != nil {
-			// If the caught error is the HaltingProblem var then package it up using FillError and set the outer error
-			if caught == globals.HaltingProblem {
-				err = globals.HaltingProblem.FillError(
-					duration.String(),
-					fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), fmt.Sprintf("%v", code.Script)),
-				)
-				return
+	var r result
+	select {
+	case r = <-results:
+	case <-haltCtx.Done():
+		// Give the callback a chance to return now that its context is done
+		grace := time.NewTimer(LeakGracePeriod)
+		defer grace.Stop()
+		select {
+		case r = <-results:
+		case <-grace.C:
+			// The callback may have returned at the same time as the grace period ending. The leak is counted before the
+			// callback is marked as abandoned so that the count never goes negative
+			atomic.AddInt64(&leaked, 1)
+			if !atomic.CompareAndSwapInt32(&abandoned, 0, 1) {
+				atomic.AddInt64(&leaked, -1)
+				r = <-results
+				break
 			}
-			// Another error that we should panic for
-			panic(caught)
+			err = doneErr()
+			if LeakHook != nil {
+				LeakHook(LeakEvent{
+					ScopePath: scopePath,
+					Callback:  code.Script,
+					Err:       err,
+					Elapsed:   time.Since(start),
+				})
+			}
+			return nil, err
 		}
-	}()
+	}
 
-	// Start the timer which will also write to the interrupts channel to indicate that we are finished
-	go func() {
-		time.Sleep(time.Duration(globals.HaltingDelay) * globals.HaltingDelayUnits)
-		// Push an interrupts that will panic with the HaltingProblem global
-		interrupts <- func() bool {
-			panic(globals.HaltingProblem)
-		}
-	}()
+	// Callbacks which return the error of their context once it is done have stopped because of the context. Otherwise,
+	// callbacks which return at the same time as their context being done are treated as finished, so any panics and
+	// errors from them are reported as usual
+	if r.err != nil && haltCtx.Err() != nil && errors.Is(r.err, haltCtx.Err()) {
+		return nil, doneErr()
+	}
+	if r.caught != nil {
+		panic(r.caught)
+	}
+	if r.err != nil {
+		return nil, globals.ScriptError.FillError(r.err.Error(), scriptErrorInfo)
+	}
 
-	go callbackSafe()
-	// We keep looping until we have read from the interrupts which signals us that the callback is done
-	for {
-		interrupt, ok := <-interrupts
-		// We execute the interrupt which will either return true or panic in the main thread of execution to be
-		// caught by the defer above which will fill out the HaltingProblem error.
-		if ok && interrupt() {
-			break
+	// If the callback is an expression then assign the value it returned to the callback's key
+	if code.IsExpression() {
+		if err = code.Assign(jsonMap, r.value); err != nil {
+			return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
 		}
 	}
-	return jsonMap, err
+
+	// The scope is modified in place by the callback so it has to be marshalled to check its size against the budget
+	if err = code.CheckScopeSize(jsonMap, jsonMap); err != nil {
+		return nil, err
+	}
+	return jsonMap, nil
 }
@@ -0,0 +1,306 @@
+// Contains runner for Go source scripts which are interpreted at evaluation time using yaegi.
+//
+// This allows Go scripts to be embedded within hjson files, unlike native Go callbacks which can only be added to the
+// JOM from Go code. The embedded source must define:
+//  func Run(json json_map.JsonMapInt)
+// Which will be passed the same json_map.JsonMapInt that native Go callbacks are passed.
+package gosrc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/andygello555/json-dom/code"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Register this language in the code package.
+func init() {
+	code.RegisterLang("gosrc", RunScript)
+}
+
+// These can be set when testing to check output.
+var (
+	ExternalConsoleLogStdout io.Writer = os.Stdout
+	ExternalConsoleLogStderr io.Writer = os.Stderr
+)
+
+// The standard library packages which can be imported by scripts. Packages which give access to the filesystem,
+// network or processes are not included.
+var AllowedPackages = []string{
+	"bytes",
+	"encoding/json",
+	"errors",
+	"fmt",
+	"math",
+	"regexp",
+	"sort",
+	"strconv",
+	"strings",
+	"unicode",
+	"unicode/utf8",
+}
+
+// Describes a script which has been abandoned by RunScript because it did not return before its context was done.
+type LeakEvent struct {
+	// The JSON path to the scope the script was run in.
+	ScopePath string
+	// The source of the script.
+	Script    string
+	// The error RunScript returned when the script was abandoned (a globals.HaltingProblem or globals.Cancelled).
+	Err       error
+	// Whether the abandoned script has since returned.
+	Returned  bool
+	// How long the script has been running for.
+	Elapsed   time.Duration
+}
+
+// Called whenever a script is abandoned (LeakEvent.Returned is false), and again when that script eventually returns
+// (LeakEvent.Returned is true). This is the same as the LeakHook for native Go callbacks.
+//
+// Note: LeakHook should be set before any scripts are run. It can be called concurrently from multiple goroutines.
+var LeakHook func(event LeakEvent)
+
+// How long a script has to return once its context is done before it is abandoned. The interpreter checks for
+// cancellation between statements, so scripts are only abandoned when they are blocked within a call to a package.
+var LeakGracePeriod = 100 * time.Millisecond
+
+// The number of abandoned scripts which have not yet returned.
+var leaked int64
+
+// Returns the number of scripts which have been abandoned by RunScript and have not yet returned.
+func Leaked() int64 {
+	return atomic.LoadInt64(&leaked)
+}
+
+// A copy of a scope which is detached from the document that the scope is being evaluated within. Root returns the
+// copy itself and Parent returns nil, as if the copy is not being evaluated, so that scripts (including abandoned
+// ones) cannot modify the document.
+type detachedScope struct {
+	json_map.JsonMapInt
+}
+
+// Clones are also detached.
+func (scope detachedScope) Clone(clear bool) json_map.JsonMapInt {
+	return detachedScope{scope.JsonMapInt.Clone(clear)}
+}
+
+func (scope detachedScope) Root() json_map.JsonMapInt {
+	return scope
+}
+
+func (scope detachedScope) Parent() json_map.JsonMapInt {
+	return nil
+}
+
+// The import path of the package which is used internally to pass the scope into the interpreter.
+const scopePackagePath = "github.com/andygello555/json-dom/code/gosrc/scope"
+
+// The symbols of the json_map package which can be imported by scripts.
+var jsonMapSymbols = map[string]reflect.Value{
+	"AbsolutePathKey":          reflect.ValueOf((*json_map.AbsolutePathKey)(nil)),
+	"AbsolutePathKeyType":      reflect.ValueOf((*json_map.AbsolutePathKeyType)(nil)),
+	"AbsolutePathKeyTypeNames": reflect.ValueOf(&json_map.AbsolutePathKeyTypeNames).Elem(),
+	"AbsolutePaths":            reflect.ValueOf((*json_map.AbsolutePaths)(nil)),
+	"JsonMapInt":               reflect.ValueOf((*json_map.JsonMapInt)(nil)),
+	"JsonPathNode":             reflect.ValueOf((*json_map.JsonPathNode)(nil)),
+	"ParseJsonPath":            reflect.ValueOf(json_map.ParseJsonPath),
+	"StringKey":                reflect.ValueOf(json_map.StringKey),
+	"IndexKey":                 reflect.ValueOf(json_map.IndexKey),
+	"Wildcard":                 reflect.ValueOf(json_map.Wildcard),
+	"Filter":                   reflect.ValueOf(json_map.Filter),
+	"First":                    reflect.ValueOf(json_map.First),
+	"Slice":                    reflect.ValueOf(json_map.Slice),
+	"StartEnd":                 reflect.ValueOf(json_map.StartEnd),
+	"RecursiveLookup":          reflect.ValueOf(json_map.RecursiveLookup),
+}
+
+// Creates a new interpreter which can only import the AllowedPackages, json_map, and the package containing the given
+// scope and the function which is deferred by the call to Run (or the expression).
+func newInterpreter(scope *json_map.JsonMapInt, returned func()) (*interp.Interpreter, error) {
+	i := interp.New(interp.Options{
+		Stdout: ExternalConsoleLogStdout,
+		Stderr: ExternalConsoleLogStderr,
+	})
+
+	symbols := interp.Exports{
+		"github.com/andygello555/json-dom/jom/json_map/json_map": jsonMapSymbols,
+		scopePackagePath + "/scope": {
+			"Current":  reflect.ValueOf(scope).Elem(),
+			"Returned": reflect.ValueOf(returned),
+		},
+	}
+	for _, pkg := range AllowedPackages {
+		key := pkg + "/" + path.Base(pkg)
+		symbols[key] = stdlib.Symbols[key]
+	}
+	if err := i.Use(symbols); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Run the given Go source, with the given json_map.JsonMapInt and return the new json_map.JsonMapInt for the scope.
+//
+// Order of execution
+//
+// • A copy of the scope is made so that changes are only reflected in the JOM if the script runs successfully. The
+// copy is detached from the document, so its Root is itself and its Parent is nil.
+//
+// • A new interpreter is created and the source is evaluated. Any errors will be returned as a globals.ScriptError.
+//
+// • The Run function defined by the source is called with the copy of the scope.
+//
+// • The copy of the scope is returned.
+//
+// If the script is an expression then it is evaluated with the copy of the scope available as "json", and all the
+// packages that can be imported are imported automatically. The value it evaluates to is assigned to the script's key.
+//
+// Halting Problem
+//
+// Evaluation is cancelled once the script's timeout has elapsed or the given context is done. The interpreter continues
+// running in a separate goroutine until it next checks for cancellation, which it does between statements. Like native
+// Go callbacks, if the call to Run (or the expression) does not return within the LeakGracePeriod then it is abandoned
+// and counted by Leaked until it returns, and LeakHook is called. Abandoned scripts can only modify their own copy of
+// the scope.
+func RunScript(ctx context.Context, code code.Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error) {
+	script := code.Script.(string)
+	scopePath := jsonMap.GetCurrentScopePath()
+	scriptErrorInfo := fmt.Sprintf(globals.ScriptErrorFormatString, scopePath, script)
+
+	// The scope is a deep copy so that any changes made before an error occurs are not reflected in the JOM
+	scope := jsonMap.Clone(false)
+	insidesJson, err := json.Marshal(jsonMap.GetInsides())
+	if err == nil {
+		*scope.GetInsides() = make(map[string]interface{})
+		err = json.Unmarshal(insidesJson, scope.GetInsides())
+	}
+	if err != nil {
+		return nil, globals.BuiltinGetterError.FillError("scope", "Could not copy scope", err.Error())
+	}
+	// The interpreter is given its own reference to the copy, as an abandoned script could still be reading it once
+	// RunScript has returned
+	var current json_map.JsonMapInt = detachedScope{scope}
+
+	// To stop infinite loops the source is evaluated and run with a context, derived from the given context, that has a
+	// deadline
+	start := time.Now()
+	haltCtx, cancel := context.WithTimeout(ctx, code.Timeout())
+	defer cancel()
+
+	// Called by the interpreter's goroutine once the call to Run (or the expression) returns. If the call was abandoned
+	// then report that it has finally returned
+	var abandoned int32
+	returned := make(chan struct{})
+	var returnOnce sync.Once
+	i, err := newInterpreter(&current, func() {
+		returnOnce.Do(func() {
+			close(returned)
+			if !atomic.CompareAndSwapInt32(&abandoned, 0, 1) {
+				atomic.AddInt64(&leaked, -1)
+				if LeakHook != nil {
+					LeakHook(LeakEvent{
+						ScopePath: scopePath,
+						Script:    script,
+						Returned:  true,
+						Elapsed:   time.Since(start),
+					})
+				}
+			}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Whether Run (or the expression) has been called
+	called := false
+	if code.IsExpression() {
+		// Expressions are evaluated within a function literal which is given the scope as "json". All packages that can
+		// be imported are imported automatically
+		i.ImportUsed()
+		// The value is assigned to a variable first as yaegi returns a pointer to the value of a call expression
+		var value reflect.Value
+		called = true
+		_, err = i.EvalWithContext(haltCtx, fmt.Sprintf("var jsonDomResult interface{} = func(json json_map.JsonMapInt) interface{} { defer scope.Returned(); return %s }(scope.Current)", script))
+		if err == nil {
+			if value, err = i.Eval("jsonDomResult"); err == nil {
+				err = code.Assign(current, value.Interface())
+			}
+		}
+	} else if _, err = i.EvalWithContext(haltCtx, script); err == nil {
+		// Check that a Run function with the correct signature has been defined
+		var run reflect.Value
+		if run, err = i.Eval("Run"); err == nil {
+			if _, ok := run.Interface().(func(json_map.JsonMapInt)); !ok {
+				err = fmt.Errorf("Run must have the signature func(json json_map.JsonMapInt) not %s", run.Type())
+			}
+		}
+		if err == nil {
+			_, err = i.Eval(fmt.Sprintf("import jsonDomScope %q", scopePackagePath))
+		}
+		if err == nil {
+			called = true
+			_, err = i.EvalWithContext(haltCtx, "func() { defer jsonDomScope.Returned(); Run(jsonDomScope.Current) }()")
+		}
+	}
+
+	if err != nil {
+		// Returns the error for when the script's context is done
+		doneErr := func() error {
+			// If the given context is done then evaluation has been cancelled
+			if ctx.Err() != nil {
+				return globals.Cancelled.WrapError(ctx.Err(), time.Since(start).String(), scriptErrorInfo)
+			}
+			// Otherwise the context's deadline was exceeded so package it up as a HaltingProblem
+			return globals.HaltingProblem.FillError(time.Since(start).String(), scriptErrorInfo)
+		}
+
+		if haltCtx.Err() == nil {
+			return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
+		}
+		err = doneErr()
+
+		// If Run (or the expression) was called then give it a chance to return now that its context is done
+		if called {
+			grace := time.NewTimer(LeakGracePeriod)
+			defer grace.Stop()
+			select {
+			case <-returned:
+			case <-grace.C:
+				// The script may have returned at the same time as the grace period ending. The leak is counted before
+				// the script is marked as abandoned so that the count never goes negative
+				atomic.AddInt64(&leaked, 1)
+				if !atomic.CompareAndSwapInt32(&abandoned, 0, 1) {
+					atomic.AddInt64(&leaked, -1)
+					break
+				}
+				if LeakHook != nil {
+					LeakHook(LeakEvent{
+						ScopePath: scopePath,
+						Script:    script,
+						Err:       err,
+						Elapsed:   time.Since(start),
+					})
+				}
+			}
+		}
+		return nil, err
+	}
+
+	// The scope is modified in place by the script so it has to be marshalled to check its size against the budget
+	if err = code.CheckScopeSize(jsonMap, current); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
@@ -0,0 +1,154 @@
+package code
+
+import "reflect"
+
+// Whether the given value within a scope can be serialised to JSON. Go callbacks (and any other functions, channels or
+// complex numbers) and Code cannot be serialised.
+func IsSerialisable(value interface{}) bool {
+	switch value.(type) {
+	case nil, bool, float64, string, map[string]interface{}, []interface{}:
+		return true
+	case Code, *Code:
+		return false
+	}
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.Func, reflect.Chan, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return false
+	}
+	return true
+}
+
+// A value within a scope which cannot be serialised, along with the path to it from the root of the scope. Each key of
+// the path is either a string key of an object or an int index of an array.
+type hiddenValue struct {
+	path  []interface{}
+	value interface{}
+}
+
+// The values within a scope which have been hidden by Hide.
+type Hidden []hiddenValue
+
+// Hides all the values within the given scope which cannot be serialised (see IsSerialisable), such as Go callbacks, so
+// that the scope can be serialised for scripts. Hidden values are replaced by nil, so that scripts can delete the keys
+// of hidden values within objects (see Restore), and so that the indices of the other elements within arrays are not
+// changed.
+//
+// The given insides are not modified. Instead, the objects and arrays which contain hidden values are copied. Returns
+// the given insides if nothing was hidden.
+func Hide(insides map[string]interface{}) (visible map[string]interface{}, hidden Hidden) {
+	hidden = make(Hidden, 0)
+	visibleValue, _ := hide(insides, []interface{}{}, &hidden, false)
+	return visibleValue.(map[string]interface{}), hidden
+}
+
+// Like Hide, only hidden values are removed from objects rather than being replaced by nil. This is used for scopes
+// whose hidden values are not restored, such as the root and parent of a script's scope (see jom.JsonMap.Snapshot).
+func Omit(insides map[string]interface{}) (visible map[string]interface{}) {
+	hidden := make(Hidden, 0)
+	visibleValue, _ := hide(insides, []interface{}{}, &hidden, true)
+	return visibleValue.(map[string]interface{})
+}
+
+// Hides the values within the given value at the given path. Hidden values are removed from objects if omit is true.
+// Returns the given value, and false, if nothing was hidden.
+func hide(value interface{}, path []interface{}, hidden *Hidden, omit bool) (visible interface{}, changed bool) {
+	// Returns a copy of the given path with the given key appended
+	child := func(key interface{}) []interface{} {
+		return append(append(make([]interface{}, 0, len(path) + 1), path...), key)
+	}
+
+	switch value.(type) {
+	case map[string]interface{}:
+		object := value.(map[string]interface{})
+		var visibleObject map[string]interface{}
+		for key, inner := range object {
+			var visibleInner interface{}
+			var innerChanged bool
+			innerHidden := !IsSerialisable(inner)
+			if innerHidden {
+				*hidden = append(*hidden, hiddenValue{child(key), inner})
+			} else if visibleInner, innerChanged = hide(inner, child(key), hidden, omit); !innerChanged {
+				continue
+			}
+
+			// The object is only copied once something within it has been hidden
+			if visibleObject == nil {
+				visibleObject = make(map[string]interface{}, len(object))
+				for k, v := range object {
+					visibleObject[k] = v
+				}
+			}
+			if innerHidden && omit {
+				delete(visibleObject, key)
+			} else {
+				visibleObject[key] = visibleInner
+			}
+		}
+		if visibleObject != nil {
+			return visibleObject, true
+		}
+	case []interface{}:
+		array := value.([]interface{})
+		var visibleArray []interface{}
+		for i, inner := range array {
+			var visibleInner interface{}
+			var innerChanged bool
+			if !IsSerialisable(inner) {
+				*hidden = append(*hidden, hiddenValue{child(i), inner})
+			} else if visibleInner, innerChanged = hide(inner, child(i), hidden, omit); !innerChanged {
+				continue
+			}
+
+			// The array is only copied once something within it has been hidden
+			if visibleArray == nil {
+				visibleArray = append(make([]interface{}, 0, len(array)), array...)
+			}
+			visibleArray[i] = visibleInner
+		}
+		if visibleArray != nil {
+			return visibleArray, true
+		}
+	}
+	return value, false
+}
+
+// Restores the hidden values into the given scope, which is the scope returned by a script that was given the visible
+// scope returned by Hide. A hidden value is only restored if the object or array that contained it still exists at the
+// same path, and the script has left the nil in its place. Otherwise, the script has deleted the hidden value (or set
+// another value in its place), so it is discarded.
+func (hidden Hidden) Restore(insides map[string]interface{}) {
+	for _, value := range hidden {
+		var container interface{} = insides
+		for _, key := range value.path[:len(value.path) - 1] {
+			switch key.(type) {
+			case string:
+				object, ok := container.(map[string]interface{})
+				if !ok {
+					container = nil
+					break
+				}
+				container = object[key.(string)]
+			case int:
+				array, ok := container.([]interface{})
+				if !ok || key.(int) >= len(array) {
+					container = nil
+					break
+				}
+				container = array[key.(int)]
+			}
+		}
+
+		switch key := value.path[len(value.path) - 1]; key.(type) {
+		case string:
+			if object, ok := container.(map[string]interface{}); ok {
+				if inner, ok := object[key.(string)]; ok && inner == nil {
+					object[key.(string)] = value.value
+				}
+			}
+		case int:
+			if array, ok := container.([]interface{}); ok && key.(int) < len(array) && array[key.(int)] == nil {
+				array[key.(int)] = value.value
+			}
+		}
+	}
+}
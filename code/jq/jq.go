@@ -0,0 +1,162 @@
+// Contains runner for the execution of jq filters using gojq.
+//
+// Unlike the other script languages there is no JOM object. The filter is given the current scope (the value behind
+// json.trail in the other languages) as input, and its output replaces the scope.
+package jq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	str "github.com/andygello555/gotils/strings"
+	"github.com/andygello555/json-dom/code"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"github.com/itchyny/gojq"
+	"time"
+)
+
+// Register this language in the code package.
+func init() {
+	code.RegisterLang("jq", RunScript)
+}
+
+const (
+	// The name of the variable which contains the JSON path to the current scope (equivalent to json.scopePath).
+	ScopePathVariableName = "$scopePath"
+	// The name of the variable which contains the variables given to the evaluation of the document (equivalent to
+	// json.vars).
+	VarsVariableName      = "$vars"
+)
+
+// Normalises the given value by marshalling it to JSON and back again so that it only contains the types that
+// encoding/json unmarshals into (gojq can output ints and big.Ints).
+func normalise(value interface{}) (out interface{}, err error) {
+	var literal []byte
+	if literal, err = json.Marshal(value); err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(literal, &out)
+	return out, err
+}
+
+// Run the given jq filter, with the given json_map.JsonMapInt and return the new json_map.JsonMapInt for the scope.
+//
+// Order of execution
+//
+// • The filter is parsed and compiled. Any errors will be returned as a globals.ScriptError.
+//
+// • The filter is run with the current scope as input. If the scope is an array root then the root array is used as
+// input instead. The JSON path to the scope and the variables given to the evaluation are bound to $scopePath and $vars.
+//
+// • The filter must output exactly one value. This must be an object (or an array if the scope is an array root),
+// unless the filter is an expression in which case it can be any value.
+//
+// • The output replaces the scope (or is assigned to the script's key if the filter is an expression) and the new
+// json_map.JsonMapInt is returned.
+func RunScript(ctx context.Context, code code.Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error) {
+	script := code.Script.(string)
+	scriptErrorInfo := fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), script)
+
+	// Parse and compile the filter
+	query, err := gojq.Parse(script)
+	if err != nil {
+		return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
+	}
+	compiled, err := gojq.Compile(query, gojq.WithVariables([]string{ScopePathVariableName, VarsVariableName}))
+	if err != nil {
+		return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
+	}
+
+	// Find the input to the filter
+	var input interface{} = *jsonMap.GetInsides()
+	if jsonMap.IsArray() {
+		input = (*jsonMap.GetInsides())["array"]
+	}
+	if input, err = normalise(input); err != nil {
+		return nil, globals.BuiltinGetterError.FillError("scope", "Could not normalise scope", err.Error())
+	}
+
+	// Find the variables given to the evaluation of the document
+	vars, err := normalise(jsonMap.Vars())
+	if err != nil {
+		return nil, globals.BuiltinGetterError.FillError(VarsVariableName, "Could not normalise vars", err.Error())
+	}
+
+	// To stop infinite loops the filter will be run with a context, derived from the given context, that has a deadline
+	start := time.Now()
+	haltCtx, cancel := context.WithTimeout(ctx, code.Timeout())
+	defer cancel()
+
+	outputs := make([]interface{}, 0)
+	iter := compiled.RunWithContext(haltCtx, input, jsonMap.GetCurrentScopePath(), vars)
+	for {
+		output, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok = output.(error); ok {
+			// If the given context is done then evaluation has been cancelled
+			if ctx.Err() != nil {
+				return nil, globals.Cancelled.WrapError(ctx.Err(), time.Since(start).String(), scriptErrorInfo)
+			}
+			// If the context's deadline was exceeded then package it up as a HaltingProblem
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil, globals.HaltingProblem.FillError(time.Since(start).String(), scriptErrorInfo)
+			}
+			return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
+		}
+		outputs = append(outputs, output)
+	}
+
+	if len(outputs) != 1 {
+		return nil, globals.ScriptError.FillError(fmt.Sprintf("jq filter must output exactly one value but output %d", len(outputs)), scriptErrorInfo)
+	}
+	literal, err := json.Marshal(outputs[0])
+	if err != nil {
+		return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
+	}
+	// Unless the filter is an expression, the output replaces the scope so its size is checked against the budget before
+	// it is unmarshalled
+	if !code.IsExpression() {
+		if err = code.CheckScopeBytes(jsonMap, len(literal)); err != nil {
+			return nil, err
+		}
+	}
+	var output interface{}
+	if err = json.Unmarshal(literal, &output); err != nil {
+		return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
+	}
+
+	// If the filter is an expression then assign the output to the script's key instead of replacing the scope
+	data = jsonMap.Clone(false)
+	if code.IsExpression() {
+		insides := make(map[string]interface{})
+		for key, value := range *jsonMap.GetInsides() {
+			insides[key] = value
+		}
+		*data.GetInsides() = insides
+		if err = code.Assign(data, output); err != nil {
+			return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
+		}
+		return data, nil
+	}
+
+	// Replace the scope with the output
+	switch output.(type) {
+	case map[string]interface{}:
+		if jsonMap.IsArray() {
+			return nil, globals.ScriptError.FillError("jq filter must output an array when the scope is an array root but output an object", scriptErrorInfo)
+		}
+		*data.GetInsides() = output.(map[string]interface{})
+	case []interface{}:
+		if !jsonMap.IsArray() {
+			return nil, globals.ScriptError.FillError("jq filter must output an object but output an array", scriptErrorInfo)
+		}
+		*data.GetInsides() = map[string]interface{}{"array": output}
+	default:
+		return nil, globals.ScriptError.FillError(fmt.Sprintf("jq filter must output an object but output a %s", str.TypeName(output)), scriptErrorInfo)
+	}
+	return data, nil
+}
@@ -0,0 +1,240 @@
+package js
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/robertkrimen/otto"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// The custom builtins registered using RegisterBuiltin, which are available to all scripts.
+var (
+	customBuiltins      = make(map[string]interface{})
+	customBuiltinsMutex sync.RWMutex
+	// Incremented by RegisterBuiltin so that VMs created before a builtin was registered are not reused (see getVM)
+	customBuiltinsVersion int32
+)
+
+// Registers the given Go function as a builtin function with the given name, which is available to every JS script.
+// Builtins which should only be available to some evaluations can be given within code.RunOptions.Builtins instead.
+//
+// The function can have any signature. Each argument given by the script is converted to the type of the function's
+// parameter (via JSON if the types differ), and missing arguments are given as zero values. The function can return at
+// most one value, which is converted to a JS value via JSON, optionally followed by an error which is thrown as a JS
+// error when it is not nil. A func(call otto.FunctionCall) otto.Value is registered as is.
+//
+// Returns a globals.InvalidBuiltin error if the function is invalid, or a globals.OverriddenBuiltin error if the name is
+// already taken. RegisterBuiltin should ideally be called before any scripts are run (i.e. within an init function), as
+// registering a builtin stops the VMs that are already within the pool from being reused.
+func RegisterBuiltin(name string, function interface{}) error {
+	if _, err := checkBuiltin(name, function); err != nil {
+		return err
+	}
+	customBuiltinsMutex.Lock()
+	defer customBuiltinsMutex.Unlock()
+	if _, ok := customBuiltins[name]; ok || isReservedName(name) || isGlobal(name) {
+		return globals.OverriddenBuiltin.FillError(name)
+	}
+	customBuiltins[name] = function
+	atomic.AddInt32(&customBuiltinsVersion, 1)
+	return nil
+}
+
+// Returns a copy of the builtins registered using RegisterBuiltin, along with the current customBuiltinsVersion.
+func registeredBuiltins() (builtins map[string]interface{}, version int32) {
+	customBuiltinsMutex.RLock()
+	defer customBuiltinsMutex.RUnlock()
+	builtins = make(map[string]interface{}, len(customBuiltins))
+	for name, function := range customBuiltins {
+		builtins[name] = function
+	}
+	return builtins, atomic.LoadInt32(&customBuiltinsVersion)
+}
+
+// Whether the given name is used by one of the builtins in builtinFuncs or builtinVars.
+func isReservedName(name string) bool {
+	for _, builtin := range builtinFuncs {
+		if builtin.name == name {
+			return true
+		}
+	}
+	for _, builtin := range builtinVars {
+		if builtin.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// The names of the properties of the global object within a new otto VM (e.g. "Math"). These are the same for every new
+// VM so they are only found once, by isGlobal.
+var (
+	ottoGlobals     map[string]struct{}
+	ottoGlobalsOnce sync.Once
+)
+
+// Whether the given name is already defined within the global object of a new otto VM (e.g. "Math").
+func isGlobal(name string) bool {
+	ottoGlobalsOnce.Do(func() {
+		names, err := otto.New().Run("Object.getOwnPropertyNames(this)")
+		if err != nil {
+			panic(err)
+		}
+		values := arrayValues(names.Object())
+		ottoGlobals = make(map[string]struct{}, len(values))
+		for _, value := range values {
+			ottoGlobals[value.String()] = struct{}{}
+		}
+	})
+	_, ok := ottoGlobals[name]
+	return ok
+}
+
+// Checks that the given function can be used as a builtin and returns its reflect.Value.
+func checkBuiltin(name string, function interface{}) (value reflect.Value, err error) {
+	if _, ok := function.(func(call otto.FunctionCall) otto.Value); ok {
+		return reflect.ValueOf(function), nil
+	}
+	value = reflect.ValueOf(function)
+	if value.Kind() != reflect.Func || value.IsNil() {
+		return value, globals.InvalidBuiltin.FillError(name, fmt.Sprintf("%T is not a function", function))
+	}
+	functionType := value.Type()
+	results := functionType.NumOut()
+	if results > 0 && functionType.Out(results - 1) == reflect.TypeOf((*error)(nil)).Elem() {
+		results--
+	}
+	if results > 1 {
+		return value, globals.InvalidBuiltin.FillError(name, fmt.Sprintf("%T returns more than one value (excluding an error)", function))
+	}
+	return value, nil
+}
+
+// Wraps the given function, which has been checked using checkBuiltin, so that it can be called from within the given
+// VM.
+func wrapBuiltin(vm *pooledVM, name string, function interface{}) (wrapped func(call otto.FunctionCall) otto.Value, err error) {
+	if native, ok := function.(func(call otto.FunctionCall) otto.Value); ok {
+		return native, nil
+	}
+	value, err := checkBuiltin(name, function)
+	if err != nil {
+		return nil, err
+	}
+	functionType := value.Type()
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+
+	return func(call otto.FunctionCall) otto.Value {
+		throw := func(err error) {
+			panic(call.Otto.MakeCustomError("BuiltinError", fmt.Sprintf("%s: %s", name, err.Error())))
+		}
+
+		// Convert the arguments to the types of the function's parameters
+		params := functionType.NumIn()
+		if !functionType.IsVariadic() && len(call.ArgumentList) > params {
+			throw(errors.New(fmt.Sprintf("takes at most %d argument(s) but was given %d", params, len(call.ArgumentList))))
+		}
+		args := make([]reflect.Value, 0, params)
+		for i := 0; i < params || i < len(call.ArgumentList); i++ {
+			paramType := functionType.In(min(i, params - 1))
+			if functionType.IsVariadic() && i >= params - 1 {
+				// Variadic arguments are converted to the element type of the final parameter
+				if i >= len(call.ArgumentList) {
+					break
+				}
+				paramType = paramType.Elem()
+			}
+			arg, err := fromJS(call.Argument(i), paramType)
+			if err != nil {
+				throw(errors.New(fmt.Sprintf("argument %d: %s", i, err.Error())))
+			}
+			args = append(args, arg)
+		}
+
+		// Call the function and convert its results
+		results := value.Call(args)
+		if len(results) > 0 && functionType.Out(len(results) - 1) == errorType {
+			if err, _ := results[len(results) - 1].Interface().(error); err != nil {
+				throw(err)
+			}
+			results = results[:len(results) - 1]
+		}
+		if len(results) == 0 {
+			return otto.UndefinedValue()
+		}
+		result, err := toJS(vm, results[0].Interface())
+		if err != nil {
+			throw(errors.New(fmt.Sprintf("result: %s", err.Error())))
+		}
+		return result
+	}, nil
+}
+
+// Converts the given JS value to a Go value of the given type. The value is converted via JSON if its exported type
+// cannot be assigned to the given type.
+func fromJS(value otto.Value, to reflect.Type) (converted reflect.Value, err error) {
+	if value.IsUndefined() {
+		return reflect.Zero(to), nil
+	}
+	exported, err := value.Export()
+	if err != nil {
+		return converted, err
+	}
+	if exported == nil {
+		return reflect.Zero(to), nil
+	}
+	if reflect.TypeOf(exported).AssignableTo(to) {
+		return reflect.ValueOf(exported), nil
+	}
+
+	literal, err := json.Marshal(exported)
+	if err != nil {
+		return converted, err
+	}
+	converted = reflect.New(to)
+	if err = json.Unmarshal(literal, converted.Interface()); err != nil {
+		return converted, err
+	}
+	return converted.Elem(), nil
+}
+
+// Converts the given Go value to a JS value within the given VM via JSON, so that slices become JS arrays and maps
+// become JS objects.
+func toJS(vm *pooledVM, value interface{}) (converted otto.Value, err error) {
+	literal, err := json.Marshal(value)
+	if err != nil {
+		return otto.UndefinedValue(), err
+	}
+	return vm.parse.Call(otto.UndefinedValue(), string(literal))
+}
+
+// Sets the given builtins, which are only available to the current script, within the VM. Returns the names of the
+// builtins that have been set so that they can be deleted using deleteGlobals.
+func (vm *pooledVM) setBuiltins(builtins map[string]interface{}) (names []string, err error) {
+	names = make([]string, 0, len(builtins))
+	global := vm.global()
+	for name, function := range builtins {
+		if existing, _ := global.Get(name); existing.IsDefined() || isReservedName(name) {
+			return names, globals.OverriddenBuiltin.FillError(name)
+		}
+		var wrapped func(call otto.FunctionCall) otto.Value
+		if wrapped, err = wrapBuiltin(vm, name, function); err != nil {
+			return names, err
+		}
+		if err = vm.Set(name, wrapped); err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Deletes the global variables with the given names from the VM.
+func (vm *pooledVM) deleteGlobals(names []string) {
+	for _, name := range names {
+		_, _ = vm.deleteGlobal.Call(otto.UndefinedValue(), name)
+	}
+}
@@ -4,7 +4,9 @@
 package js
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/andygello555/json-dom/code"
 	"github.com/andygello555/json-dom/jom/json_map"
@@ -20,6 +22,7 @@ import (
 // Register this language in the code package.
 func init() {
 	code.RegisterLang("js", RunScript)
+	code.RegisterWriteLang("js")
 }
 
 // These can be set when testing to check output.
@@ -28,8 +31,6 @@ var (
 	ExternalConsoleLogStderr io.Writer = os.Stderr
 )
 
-var toBeCloned json_map.JsonMapInt
-
 // Used to map a JS Object from Otto into a map so that it can be used.
 func traverseObject(object *otto.Object) *map[string]interface{} {
 	objectMap := make(map[string]interface{})
@@ -149,7 +150,10 @@ func composePrint(call otto.FunctionCall) *strings.Builder {
 // • json_map.AbsolutePaths will be converted into JS values.
 //
 // • The returned object will be constructed (_absolutePaths, getValues, setValues).
-func jsonPathSelector(call otto.FunctionCall) otto.Value {
+//
+// The given pooledVM is the VM the script is running in and the given json_map.JsonMapInt is the scope the script is
+// running in.
+func jsonPathSelector(runtime *pooledVM, jsonMap json_map.JsonMapInt, call otto.FunctionCall) otto.Value {
 	var err error
 	vm := call.Otto
 
@@ -164,24 +168,8 @@ func jsonPathSelector(call otto.FunctionCall) otto.Value {
 	jsonPath, _ := call.Argument(0).ToString()
 
 	// We set up a function to retrieve the JsonMap so we can retrieve the most up to date version of json.trail
-	getJsonMap := func(vm *otto.Otto) json_map.JsonMapInt {
-		// Stringify the json.trail object
-		var trailStringValue otto.Value
-		trailStringValue, err = vm.Run(fmt.Sprintf("JSON.stringify(%s.trail)", globals.JOMVariableName))
-		if err != nil || trailStringValue.IsUndefined() || trailStringValue.IsNull() || !trailStringValue.IsString() {
-			if err != nil {
-				throw(err.Error())
-			}
-			throw(fmt.Sprintf("\"%s.trail\" is not JSON stringifiable. It is \"%v\".", globals.JOMVariableName, trailStringValue))
-		}
-		// Marshall the JSON string into a JsonMap
-		trailString, _ := trailStringValue.ToString()
-		jMap := toBeCloned.Clone(true)
-		err = jMap.Unmarshal([]byte(trailString))
-		if err != nil {
-			throw(fmt.Sprintf("cannot Unmarshall \"%s\" into a JsonMap", trailString))
-		}
-		return jMap
+	getJsonMap := func() json_map.JsonMapInt {
+		return trailJsonMap(runtime, jsonMap, throw)
 	}
 
 	// Another temp function to get the absolute path values from the given JsonMap
@@ -193,12 +181,12 @@ func jsonPathSelector(call otto.FunctionCall) otto.Value {
 		return values
 	}
 
-	// Then we will parse the JSON path
-	var absolutePaths json_map.AbsolutePaths
-	absolutePaths, err = json_map.ParseJsonPath(jsonPath)
-	if err != nil {
+	// Then we will compile the JSON path, which is cached, and take a copy of its absolute paths
+	var compiled *json_map.CompiledPath
+	if compiled, err = json_map.Compile(jsonPath); err != nil {
 		throw(err.Error())
 	}
+	absolutePaths := compiled.AbsolutePaths()
 
 	// Set up a temporary vm which we will use to construct the NodeSet
 	vmTemp := otto.New()
@@ -265,7 +253,7 @@ func jsonPathSelector(call otto.FunctionCall) otto.Value {
 	// Set getter and setter funcs
 	nodeSetMap["getValues"] = func(call otto.FunctionCall) otto.Value {
 		// Get the most "up to date" json map from json.trail
-		jsonMap := getJsonMap(call.Otto)
+		jsonMap := getJsonMap()
 		_, _ = vmTemp.Run("nodeValues = []")
 		nodes := getAbsPaths(&absolutePaths, jsonMap)
 
@@ -293,7 +281,7 @@ func jsonPathSelector(call otto.FunctionCall) otto.Value {
 
 	nodeSetMap["setValues"] = func(call otto.FunctionCall) otto.Value {
 		// Get the most "up to date" json map from json.trail
-		jsonMap := getJsonMap(call.Otto)
+		jsonMap := getJsonMap()
 		if len(call.ArgumentList) == 0 || len(call.ArgumentList) > 1 {
 			throw("setValue takes a single argument")
 		}
@@ -316,17 +304,7 @@ func jsonPathSelector(call otto.FunctionCall) otto.Value {
 		}
 
 		// Then we update the current json.trail object with the createJom function which will recreate the jom
-		var trail otto.Value
-		trail, err = createJom(jsonMap)
-		if err != nil {
-			throw("Could not JOM-ify modified JsonMap")
-		}
-
-		_ = call.Otto.Set(globals.ModifiedTrailValueVarName, trail)
-		_, err = call.Otto.Run(fmt.Sprintf("json[\"trail\"] = %s", globals.ModifiedTrailValueVarName))
-		if err != nil {
-			throw(err.Error())
-		}
+		replaceTrail(runtime, call.Otto, jsonMap, throw)
 		return otto.NullValue()
 	}
 
@@ -338,6 +316,112 @@ func jsonPathSelector(call otto.FunctionCall) otto.Value {
 	return nodeSet
 }
 
+// Stringifies json.trail within the given VM and unmarshalls it into a clone of the given json_map.JsonMapInt, so that
+// the most up to date version of json.trail can be read and modified. Calls throw if this cannot be done.
+func trailJsonMap(vm *pooledVM, jsonMap json_map.JsonMapInt, throw func(message string)) json_map.JsonMapInt {
+	// Stringify the json.trail object
+	trailString, err := vm.stringifyTrail()
+	if err != nil {
+		throw(err.Error())
+	}
+	// Marshall the JSON string into a JsonMap
+	jMap := jsonMap.Clone(true)
+	if err = jMap.Unmarshal([]byte(trailString)); err != nil {
+		throw(fmt.Sprintf("cannot Unmarshall \"%s\" into a JsonMap", trailString))
+	}
+	return jMap
+}
+
+// Replaces json.trail within the given VM with a JOM-ified version of the given json_map.JsonMapInt. Calls throw if
+// this cannot be done.
+func replaceTrail(runtime *pooledVM, vm *otto.Otto, jsonMap json_map.JsonMapInt, throw func(message string)) {
+	trail, err := createJom(runtime, jsonMap)
+	if err != nil {
+		throw("Could not JOM-ify modified JsonMap")
+	}
+
+	// The temporary variable is deleted afterwards so that the VM can be put back into the pool
+	_ = vm.Set(globals.ModifiedTrailValueVarName, trail)
+	_, err = vm.Run(fmt.Sprintf("json[\"trail\"] = %s; delete %s", globals.ModifiedTrailValueVarName, globals.ModifiedTrailValueVarName))
+	if err != nil {
+		throw(err.Error())
+	}
+}
+
+// Given a JSON pointer (RFC 6901) will return a "Pointer" object with getter, setter and deleter functions for the value
+// pointed to within json.trail.
+//
+// • The JSON pointer will be parsed using json_map.ParseJsonPointer so that invalid JSON pointers throw straight away.
+//
+// • Each function will stringify json.trail within the VM and unmarshall it to a new JsonMap.
+//
+// • The returned object will be constructed (pointer, getValue, setValue, deleteValue).
+//
+// The given pooledVM is the VM the script is running in and the given json_map.JsonMapInt is the scope the script is
+// running in.
+func jsonPointer(runtime *pooledVM, jsonMap json_map.JsonMapInt, call otto.FunctionCall) otto.Value {
+	vm := call.Otto
+
+	throw := func(message string) {
+		panic(vm.MakeCustomError("JSONPointerError", message))
+	}
+
+	// Check number of arguments and argument types
+	if len(call.ArgumentList) > 1 || !call.Argument(0).IsString() {
+		throw("pointer takes a single string argument")
+	}
+	pointer, _ := call.Argument(0).ToString()
+	if _, err := json_map.ParseJsonPointer(pointer); err != nil {
+		throw(err.Error())
+	}
+
+	pointerMap := map[string]interface{}{
+		"pointer": pointer,
+		"getValue": func(call otto.FunctionCall) otto.Value {
+			value, err := trailJsonMap(runtime, jsonMap, throw).PointerGet(pointer)
+			if err != nil {
+				throw(err.Error())
+			}
+			var converted otto.Value
+			if converted, err = toJS(runtime, value); err != nil {
+				throw(fmt.Sprintf("cannot Marshal value: \"%v\"", value))
+			}
+			return converted
+		},
+		"setValue": func(call otto.FunctionCall) otto.Value {
+			if len(call.ArgumentList) != 1 {
+				throw("setValue takes a single argument")
+			}
+			valueGo := toGo(call.Argument(0))
+			// The value returned by toGo can be a pointer, in which case the value it points to is used
+			if reflect.ValueOf(valueGo).Kind() == reflect.Ptr {
+				valueGo = reflect.Indirect(reflect.ValueOf(valueGo)).Interface()
+			}
+
+			jMap := trailJsonMap(runtime, jsonMap, throw)
+			if err := jMap.PointerSet(pointer, valueGo); err != nil {
+				throw(err.Error())
+			}
+			replaceTrail(runtime, call.Otto, jMap, throw)
+			return otto.NullValue()
+		},
+		"deleteValue": func(call otto.FunctionCall) otto.Value {
+			jMap := trailJsonMap(runtime, jsonMap, throw)
+			if err := jMap.PointerDelete(pointer); err != nil {
+				throw(err.Error())
+			}
+			replaceTrail(runtime, call.Otto, jMap, throw)
+			return otto.NullValue()
+		},
+	}
+
+	pointerObj, err := vm.ToValue(pointerMap)
+	if err != nil {
+		throw(fmt.Sprintf("could not convert \"%v\" to otto value", pointerMap))
+	}
+	return pointerObj
+}
+
 // Construct a list of all the builtin functions to register when creating the environment.
 var builtinFuncs = []struct{
 	name     string
@@ -354,29 +438,53 @@ var builtinVars = []struct{
 	name   string
 	getter func(...interface{}) interface{}
 }{
-	// Construct the main JOM object
+	// Construct the main JOM object. This is a JS object rather than a Go map so that the root and parent accessors can
+	// be defined on it
 	{globals.JOMVariableName, func(i ...interface{}) interface{} {
-		runtime := i[0].(*otto.Otto)
+		runtime := i[0].(*pooledVM)
 		jsonMap := i[1].(json_map.JsonMapInt)
-		trail, err := createJom(jsonMap)
+		outerScopes := i[2].([]*outerScope)
+		trail, err := createJom(runtime, jsonMap)
 		if err != nil {
 			panic(globals.BuiltinGetterError.FillError("json.trail", "Could not JOM-ify", err.Error()))
 		}
-		jom := map[string]interface{} {
+		// The vars are parsed for each script so that any changes a script makes to them are not seen by other scripts
+		vars, err := toJS(runtime, jsonMap.Vars())
+		if err != nil {
+			panic(globals.BuiltinGetterError.FillError("json.vars", "Could not JOM-ify", err.Error()))
+		}
+		jomFields := map[string]interface{} {
 			"trail": trail,
-			"jsonPathSelector": jsonPathSelector,
+			"vars": vars,
+			"jsonPathSelector": func(call otto.FunctionCall) otto.Value {
+				return jsonPathSelector(runtime, jsonMap, call)
+			},
+			"pointer": func(call otto.FunctionCall) otto.Value {
+				return jsonPointer(runtime, jsonMap, call)
+			},
 			"scopePath": jsonMap.GetCurrentScopePath(),
 		}
-		if val, err := runtime.ToValue(jom); err != nil {
-			panic(globals.BuiltinGetterError.FillError("json", "Could not convert JOM into otto.Value"))
-		} else {
-			return val
+		jom, err := runtime.newObject()
+		if err != nil {
+			panic(globals.BuiltinGetterError.FillError("json", "Could not create JOM obj"))
 		}
+		for name, field := range jomFields {
+			if err = jom.Set(name, field); err != nil {
+				panic(globals.BuiltinGetterError.FillError("json", "Could not convert JOM into otto.Value"))
+			}
+		}
+		for _, outer := range outerScopes {
+			if err = outer.define(runtime, jom); err != nil {
+				panic(globals.BuiltinGetterError.FillError(fmt.Sprintf("json.%s", outer.name), "Could not define accessor", err.Error()))
+			}
+		}
+		return jom.Value()
 	}},
 	{"console", func(i ...interface{}) interface{} {
-		// Sets up the console object
+		// Sets up the console object. This is a JS object rather than a Go map so that any changes made to it by a script
+		// can be detected before the VM is put back into the pool
 		runtime := i[0].(*otto.Otto)
-		consoleObj := map[string]interface{} {
+		consoleFuncs := map[string]interface{} {
 			"log": func(call otto.FunctionCall)otto.Value {
 				_, _ = fmt.Fprintf(ExternalConsoleLogStdout, "Print %s", composePrint(call))
 				return otto.NullValue()
@@ -387,21 +495,109 @@ var builtinVars = []struct{
 				return otto.NullValue()
 			},
 		}
-		if val, err := runtime.ToValue(consoleObj); err != nil {
-			panic(globals.BuiltinGetterError.FillError("console", "Could not convert console obj to otto.Value"))
-		} else {
-			return val
+		consoleObj, err := runtime.Object("({})")
+		if err != nil {
+			panic(globals.BuiltinGetterError.FillError("console", "Could not create console obj"))
+		}
+		for name, function := range consoleFuncs {
+			if err = consoleObj.Set(name, function); err != nil {
+				panic(globals.BuiltinGetterError.FillError("console", "Could not convert console obj to otto.Value"))
+			}
 		}
+		return consoleObj.Value()
 	}},
 }
 
-// Create the JOM within a Javascript VM, assign all necessary functions and retrieve the variable from within the VM.
+// A scope outside of the scope a script is running in, which the script can read using json.root or json.parent. The
+// scope is only JOM-ified the first time it is read so that scripts which do not read it do not have to pay for it.
+type outerScope struct {
+	// The name of the accessor within the JOM ("root" or "parent")
+	name  string
+	// The scope. Nil if there is no such scope (i.e. the parent of the root)
+	scope json_map.JsonMapInt
+	// Whether changes made to the scope by the script should be written back to the document
+	write bool
+	// The JOM-ified scope. Only set once read is true
+	value otto.Value
+	read  bool
+}
+
+// Returns the outer scopes (the root and parent) of the given scope that the given Code can read.
+func outerScopes(code code.Code, jsonMap json_map.JsonMapInt) []*outerScope {
+	return []*outerScope{
+		{name: "root", scope: jsonMap.Root(), write: code.Attributes.WriteRoot},
+		{name: "parent", scope: jsonMap.Parent(), write: code.Attributes.WriteParent},
+	}
+}
+
+// Defines the read-only accessor for the outerScope within the given JOM object. The outerScope is JOM-ified using the
+// given pooledVM the first time it is read.
+func (outer *outerScope) define(vm *pooledVM, jom *otto.Object) (err error) {
+	descriptor, err := vm.newObject()
+	if err != nil {
+		return err
+	}
+	if err = descriptor.Set("get", func(call otto.FunctionCall) otto.Value {
+		if outer.read {
+			return outer.value
+		}
+		outer.value, outer.read = otto.NullValue(), true
+		if outer.scope == nil {
+			return outer.value
+		}
+
+		scopeJson, err := outer.scope.Snapshot()
+		if err == nil {
+			outer.value, err = vm.parse.Call(otto.UndefinedValue(), string(scopeJson))
+		}
+		if err != nil {
+			panic(call.Otto.MakeCustomError("ScopeError", fmt.Sprintf("cannot JOM-ify json.%s: %s", outer.name, err.Error())))
+		}
+		return outer.value
+	}); err != nil {
+		return err
+	}
+	_, err = vm.defineProperty.Call(otto.UndefinedValue(), jom, outer.name, descriptor)
+	return err
+}
+
+// Writes any changes the script has made to the outerScope back to the document, as long as the script can write to the
+// outerScope and has read it.
+func (outer *outerScope) writeBack(vm *pooledVM) error {
+	if !outer.write || !outer.read || outer.scope == nil {
+		return nil
+	}
+	stringified, err := vm.stringify.Call(otto.UndefinedValue(), outer.value)
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	if err = json.Unmarshal([]byte(stringified.String()), &value); err != nil {
+		return err
+	}
+	switch value.(type) {
+	case map[string]interface{}:
+		err = outer.scope.Update(value.(map[string]interface{}))
+	case []interface{}:
+		// The root is an array
+		err = outer.scope.Update(map[string]interface{}{"array": value})
+	default:
+		return errors.New(fmt.Sprintf("json.%s is not an object or array", outer.name))
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("cannot write json.%s: %s", outer.name, err.Error()))
+	}
+	return nil
+}
+
+// Create the JOM within the given Javascript VM, assign all necessary functions and retrieve the variable from within
+// the VM.
 //
 // This will create a JOM for the scope of the given json map.
 // Note: This needs to be used to correctly parse Go arrays ([]interface{}) as JS arrays and not JS objects.
 // Returns an otto.Value which can be plugged into the VM which will run the scripts. If an error occurs at any point.
 // then an otto.NullValue and the error are returned.
-func createJom(jsonMap json_map.JsonMapInt) (run otto.Value, err error) {
+func createJom(vm *pooledVM, jsonMap json_map.JsonMapInt) (run otto.Value, err error) {
 	// Convert the map to json
 	var jsonDataBytes []byte
 	jsonDataBytes, err = json.Marshal(jsonMap.GetInsides())
@@ -410,12 +606,8 @@ func createJom(jsonMap json_map.JsonMapInt) (run otto.Value, err error) {
 	}
 	jsonData := string(jsonDataBytes)
 
-	// Create a VM, parse the json string and get the value out of the VM
-	vm := otto.New()
-	if err := vm.Set("jsonString", jsonData); err != nil {
-		return otto.NullValue(), err
-	}
-	run, err = vm.Run("JSON.parse(jsonString)")
+	// Parse the json string using the VM's JSON.parse
+	run, err = vm.parse.Call(otto.UndefinedValue(), jsonData)
 	if err != nil {
 		return otto.NullValue(), err
 	}
@@ -425,22 +617,51 @@ func createJom(jsonMap json_map.JsonMapInt) (run otto.Value, err error) {
 	return run, nil
 }
 
+// Stringifies json.trail using the VM's JSON.stringify, which cannot be overridden by scripts.
+//
+// NOTE JSON.stringify will strip keys that are functions out from the object
+func (vm *pooledVM) stringifyTrail() (trail string, err error) {
+	jom, err := vm.Get(globals.JOMVariableName)
+	if err != nil {
+		return "", err
+	}
+	if !jom.IsObject() {
+		return "", errors.New(fmt.Sprintf("\"%s\" is not an object. It is \"%v\".", globals.JOMVariableName, jom))
+	}
+	trailValue, err := jom.Object().Get("trail")
+	if err != nil {
+		return "", err
+	}
+	stringified, err := vm.stringify.Call(otto.UndefinedValue(), trailValue)
+	if err != nil {
+		return "", err
+	}
+	if !stringified.IsString() {
+		return "", errors.New(fmt.Sprintf("\"%s.trail\" is not JSON stringifiable. It is \"%v\".", globals.JOMVariableName, trailValue))
+	}
+	return stringified.String(), nil
+}
+
 // Given a JS environment, retrieve the JOM and generate the json_map.JsonMapInt for the object.
 //
 // Returns the json_map.JsonMapInt of the converted JOM and any errors (if there are any).
-func deJomIfy(jsonMap json_map.JsonMapInt, env *otto.Otto) (data json_map.JsonMapInt, err error) {
+func deJomIfy(code code.Code, jsonMap json_map.JsonMapInt, vm *pooledVM) (data json_map.JsonMapInt, err error) {
 	// TODO this will need to change when the CreateJom function changes. Such as when new helper functions are introduced
 	data = jsonMap.Clone(true)
 
 	// Stringify and return the JOM (as a string)
-	// NOTE JSON.stringify will strip keys that are functions out from the object
-	run, err := env.Run(fmt.Sprintf("JSON.stringify(%s.trail)", globals.JOMVariableName))
+	trail, err := vm.stringifyTrail()
 	if err != nil {
 		return nil, err
 	}
 
+	// Check the size of the JSON string against the budget before it is unmarshalled
+	if err = code.CheckScopeBytes(jsonMap, len(trail)); err != nil {
+		return nil, err
+	}
+
 	// Unmarshal the JSON string to convert it into a map
-	if err := json.Unmarshal([]byte(run.String()), data.GetInsides()); err != nil {
+	if err := json.Unmarshal([]byte(trail), data.GetInsides()); err != nil {
 		return nil, err
 	}
 	return data, nil
@@ -450,45 +671,40 @@ func deJomIfy(jsonMap json_map.JsonMapInt, env *otto.Otto) (data json_map.JsonMa
 //
 // Order of execution
 //
-// • The JOM is created.
+// • A VM, which already has all the other builtins registered, is taken from the pool.
 //
-// • The VM is created.
+// • The JOM is created and passed into the environment, along with the builtins given in code.RunOptions.Builtins.
 //
-// • The builtins and the JOM is passed into the environment.
+// • Interrupt for the halting problem and for the cancellation of the given context is setup.
 //
-// • Interrupt for the halting problem is setup.
+// • The script is compiled (or retrieved from the cache of compiled scripts) and run.
 //
-// • The script is run.
+// • The environment is De-JOM-ified, and any changes to the root and parent (json.root and json.parent) are written
+// back to the document if the script has the "write" attribute.
 //
-// • The environment is De-JOM-ified.
+// • The builtins given in code.RunOptions.Builtins are deleted and the VM is put back into the pool, as long as the script has not left anything behind in it (such as global
+// variables or modified builtins).
 //
 // • The new json_map.JsonMapInt is returned.
-func RunScript(code code.Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error) {
-	toBeCloned = jsonMap
+func RunScript(ctx context.Context, code code.Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error) {
 	script := code.Script.(string)
-	// Create the VM and register all builtins
-	vm := otto.New()
-	// Register all builtins
-	for _, builtin := range builtinFuncs {
-		if err := vm.Set(builtin.name, builtin.function); err != nil {
-			panic(err)
-		}
-	}
+	// Get a VM from the pool and register the JOM for the current scope
+	cached := compiledScripts.get(script)
+	vm := getVM(cached)
+	outer := outerScopes(code, jsonMap)
 	for _, builtin := range builtinVars {
-		var err error
-		switch builtin.name {
-		case globals.JOMVariableName:
-			err = vm.Set(builtin.name, builtin.getter(vm, jsonMap))
-		case "console":
-			err = vm.Set(builtin.name, builtin.getter(vm))
-		default:
-			err = vm.Set(builtin.name, builtin.getter())
-		}
-		// Panic if there was an error
-		if err != nil {
-			panic(err)
+		if builtin.name == globals.JOMVariableName {
+			if err := vm.Set(builtin.name, builtin.getter(vm, jsonMap, outer)); err != nil {
+				panic(err)
+			}
 		}
 	}
+	// Set the builtins given for this evaluation. These are deleted before the VM is put back into the pool so that they
+	// are not visible to other evaluations
+	builtins, err := vm.setBuiltins(code.Options().Builtins)
+	if err != nil {
+		return nil, err
+	}
 
 	// To stop infinite loops start a timer which will panic once the timer stops and be caught in a deferred func
 	start := time.Now()
@@ -504,31 +720,83 @@ func RunScript(code code.Code, jsonMap json_map.JsonMapInt) (data json_map.JsonM
 				)
 				return
 			}
+			// If the context was cancelled then wrap the context's error
+			if caught == globals.Cancelled {
+				err = globals.Cancelled.WrapError(
+					ctx.Err(),
+					duration.String(),
+					fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), script),
+				)
+				return
+			}
 			// Another error that we should panic for
 			panic(caught)
 		}
 	}()
 
-	vm.Interrupt = make(chan func(), 1)
+	// The interrupt channel is only referenced by this run so that an interrupt can never be sent to the VM once it has
+	// been put back into the pool
+	interrupt := make(chan func(), 1)
+	vm.Interrupt = interrupt
 
-	// Start the timer
+	// Start the timer which will interrupt the VM when it fires or when the context is done, whichever is first. The
+	// timer is stopped once the script has finished
+	finished := make(chan struct{})
+	defer close(finished)
 	go func() {
-		time.Sleep(time.Duration(globals.HaltingDelay) * globals.HaltingDelayUnits)
-		vm.Interrupt <- func() {
-			panic(globals.HaltingProblem)
+		timer := time.NewTimer(code.Timeout())
+		defer timer.Stop()
+		select {
+		case <-finished:
+		case <-timer.C:
+			interrupt <- func() {
+				panic(globals.HaltingProblem)
+			}
+		case <-ctx.Done():
+			interrupt <- func() {
+				panic(globals.Cancelled)
+			}
 		}
 	}()
-	// Run the script
-	_, err = vm.Run(script)
+	// Compile the script, if it isn't already cached, and run it
+	if cached == nil {
+		if cached, err = compiledScripts.compile(vm.Otto, script); err != nil {
+			return nil, globals.ScriptError.FillError(err.Error(), fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), script))
+		}
+	}
+	value, err := vm.Run(cached.compiled)
 	if err != nil {
 		// Re-wrap the error as a ScriptError
 		return nil, globals.ScriptError.FillError(err.Error(), fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), script))
 	}
 
 	// De-JOM-ify the environment and return the json_map.JsonMapInt
-	data, err = deJomIfy(jsonMap, vm)
+	data, err = deJomIfy(code, jsonMap, vm)
 	if err != nil {
 		return nil, err
 	}
+
+	// Write any changes made to the root and parent back to the document. The scope returned by the script takes
+	// precedence over any changes made to it through the root or parent
+	for _, scope := range outer {
+		if err = scope.writeBack(vm); err != nil {
+			return nil, globals.ScriptError.FillError(err.Error(), fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), script))
+		}
+	}
+
+	// If the script is an expression then assign the value it evaluated to, to the script's key
+	if code.IsExpression() {
+		var exported interface{}
+		if exported, err = value.Export(); err == nil {
+			err = code.Assign(data, exported)
+		}
+		if err != nil {
+			return nil, globals.ScriptError.FillError(err.Error(), fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), script))
+		}
+	}
+
+	// Only VMs that have run a script successfully are reused
+	vm.deleteGlobals(builtins)
+	putVM(vm, cached)
 	return data, nil
 }
@@ -0,0 +1,424 @@
+package js
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/robertkrimen/otto"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// An object that a script could modify which would then be visible to the next script run in the same VM. These are
+// the global object, every object/function within the global object and their prototypes.
+type builtinObject struct {
+	// The name of the object within the global object. Empty for the global object itself
+	global    string
+	// Whether the object is the prototype of the global
+	prototype bool
+	// The names of the object's own properties when the VM is created
+	names     []string
+}
+
+// The builtin objects within a new VM. These are the same for every new VM so they are only found once, using
+// findBuiltinObjects.
+var (
+	builtinObjects     []builtinObject
+	builtinObjectsOnce sync.Once
+)
+
+// Finds all the builtinObjects and the names of their properties within the given new VM.
+func findBuiltinObjects(vm *pooledVM) {
+	names := func(object *otto.Object) []string {
+		out, err := vm.ownPropertyNames(object)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	}
+
+	global := vm.global()
+	builtinObjects = []builtinObject{{names: names(global)}}
+	for _, name := range builtinObjects[0].names {
+		value, _ := global.Get(name)
+		if !value.IsObject() {
+			continue
+		}
+		builtinObjects = append(builtinObjects, builtinObject{global: name, names: names(value.Object())})
+		if prototype, _ := value.Object().Get("prototype"); prototype.IsObject() {
+			builtinObjects = append(builtinObjects, builtinObject{global: name, prototype: true, names: names(prototype.Object())})
+		}
+	}
+}
+
+// A snapshot of a builtinObject within a pooledVM, taken when the VM is created.
+type objectSnapshot struct {
+	object *otto.Object
+	// The enumerable keys of the object. Builtin properties are not enumerable so these are only the properties set by
+	// RunScript (and scripts)
+	keys   map[string]bool
+	// The values of all the object's own properties
+	values map[string]otto.Value
+}
+
+// Creates a function which returns whether the names of the own properties of each of the given objects, including
+// non-enumerable properties (such as builtin properties and those defined using Object.defineProperty), are the same
+// as when the function was created. Getting the names of every builtin object is too slow to do every time a VM is put
+// back into the pool, so Object.defineProperty and Object.defineProperties are wrapped and the names are only compared
+// if either has been called since the last comparison, as non-enumerable properties cannot be added any other way.
+// The VM's Object.getOwnPropertyNames is given so that it cannot be overridden by scripts.
+const sameNamesFactory = `(function (Object, getOwnPropertyNames, objects) {
+	var defined = false;
+	var wrap = function (name) {
+		var define = Object[name];
+		var wrapped = function () {
+			defined = true;
+			return define.apply(this, arguments);
+		};
+		Object.defineProperty(Object, name, {value: wrapped, writable: true, enumerable: false, configurable: true});
+	};
+	wrap("defineProperty");
+	wrap("defineProperties");
+
+	var names = function (object) {
+		return getOwnPropertyNames(object).join("\u0000");
+	};
+	var expected = [];
+	for (var i = 0; i < objects.length; i++) {
+		expected.push(names(objects[i]));
+	}
+	return function () {
+		if (!defined) {
+			return true;
+		}
+		for (var i = 0; i < objects.length; i++) {
+			if (names(objects[i]) !== expected[i]) {
+				return false;
+			}
+		}
+		defined = false;
+		return true;
+	};
+})`
+
+// An otto VM which has all the builtins that do not depend on the scope (i.e. everything but the JOM) registered. VMs
+// are reused between scripts as long as the script has not left anything behind in the VM.
+type pooledVM struct {
+	*otto.Otto
+	// The VM's JSON.parse function, used by createJom. This is retrieved when the VM is created so that it cannot be
+	// overridden by scripts
+	parse          otto.Value
+	// The VM's JSON.stringify, Object and Object.defineProperty functions, used by outerScope
+	stringify      otto.Value
+	object         otto.Value
+	defineProperty otto.Value
+	// The VM's Object.getOwnPropertyNames function, used to find the builtinObjects
+	getOwnPropertyNames otto.Value
+	// Returns whether any properties have been added to or deleted from the snapshotted objects (see sameNamesFactory)
+	sameNames      otto.Value
+	// A function which deletes the global variable with the given name, used to remove the builtins given in
+	// code.RunOptions.Builtins
+	deleteGlobal   otto.Value
+	snapshots      []objectSnapshot
+	// The customBuiltinsVersion when the VM was created
+	version        int32
+}
+
+// Returns whether the given values are the same. Unlike ==, NaN is the same as NaN.
+func sameValue(a otto.Value, b otto.Value) bool {
+	if a == b {
+		return true
+	}
+	if a.IsNumber() && b.IsNumber() {
+		aFloat, _ := a.ToFloat()
+		bFloat, _ := b.ToFloat()
+		return math.IsNaN(aFloat) && math.IsNaN(bFloat)
+	}
+	return false
+}
+
+// Creates a new pooledVM with all the builtins registered. If snapshot is given then a snapshot of all the
+// builtinObjects is taken so that the VM can be put back into the pool.
+func newPooledVM(snapshot bool) *pooledVM {
+	vm := &pooledVM{Otto: otto.New()}
+	for _, builtin := range builtinFuncs {
+		if err := vm.Set(builtin.name, builtin.function); err != nil {
+			panic(err)
+		}
+	}
+	for _, builtin := range builtinVars {
+		var err error
+		switch builtin.name {
+		case globals.JOMVariableName:
+			// The JOM is set for each script by RunScript
+			err = vm.Set(builtin.name, otto.UndefinedValue())
+		case "console":
+			err = vm.Set(builtin.name, builtin.getter(vm.Otto))
+		default:
+			err = vm.Set(builtin.name, builtin.getter())
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+	var registered map[string]interface{}
+	registered, vm.version = registeredBuiltins()
+	for name, function := range registered {
+		wrapped, err := wrapBuiltin(vm, name, function)
+		if err == nil {
+			err = vm.Set(name, wrapped)
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for _, builtin := range []struct{
+		value *otto.Value
+		name  string
+	}{
+		{&vm.parse, "JSON.parse"},
+		{&vm.stringify, "JSON.stringify"},
+		{&vm.object, "Object"},
+		{&vm.defineProperty, "Object.defineProperty"},
+		{&vm.getOwnPropertyNames, "Object.getOwnPropertyNames"},
+		{&vm.deleteGlobal, "(function (name) { return delete this[name]; })"},
+	} {
+		var err error
+		if *builtin.value, err = vm.Run(builtin.name); err != nil {
+			panic(err)
+		}
+	}
+	if !snapshot {
+		return vm
+	}
+
+	// Wrap Object.defineProperty and Object.defineProperties (see sameNamesFactory) before taking a snapshot of each
+	// builtin object
+	builtinObjectsOnce.Do(func() {
+		findBuiltinObjects(vm)
+	})
+	global := vm.global()
+	objects, err := vm.Object("[]")
+	if err != nil {
+		panic(err)
+	}
+	for _, builtin := range builtinObjects {
+		object := global
+		if builtin.global != "" {
+			value, _ := global.Get(builtin.global)
+			if builtin.prototype {
+				value, _ = value.Object().Get("prototype")
+			}
+			object = value.Object()
+		}
+		if _, err = objects.Call("push", object.Value()); err != nil {
+			panic(err)
+		}
+		vm.snapshots = append(vm.snapshots, objectSnapshot{object: object})
+	}
+	factory, err := vm.Run(sameNamesFactory)
+	if err == nil {
+		vm.sameNames, err = factory.Call(otto.UndefinedValue(), vm.object, vm.getOwnPropertyNames, objects.Value())
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	for i, builtin := range builtinObjects {
+		snapshot := &vm.snapshots[i]
+		snapshot.keys = make(map[string]bool)
+		for _, key := range snapshot.object.Keys() {
+			snapshot.keys[key] = true
+		}
+		snapshot.values = make(map[string]otto.Value, len(builtin.names))
+		for _, name := range builtin.names {
+			snapshot.values[name], _ = snapshot.object.Get(name)
+		}
+	}
+	return vm
+}
+
+// Returns a new empty JS object. This is quicker than running "({})".
+func (vm *pooledVM) newObject() (*otto.Object, error) {
+	object, err := vm.object.Call(otto.UndefinedValue())
+	if err != nil {
+		return nil, err
+	}
+	return object.Object(), nil
+}
+
+// Returns the VM's global object.
+func (vm *pooledVM) global() *otto.Object {
+	global, err := vm.Run("this")
+	if err != nil {
+		panic(err)
+	}
+	return global.Object()
+}
+
+// Returns the names of the given object's own properties, including non-enumerable properties.
+func (vm *pooledVM) ownPropertyNames(object *otto.Object) ([]string, error) {
+	namesArray, err := vm.getOwnPropertyNames.Call(otto.UndefinedValue(), object)
+	if err != nil {
+		return nil, err
+	}
+	values := arrayValues(namesArray.Object())
+	names := make([]string, len(values))
+	for i, value := range values {
+		names[i] = value.String()
+	}
+	return names, nil
+}
+
+// Returns the values within the given JS array.
+func arrayValues(array *otto.Object) []otto.Value {
+	length, _ := array.Get("length")
+	n, _ := length.ToInteger()
+	values := make([]otto.Value, n)
+	for i := range values {
+		values[i], _ = array.Get(strconv.Itoa(i))
+	}
+	return values
+}
+
+// Resets the JOM within the VM then checks whether the VM is the same as when it was created. Only VMs which are clean
+// can be put back into the pool.
+func (vm *pooledVM) clean() bool {
+	if err := vm.Set(globals.JOMVariableName, otto.UndefinedValue()); err != nil {
+		return false
+	}
+	// Any non-enumerable properties that have been added using Object.defineProperty or deleted
+	if same, err := vm.sameNames.Call(otto.UndefinedValue()); err != nil || !same.IsBoolean() {
+		return false
+	} else if same, _ := same.ToBoolean(); !same {
+		return false
+	}
+	for _, snapshot := range vm.snapshots {
+		// Any enumerable properties that have been added (such as global variables) or deleted
+		keys := snapshot.object.Keys()
+		if len(keys) != len(snapshot.keys) {
+			return false
+		}
+		for _, key := range keys {
+			if !snapshot.keys[key] {
+				return false
+			}
+		}
+		// Any properties that have been modified
+		for name, value := range snapshot.values {
+			if current, err := snapshot.object.Get(name); err != nil || !sameValue(current, value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Whether VMs are reused between scripts. Scripts that leave anything behind in their VM, such as global variables
+// (including top-level var and function declarations) or modified builtins, will not have their VM reused.
+var UseVMPool = true
+
+// The pool of VMs that are ready to run a script.
+var vmPool = sync.Pool{
+	New: func() interface{} {
+		return newPooledVM(true)
+	},
+}
+
+// Gets a VM to run the given script in. The VM is taken from the pool, unless the script has previously left its VM
+// dirty (or UseVMPool is false) in which case a VM that will not be put back into the pool is created.
+func getVM(script *cachedScript) *pooledVM {
+	if !UseVMPool || script != nil && atomic.LoadInt32(&script.dirty) == 1 {
+		return newPooledVM(false)
+	}
+	for {
+		// VMs created before a builtin was registered using RegisterBuiltin are discarded
+		if vm := vmPool.Get().(*pooledVM); vm.version == atomic.LoadInt32(&customBuiltinsVersion) {
+			return vm
+		}
+	}
+}
+
+// Puts the given VM back into the pool if it is clean, otherwise the given script is marked as dirty. The VM must not
+// be used afterwards.
+func putVM(vm *pooledVM, script *cachedScript) {
+	vm.Interrupt = nil
+	if !UseVMPool || vm.snapshots == nil {
+		return
+	}
+	if vm.clean() {
+		vmPool.Put(vm)
+	} else if script != nil {
+		atomic.StoreInt32(&script.dirty, 1)
+	}
+}
+
+// The maximum number of compiled scripts that are cached. Scripts are evicted in least recently used order. Scripts
+// are not cached if this is less than 1.
+var ScriptCacheSize = 1024
+
+// A compiled script within the scriptCache.
+type cachedScript struct {
+	hash     [sha256.Size]byte
+	compiled *otto.Script
+	// Set to 1 once the script has left a VM dirty (see putVM)
+	dirty    int32
+}
+
+// A least recently used cache of compiled scripts keyed by the SHA-256 hash of their source. Compiled scripts do not
+// depend on the VM they were compiled in so they can be shared between VMs.
+type scriptCache struct {
+	mutex   sync.Mutex
+	order   *list.List
+	scripts map[[sha256.Size]byte]*list.Element
+}
+
+var compiledScripts = scriptCache{
+	order:   list.New(),
+	scripts: make(map[[sha256.Size]byte]*list.Element),
+}
+
+// Returns the cached compiled script for the given source. Returns nil if the script isn't cached.
+func (cache *scriptCache) get(script string) *cachedScript {
+	hash := sha256.Sum256([]byte(script))
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, ok := cache.scripts[hash]; ok {
+		cache.order.MoveToFront(element)
+		return element.Value.(*cachedScript)
+	}
+	return nil
+}
+
+// Returns the compiled script for the given source, compiling it using the given VM and caching it if it isn't cached.
+func (cache *scriptCache) compile(vm *otto.Otto, script string) (cached *cachedScript, err error) {
+	if cached = cache.get(script); cached != nil {
+		return cached, nil
+	}
+
+	// Compile the script outside the lock so that other scripts are not blocked
+	cached = &cachedScript{hash: sha256.Sum256([]byte(script))}
+	if cached.compiled, err = vm.Compile("", script); err != nil {
+		return nil, err
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if ScriptCacheSize < 1 {
+		return cached, nil
+	}
+	if element, ok := cache.scripts[cached.hash]; ok {
+		// The script has been cached by another goroutine in the meantime
+		return element.Value.(*cachedScript), nil
+	}
+	cache.scripts[cached.hash] = cache.order.PushFront(cached)
+	for cache.order.Len() > ScriptCacheSize {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.scripts, oldest.Value.(*cachedScript).hash)
+	}
+	return cached, nil
+}
@@ -0,0 +1,547 @@
+// Contains runner and getter/setter functions for the execution of Lua scripts within a gopher-lua LState.
+//
+// Follows the rough structure of the js package. The same builtins are exposed to Lua scripts, the only difference
+// being that Lua tables are used in place of JS objects and arrays.
+package lua
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/andygello555/json-dom/code"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom/json_map"
+	glua "github.com/yuin/gopher-lua"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Register this language in the code package.
+func init() {
+	code.RegisterLang("lua", RunScript)
+}
+
+// These can be set when testing to check output.
+var (
+	ExternalConsoleLogStdout io.Writer = os.Stdout
+	ExternalConsoleLogStderr io.Writer = os.Stderr
+)
+
+// The name of the metatables which mark Lua tables as being converted from/to JSON arrays.
+//
+// Lua does not differentiate between arrays and objects, so tables created from a JSON array are given a metatable
+// with this name (see newArray) so that empty arrays stay as arrays when De-JOM-ifying.
+const arrayMetatableName = "json.array"
+
+// Creates a table from the given JSON array. The table is given its own metatable named arrayMetatableName, which
+// holds the length of the array and the index of its last non-null element.
+//
+// JSON nulls are stored as nil, which Lua does not count as part of a table's length. The lengths within the metatable
+// are used to keep trailing nulls when De-JOM-ifying (see arrayLength).
+func newArray(L *glua.LState, values []interface{}) *glua.LTable {
+	table := L.CreateTable(len(values), 0)
+	last := 0
+	for i, v := range values {
+		table.RawSetInt(i + 1, toLua(L, v))
+		if v != nil {
+			last = i + 1
+		}
+	}
+	metatable := L.NewTable()
+	metatable.RawSetString("__name", glua.LString(arrayMetatableName))
+	metatable.RawSetString("length", glua.LNumber(len(values)))
+	metatable.RawSetString("last", glua.LNumber(last))
+	L.SetMetatable(table, metatable)
+	return table
+}
+
+// Returns the length of the given table when it is converted into a []interface{}. This is the table's length in Lua,
+// unless the table was created from a JSON array by newArray which had trailing nulls. In which case, the trailing nulls
+// are kept as long as the script hasn't removed any of the array's other elements.
+func arrayLength(L *glua.LState, table *glua.LTable) int {
+	n := table.MaxN()
+	if metatable, ok := L.GetMetatable(table).(*glua.LTable); ok {
+		length, _ := metatable.RawGetString("length").(glua.LNumber)
+		last, _ := metatable.RawGetString("last").(glua.LNumber)
+		if n >= int(last) && int(length) > n {
+			n = int(length)
+		}
+	}
+	return n
+}
+
+// The name of the metatables which hold the keys of the nulls within tables created from JSON objects (see newObject).
+const objectMetatableName = "json.object"
+
+// Creates a table from the given JSON object. If the object contains any nulls then the table is given its own
+// metatable named objectMetatableName, which holds the keys of the nulls.
+//
+// JSON nulls are stored as nil, which removes the key from the table. The keys within the metatable are used to keep
+// the nulls when De-JOM-ifying (see toGo). As setting a key to nil cannot be told apart from leaving it as null, nulls
+// within objects cannot be removed by scripts.
+func newObject(L *glua.LState, values map[string]interface{}) *glua.LTable {
+	table := L.NewTable()
+	var nulls *glua.LTable
+	for k, v := range values {
+		if v == nil {
+			if nulls == nil {
+				nulls = L.NewTable()
+			}
+			nulls.RawSetString(k, glua.LTrue)
+		}
+		table.RawSetString(k, toLua(L, v))
+	}
+	if nulls != nil {
+		metatable := L.NewTable()
+		metatable.RawSetString("__name", glua.LString(objectMetatableName))
+		metatable.RawSetString("nulls", nulls)
+		L.SetMetatable(table, metatable)
+	}
+	return table
+}
+
+// The libraries which are opened in every LState. Libraries that provide access to the OS, IO or the module loader are
+// left out so that scripts cannot reach outside the JOM.
+var openedLibs = []struct{
+	name     string
+	function glua.LGFunction
+}{
+	{glua.BaseLibName, glua.OpenBase},
+	{glua.TabLibName, glua.OpenTable},
+	{glua.StringLibName, glua.OpenString},
+	{glua.MathLibName, glua.OpenMath},
+	{glua.CoroutineLibName, glua.OpenCoroutine},
+}
+
+// Converts a Go value that has been unmarshalled from JSON into a Lua value.
+func toLua(L *glua.LState, value interface{}) glua.LValue {
+	switch value.(type) {
+	case nil:
+		return glua.LNil
+	case bool:
+		return glua.LBool(value.(bool))
+	case float64:
+		return glua.LNumber(value.(float64))
+	case int:
+		return glua.LNumber(value.(int))
+	case string:
+		return glua.LString(value.(string))
+	case map[string]interface{}:
+		return newObject(L, value.(map[string]interface{}))
+	case []interface{}:
+		return newArray(L, value.([]interface{}))
+	default:
+		// Anything else will be printed as a string
+		return glua.LString(fmt.Sprintf("%v", value))
+	}
+}
+
+// Checks whether the given table should be converted into a []interface{}.
+//
+// A table is an array if it is marked with the array metatable or if it only contains consecutive integer keys
+// starting from 1.
+func isArray(L *glua.LState, table *glua.LTable) bool {
+	if metatable, ok := L.GetMetatable(table).(*glua.LTable); ok && metatable.RawGetString("__name") == glua.LString(arrayMetatableName) {
+		return true
+	}
+	maxN := table.MaxN()
+	if maxN == 0 {
+		return false
+	}
+	keys := 0
+	table.ForEach(func(_ glua.LValue, _ glua.LValue) {
+		keys++
+	})
+	return keys == maxN
+}
+
+// Converts a Lua value into a Go value which can be marshalled into JSON.
+//
+// Functions and other values that cannot be represented within JSON are converted to nil and are skipped when found
+// within a table. This is similar to how JSON.stringify works in the js package.
+func toGo(L *glua.LState, value glua.LValue) (out interface{}) {
+	switch value.Type() {
+	case glua.LTBool:
+		out = bool(value.(glua.LBool))
+	case glua.LTNumber:
+		out = float64(value.(glua.LNumber))
+	case glua.LTString:
+		out = string(value.(glua.LString))
+	case glua.LTTable:
+		table := value.(*glua.LTable)
+		if isArray(L, table) {
+			length := arrayLength(L, table)
+			arr := make([]interface{}, 0, length)
+			for i := 1; i <= length; i++ {
+				arr = append(arr, toGo(L, table.RawGetInt(i)))
+			}
+			out = arr
+		} else {
+			m := make(map[string]interface{})
+			table.ForEach(func(k glua.LValue, v glua.LValue) {
+				switch v.Type() {
+				case glua.LTFunction, glua.LTUserData, glua.LTThread, glua.LTChannel:
+					return
+				}
+				m[k.String()] = toGo(L, v)
+			})
+			// Keep the nulls from the JSON object the table was created from
+			if metatable, ok := L.GetMetatable(table).(*glua.LTable); ok && metatable.RawGetString("__name") == glua.LString(objectMetatableName) {
+				if nulls, ok := metatable.RawGetString("nulls").(*glua.LTable); ok {
+					nulls.ForEach(func(k glua.LValue, _ glua.LValue) {
+						if _, ok := m[k.String()]; !ok {
+							m[k.String()] = nil
+						}
+					})
+				}
+			}
+			out = m
+		}
+	default:
+		out = nil
+	}
+	return out
+}
+
+// Composes a string to print from the arguments on the stack of the given LState.
+func composePrint(L *glua.LState) *strings.Builder {
+	// Print the caller location
+	var out strings.Builder
+	var callLocation string
+
+	jom, ok := L.GetGlobal(globals.JOMVariableName).(*glua.LTable)
+	if !ok {
+		callLocation = "json.scopePath not found"
+	} else {
+		// Check if json.scopePath is not a string (it has been overridden by user)
+		scopePath, ok := jom.RawGetString("scopePath").(glua.LString)
+		if !ok {
+			L.RaiseError("%v", globals.OverriddenBuiltin.FillError("json.scopePath"))
+		}
+		callLocation = fmt.Sprintf("<%s>", string(scopePath))
+	}
+	where := strings.TrimSuffix(strings.TrimSpace(L.Where(1)), ":")
+	_, _ = fmt.Fprintln(&out, "call from:", strings.Replace(where, globals.AnonymousScriptPath, callLocation, -1))
+
+	var b strings.Builder
+	for i := 1; i <= L.GetTop(); i++ {
+		val := toGo(L, L.Get(i))
+		if val == nil {
+			_, _ = fmt.Fprint(&b, "nil")
+		} else {
+			_, _ = fmt.Fprintf(&b, "%v", val)
+		}
+
+		// Add space between args
+		if i < L.GetTop() {
+			_, _ = fmt.Fprint(&b, " ")
+		}
+	}
+
+	// Tabulate all lines that are being output and write them to out
+	for _, line := range strings.Split(b.String(), "\n") {
+		_, _ = fmt.Fprintf(&out, "\t%s\n", line)
+	}
+	return &out
+}
+
+// Given a JSON path will return a "NodeSet" table which contains the absolute paths to all values denoted by the JSON
+// path as well as getter and setter functions.
+//
+// • The JSON path will be parsed into json_map.AbsolutePaths.
+//
+// • json_map.AbsolutePaths will be converted into Lua tables.
+//
+// • The returned table will be constructed (_absolutePaths, getValues, setValues).
+//
+// Both getValues and setValues can be called using either "." or ":".
+func jsonPathSelector(scope json_map.JsonMapInt) glua.LGFunction {
+	return func(L *glua.LState) int {
+		throw := func(message string) {
+			L.RaiseError("JSONPathError: %s", message)
+		}
+
+		// Check number of arguments and argument types
+		if L.GetTop() != 1 || L.Get(1).Type() != glua.LTString {
+			throw("jsonPathSelector takes a single string argument")
+		}
+		jsonPath := L.ToString(1)
+
+		// We set up a function to retrieve the JsonMap so we can retrieve the most up to date version of json.trail
+		getJsonMap := func() json_map.JsonMapInt {
+			jom, ok := L.GetGlobal(globals.JOMVariableName).(*glua.LTable)
+			if !ok {
+				throw(fmt.Sprintf("\"%s\" has been overridden", globals.JOMVariableName))
+			}
+			trail, ok := toGo(L, jom.RawGetString("trail")).(map[string]interface{})
+			if !ok {
+				throw(fmt.Sprintf("\"%s.trail\" is not a table", globals.JOMVariableName))
+			}
+			jMap := scope.Clone(true)
+			*jMap.GetInsides() = trail
+			return jMap
+		}
+
+		// Then we will compile the JSON path, which is cached, and take a copy of its absolute paths
+		compiled, err := json_map.Compile(jsonPath)
+		if err != nil {
+			throw(err.Error())
+		}
+		absolutePaths := compiled.AbsolutePaths()
+
+		var setupKeyObject func(path json_map.AbsolutePathKey) *glua.LTable
+		setupKeyObject = func(path json_map.AbsolutePathKey) *glua.LTable {
+			absolutePathKeyTable := L.NewTable()
+			absolutePathKeyTable.RawSetString("typeId", glua.LNumber(path.KeyType))
+			absolutePathKeyTable.RawSetString("typeName", glua.LString(json_map.AbsolutePathKeyTypeNames[path.KeyType]))
+			switch path.KeyType {
+			case json_map.Slice:
+				// In cases of slices we have to setup a new array
+				sliceArray := L.NewTable()
+				for _, slice := range path.Value.([]json_map.AbsolutePathKey) {
+					sliceArray.Append(setupKeyObject(slice))
+				}
+				absolutePathKeyTable.RawSetString("key", sliceArray)
+			default:
+				absolutePathKeyTable.RawSetString("key", toLua(L, path.Value))
+			}
+			return absolutePathKeyTable
+		}
+
+		// Create a node set table which will store the object we need to return
+		nodeSet := L.NewTable()
+		absoluteValues := L.NewTable()
+		for _, paths := range absolutePaths {
+			currentPath := L.NewTable()
+			for _, path := range paths {
+				currentPath.Append(setupKeyObject(path))
+			}
+			absoluteValues.Append(currentPath)
+		}
+		nodeSet.RawSetString("_absolutePaths", absoluteValues)
+
+		// Removes the NodeSet from the bottom of the stack if the function was called using ":"
+		dropSelf := func(L *glua.LState) {
+			if L.GetTop() > 0 && L.Get(1) == nodeSet {
+				L.Remove(1)
+			}
+		}
+
+		// Set getter and setter funcs
+		nodeSet.RawSetString("getValues", L.NewFunction(func(L *glua.LState) int {
+			dropSelf(L)
+			// Get the most "up to date" json map from json.trail
+			jsonMap := getJsonMap()
+			nodes, errs := jsonMap.GetAbsolutePaths(&absolutePaths)
+			if errs != nil {
+				throw(globals.JsonPathError.FillFromErrors(errs).Error())
+			}
+
+			// Expand the first element if we only have one element and its an array
+			if len(nodes) == 1 {
+				switch nodes[0].Value.(type) {
+				case []interface{}:
+					expandedNodes := make([]*json_map.JsonPathNode, 0)
+					for _, node := range nodes[0].Value.([]interface{}) {
+						expandedNodes = append(expandedNodes, &json_map.JsonPathNode{
+							Absolute: nodes[0].Absolute,
+							Value:    node,
+						})
+					}
+					nodes = expandedNodes
+				}
+			}
+
+			values := make([]interface{}, len(nodes))
+			for i, value := range nodes {
+				values[i] = normalise(value.Value)
+			}
+			L.Push(newArray(L, values))
+			return 1
+		}))
+
+		nodeSet.RawSetString("setValues", L.NewFunction(func(L *glua.LState) int {
+			dropSelf(L)
+			// Get the most "up to date" json map from json.trail
+			jsonMap := getJsonMap()
+			if L.GetTop() != 1 {
+				throw("setValues takes a single argument")
+			}
+
+			// Then we call SetAbsolutePaths
+			// NOTE: Same as in the js package, the absolute paths might be out of date if the user has changed the
+			//       structure of json.trail since creating the NodeSet
+			if err := jsonMap.SetAbsolutePaths(&absolutePaths, toGo(L, L.Get(1))); err != nil {
+				throw(err.Error())
+			}
+
+			// Then we update the current json.trail table with the modified JsonMap
+			jom := L.GetGlobal(globals.JOMVariableName).(*glua.LTable)
+			jom.RawSetString("trail", toLua(L, normalise(*jsonMap.GetInsides())))
+			return 0
+		}))
+
+		L.Push(nodeSet)
+		return 1
+	}
+}
+
+// Normalises the given value by marshalling it into JSON and back again. This makes sure that the value only consists
+// of types that can be converted by toLua.
+func normalise(value interface{}) interface{} {
+	var out interface{}
+	if data, err := json.Marshal(value); err != nil {
+		panic(err)
+	} else if err = json.Unmarshal(data, &out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Construct a list of all the builtins to register when creating the environment.
+var builtinVars = []struct{
+	name   string
+	getter func(L *glua.LState, jsonMap json_map.JsonMapInt) glua.LValue
+}{
+	// Construct the main JOM table
+	{globals.JOMVariableName, func(L *glua.LState, jsonMap json_map.JsonMapInt) glua.LValue {
+		jom := L.NewTable()
+		jom.RawSetString("trail", createJom(L, jsonMap))
+		jom.RawSetString("vars", toLua(L, normalise(jsonMap.Vars())))
+		jom.RawSetString("jsonPathSelector", L.NewFunction(jsonPathSelector(jsonMap)))
+		jom.RawSetString("scopePath", glua.LString(jsonMap.GetCurrentScopePath()))
+		return jom
+	}},
+	{"console", func(L *glua.LState, jsonMap json_map.JsonMapInt) glua.LValue {
+		// Sets up the console table
+		console := L.NewTable()
+		console.RawSetString("log", L.NewFunction(func(L *glua.LState) int {
+			_, _ = fmt.Fprintf(ExternalConsoleLogStdout, "Print %s", composePrint(L))
+			return 0
+		}))
+		console.RawSetString("error", L.NewFunction(func(L *glua.LState) int {
+			// Redirect to stderr
+			_, _ = fmt.Fprintf(ExternalConsoleLogStderr, "Error %s", composePrint(L))
+			return 0
+		}))
+		return console
+	}},
+}
+
+// Create the JOM within the given LState.
+//
+// This will create a Lua table for the scope of the given json map. The JsonMap is first normalised through JSON so that
+// the same values are seen by Lua scripts as by JS scripts.
+func createJom(L *glua.LState, jsonMap json_map.JsonMapInt) glua.LValue {
+	return toLua(L, normalise(*jsonMap.GetInsides()))
+}
+
+// Given a Lua environment, retrieve the JOM and generate the json_map.JsonMapInt for the table.
+//
+// Returns the json_map.JsonMapInt of the converted JOM and any errors (if there are any).
+func deJomIfy(code code.Code, jsonMap json_map.JsonMapInt, L *glua.LState) (data json_map.JsonMapInt, err error) {
+	data = jsonMap.Clone(true)
+
+	jom, ok := L.GetGlobal(globals.JOMVariableName).(*glua.LTable)
+	if !ok {
+		return nil, globals.OverriddenBuiltin.FillError(globals.JOMVariableName)
+	}
+	trail, ok := toGo(L, jom.RawGetString("trail")).(map[string]interface{})
+	if !ok {
+		return nil, globals.OverriddenBuiltin.FillError(fmt.Sprintf("%s.trail", globals.JOMVariableName))
+	}
+	*data.GetInsides() = trail
+
+	// The trail is converted directly from Lua so it has to be marshalled to check its size against the budget
+	if err = code.CheckScopeSize(jsonMap, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Run the given script, with the given json_map.JsonMapInt and return the new json_map.JsonMapInt for the scope.
+//
+// Order of execution
+//
+// • The LState is created and the safe standard libraries are opened.
+//
+// • The builtins and the JOM is passed into the environment.
+//
+// • The context for the halting problem is setup. This is derived from the given context so that the script will also
+// stop once the given context is done.
+//
+// • The script is run.
+//
+// • The environment is De-JOM-ified.
+//
+// • If the script is an expression then the value it evaluated to is assigned to the script's key.
+//
+// • The new json_map.JsonMapInt is returned.
+func RunScript(ctx context.Context, code code.Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error) {
+	script := code.Script.(string)
+	// Create the LState and open the safe libraries
+	L := glua.NewState(glua.Options{SkipOpenLibs: true})
+	defer L.Close()
+	for _, lib := range openedLibs {
+		L.Push(L.NewFunction(lib.function))
+		L.Push(glua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	// Register all builtins
+	for _, builtin := range builtinVars {
+		L.SetGlobal(builtin.name, builtin.getter(L, jsonMap))
+	}
+
+	// To stop infinite loops the LState is given a context which will be cancelled after the halting delay
+	start := time.Now()
+	haltCtx, cancel := context.WithTimeout(ctx, code.Timeout())
+	defer cancel()
+	L.SetContext(haltCtx)
+
+	// Run the script. Expressions are returned from the chunk so that their value can be retrieved from the stack
+	source, nRet := script, glua.MultRet
+	if code.IsExpression() {
+		source, nRet = "return " + script, 1
+	}
+	var fn *glua.LFunction
+	if fn, err = L.Load(strings.NewReader(source), globals.AnonymousScriptPath); err == nil {
+		L.Push(fn)
+		err = L.PCall(0, nRet, nil)
+	}
+	if err != nil {
+		// If the given context is done then evaluation has been cancelled
+		if ctx.Err() != nil {
+			return nil, globals.Cancelled.WrapError(
+				ctx.Err(),
+				time.Since(start).String(),
+				fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), script),
+			)
+		}
+		// If the halting context has finished then we have run into the halting problem
+		if haltCtx.Err() == context.DeadlineExceeded {
+			return nil, globals.HaltingProblem.FillError(
+				time.Since(start).String(),
+				fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), script),
+			)
+		}
+		// Re-wrap the error as a ScriptError
+		return nil, globals.ScriptError.FillError(err.Error(), fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), script))
+	}
+
+	// De-JOM-ify the environment and return the json_map.JsonMapInt
+	data, err = deJomIfy(code, jsonMap, L)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the script is an expression then assign the value it evaluated to, to the script's key
+	if code.IsExpression() {
+		if err = code.Assign(data, toGo(L, L.Get(-1))); err != nil {
+			return nil, globals.ScriptError.FillError(err.Error(), fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), script))
+		}
+	}
+	return data, nil
+}
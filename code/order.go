@@ -0,0 +1,135 @@
+package code
+
+import (
+	"container/heap"
+	"fmt"
+	"github.com/andygello555/json-dom/globals"
+	"sort"
+	"strings"
+)
+
+// A heap of the keys of the scripts which are ready to be run. Keys are dequeued in descending priority then
+// lexicographical order.
+type readyHeap struct {
+	keys    []string
+	scripts map[string]Code
+}
+
+func (h readyHeap) Len() int {
+	return len(h.keys)
+}
+
+func (h readyHeap) Less(i, j int) bool {
+	iPriority, jPriority := h.scripts[h.keys[i]].Attributes.Priority, h.scripts[h.keys[j]].Attributes.Priority
+	if iPriority != jPriority {
+		return iPriority > jPriority
+	}
+	return h.keys[i] < h.keys[j]
+}
+
+func (h readyHeap) Swap(i, j int) {
+	h.keys[i], h.keys[j] = h.keys[j], h.keys[i]
+}
+
+func (h *readyHeap) Push(x interface{}) {
+	h.keys = append(h.keys, x.(string))
+}
+
+func (h *readyHeap) Pop() interface{} {
+	old := h.keys
+	n := len(old)
+	x := old[n - 1]
+	h.keys = old[0 : n - 1]
+	return x
+}
+
+// Returns the keys of the given scripts, which are all on the same level, in the order that they should be run.
+//
+// Scripts are sorted topologically using their "after" attributes (Attributes.After), so that a script is only run once
+// all the scripts it should run after have been run. When more than one script can be run, the script with the highest
+// "priority" attribute (Attributes.Priority) is run first, then scripts are run in lexicographical key order. Therefore,
+// scripts without any attributes are run in lexicographical key order.
+//
+// A globals.ScriptOrderError is returned if a script should run after a key which is not a script on the same level,
+// or if there is a cycle. The given scope path is included within the error.
+func Order(scripts map[string]Code, scopePath string) (order []string, err error) {
+	// The number of scripts each script is waiting on, and the scripts waiting on each script
+	waitingOn := make(map[string]int)
+	waiting := make(map[string][]string)
+	for key, script := range scripts {
+		for _, after := range script.Attributes.After {
+			if _, ok := scripts[after]; !ok {
+				return nil, globals.ScriptOrderError.FillError(
+					scopePath,
+					fmt.Sprintf("script \"%s\" should run after \"%s\" which is not a script in the same scope", key, after),
+				)
+			}
+			waitingOn[key]++
+			waiting[after] = append(waiting[after], key)
+		}
+	}
+
+	ready := &readyHeap{keys: make([]string, 0), scripts: scripts}
+	for key := range scripts {
+		if waitingOn[key] == 0 {
+			ready.keys = append(ready.keys, key)
+		}
+	}
+	heap.Init(ready)
+
+	order = make([]string, 0, len(scripts))
+	for ready.Len() > 0 {
+		key := heap.Pop(ready).(string)
+		order = append(order, key)
+		for _, waiter := range waiting[key] {
+			if waitingOn[waiter]--; waitingOn[waiter] == 0 {
+				heap.Push(ready, waiter)
+			}
+		}
+	}
+
+	// Any scripts that are still waiting are either within a cycle or are waiting on a script within a cycle
+	if len(order) < len(scripts) {
+		cycle := make([]string, 0)
+		for key := range scripts {
+			if waitingOn[key] > 0 {
+				cycle = append(cycle, fmt.Sprintf("\"%s\"", key))
+			}
+		}
+		sort.Strings(cycle)
+		return nil, globals.ScriptOrderError.FillError(
+			scopePath,
+			fmt.Sprintf("there is a cycle between the \"after\" attributes of scripts: %s", strings.Join(cycle, ", ")),
+		)
+	}
+	return order, nil
+}
+
+// Like Order, only the ordered keys are split into the scripts that are run before (pre) and after (post) the subtrees
+// of their scope are evaluated, using RunOptions.PhaseFor.
+//
+// A globals.ScriptOrderError is also returned if a script in the Pre phase should run after a script in the Post phase.
+func OrderPhases(scripts map[string]Code, scopePath string, options RunOptions) (pre []string, post []string, err error) {
+	order, err := Order(scripts, scopePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pre, post = make([]string, 0, len(order)), make([]string, 0)
+	for _, key := range order {
+		if options.PhaseFor(scripts[key]) == Post {
+			post = append(post, key)
+			continue
+		}
+		for _, after := range scripts[key].Attributes.After {
+			if options.PhaseFor(scripts[after]) == Post {
+				return nil, nil, globals.ScriptOrderError.FillError(
+					scopePath,
+					fmt.Sprintf("script \"%s\" runs before the subtrees of its scope so cannot run after \"%s\" which has phase=post", key, after),
+				)
+			}
+		}
+		pre = append(pre, key)
+	}
+	return pre, post, nil
+}
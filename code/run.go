@@ -1,17 +1,23 @@
 package code
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/andygello555/json-dom/jom/json_map"
 	"github.com/andygello555/json-dom/globals"
+	"time"
 )
 
 // Describes a language which is supported (can be run) from within a JOM.
 type SupportedLang struct {
 	// The suffix of the shebang.
 	shebangName string
-	// The function that will run the given script in the given scope.
-	runCode     func(code Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error)
+	// The function that will run the given script in the given scope. The script should stop running and return a
+	// globals.Cancelled error once the given context is done.
+	runCode     func(ctx context.Context, code Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error)
+	// Whether the script's result is assigned to the script's own key instead of the key being deleted once run.
+	valueLang   bool
 }
 
 // All the scripting languages currently supported.
@@ -27,7 +33,7 @@ func CheckIfSupported(scriptLang string) bool {
 
 // Registers a new SupportedLang to the supportedLangs map.
 // Every supported language package should call this within their init().
-func RegisterLang(shebangName string, runCode func(code Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error)) bool {
+func RegisterLang(shebangName string, runCode func(ctx context.Context, code Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error)) bool {
 	supportedLangs[shebangName] = &SupportedLang{
 		shebangName: shebangName,
 		runCode:     runCode,
@@ -35,13 +41,301 @@ func RegisterLang(shebangName string, runCode func(code Code, jsonMap json_map.J
 	return true
 }
 
+// All the scripting languages which can write changes made to the root and parent of their scope back to the
+// document, using the "write" attribute. Keyed by the same shebang suffix as supportedLangs.
+var writeLangs = make(map[string]bool)
+
+// Registers the given script language suffix as one which supports the "write" attribute. Languages which expose the
+// root and parent of the scope to scripts, and can write changes made to them back to the document, should call this
+// within their init(). Scripts in other languages which give the "write" attribute will cause a
+// globals.InvalidAttribute error.
+func RegisterWriteLang(shebangName string) bool {
+	writeLangs[shebangName] = true
+	return true
+}
+
+// Registers a new SupportedLang to the supportedLangs map whose scripts evaluate to a value. Unlike languages
+// registered using RegisterLang, the script's key will not be deleted once the script is run. Instead, runCode should
+// assign the script's result to the script's key (Code.Key) within the returned scope.
+func RegisterValueLang(shebangName string, runCode func(ctx context.Context, code Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error)) bool {
+	supportedLangs[shebangName] = &SupportedLang{
+		shebangName: shebangName,
+		runCode:     runCode,
+		valueLang:   true,
+	}
+	return true
+}
+
+// Whether the given Code's key should be kept once the Code has been run. This is true for Expression mode Code and
+// languages registered using RegisterValueLang.
+func (code *Code) KeepsKey() bool {
+	if code.Mode == Expression {
+		return true
+	}
+	if supportedLang, ok := supportedLangs[code.ScriptLangShebang()]; ok {
+		return supportedLang.valueLang
+	}
+	return false
+}
+
+// Assigns the given value, which is the result of evaluating the given Code in Expression mode, to the Code's key
+// within the given scope.
+//
+// The value is normalised by marshalling it to JSON and back so that only JSON types are stored within the JOM.
+func (code *Code) Assign(scope json_map.JsonMapInt, value interface{}) (err error) {
+	var literal []byte
+	if literal, err = json.Marshal(value); err != nil {
+		return err
+	}
+	var normalised interface{}
+	if err = json.Unmarshal(literal, &normalised); err != nil {
+		return err
+	}
+	(*scope.GetInsides())[code.Key] = normalised
+	return nil
+}
+
+// Options which limit how long scripts can run for and the resources they can use.
+//
+// The zero value uses globals.HaltingDelay as the timeout for each script and places no limit on the total running time
+// or on any resources. Exceeding any of the resource budgets will cause a globals.BudgetExceeded error.
+type RunOptions struct {
+	// The maximum amount of time each script can run for before a globals.HaltingProblem error is returned. Defaults to
+	// globals.HaltingDelay if zero.
+	ScriptTimeout    time.Duration
+	// The ceiling for the timeout that a script can set for itself using the "timeout" attribute in its shebang line.
+	// Defaults to ScriptTimeout if zero, meaning that scripts can only shorten their own timeout.
+	MaxScriptTimeout time.Duration
+	// The maximum amount of time all the scripts within a document can run for before a globals.Cancelled error is
+	// returned. No limit if zero.
+	TotalTimeout     time.Duration
+	// The maximum length of a script's source in bytes. No limit if zero.
+	MaxScriptLength  int
+	// The maximum size in bytes of the scope returned by a script, once it has been marshalled to JSON. No limit if zero.
+	MaxScopeBytes    int
+	// The maximum number of nodes (objects, arrays and values) within the scope returned by a script. No limit if zero.
+	MaxScopeNodes    int
+	// The maximum number of instructions a script can execute. This is only enforced by Starlark (star), as it is the
+	// only interpreter which counts the instructions it executes. It is ignored by every other language (js, es, lua, jq,
+	// tmpl, wasm, gosrc and go), whose scripts are only limited by their timeout. No limit if zero.
+	MaxInstructions  uint64
+	// The maximum number of goroutines used to evaluate independent subtrees of a document concurrently. Scripts on the
+	// same level are still run one after another in order (see Order). Subtrees are evaluated sequentially if this is
+	// less than 2.
+	Parallelism      int
+	// Whether scripts are run before (Pre) or after (Post) the subtrees of their scope are evaluated, unless they set
+	// their own phase using the "phase" attribute in their shebang line. Defaults to Pre.
+	Phase            Phase
+	// Go functions which are exposed to scripts as global functions, keyed by their names. This allows different
+	// evaluations to give their scripts different functions. The arguments and results of each function are converted
+	// between the script's language and Go automatically. Only supported by languages which support custom builtins
+	// (js).
+	Builtins         map[string]interface{}
+	// Whether wasm scripts can be paths to WebAssembly modules on the host, which are read when the script is run. Only
+	// base64 encoded modules can be given if false, as otherwise any document being evaluated could read files on the
+	// host.
+	WasmModulePaths  bool
+	// Variables which every script within the document can read, keyed by their names. This allows the same document to
+	// be evaluated with different inputs. Scripts read them using json.vars (js, es, lua and star), $vars (jq), the vars
+	// function (tmpl) or json_map.JsonMapInt.Vars (Go callbacks and gosrc). The variables must be serialisable to JSON.
+	Vars             map[string]interface{}
+}
+
+// Counts the number of nodes (objects, arrays and values) within the given value. Stops counting once max is
+// exceeded.
+func countNodes(value interface{}, max int) (count int) {
+	count = 1
+	switch value.(type) {
+	case map[string]interface{}:
+		for _, inner := range value.(map[string]interface{}) {
+			if count += countNodes(inner, max - count); count > max {
+				break
+			}
+		}
+	case []interface{}:
+		for _, inner := range value.([]interface{}) {
+			if count += countNodes(inner, max - count); count > max {
+				break
+			}
+		}
+	}
+	return count
+}
+
+// Checks the given size in bytes of the scope returned by the Code, once marshalled to JSON, against the Code's
+// MaxScopeBytes budget. This should be called by each language when De-JOM-ifying, using the size of the marshalled
+// scope before it is unmarshalled, so that oversized scopes are rejected early and the scope is only marshalled once.
+//
+// The given json_map.JsonMapInt is the scope the Code is being run in.
+func (code *Code) CheckScopeBytes(jsonMap json_map.JsonMapInt, size int) error {
+	if max := code.options.MaxScopeBytes; max > 0 && size > max {
+		return globals.BudgetExceeded.FillError(
+			fmt.Sprintf("scope is %d bytes but MaxScopeBytes is %d", size, max),
+			fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), fmt.Sprintf("%v", code.Script)),
+		)
+	}
+	return nil
+}
+
+// Like CheckScopeBytes, only the given data, which is the scope returned by the Code, is marshalled to JSON to find its
+// size. This is for languages which do not marshal the scope when De-JOM-ifying. The data is only marshalled if the
+// Code has a MaxScopeBytes budget, and any values that cannot be serialised (see Omit) are not counted.
+//
+// The given json_map.JsonMapInt is the scope the Code was run in.
+func (code *Code) CheckScopeSize(jsonMap json_map.JsonMapInt, data json_map.JsonMapInt) error {
+	if code.options.MaxScopeBytes <= 0 {
+		return nil
+	}
+	visible := Omit(*data.GetInsides())
+	var insides interface{} = visible
+	if data.IsArray() {
+		insides = visible["array"]
+	}
+	literal, err := json.Marshal(insides)
+	if err != nil {
+		return err
+	}
+	return code.CheckScopeBytes(jsonMap, len(literal))
+}
+
+// Checks the given data, which is the scope returned by the Code, against the Code's MaxScopeNodes budget. If the Code
+// keeps its key (see KeepsKey) then the value assigned to its key is also checked against the MaxScopeBytes budget, as
+// this is assigned after the scope has been De-JOM-ified. The given json_map.JsonMapInt is the scope the Code was run
+// in.
+func (code *Code) CheckScope(jsonMap json_map.JsonMapInt, data json_map.JsonMapInt) error {
+	if code.options.MaxScopeBytes > 0 && code.KeepsKey() {
+		if value, ok := (*data.GetInsides())[code.Key]; ok && IsSerialisable(value) {
+			literal, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			if err = code.CheckScopeBytes(jsonMap, len(literal)); err != nil {
+				return err
+			}
+		}
+	}
+	if max := code.options.MaxScopeNodes; max > 0 {
+		var insides interface{} = *data.GetInsides()
+		if data.IsArray() {
+			insides = (*data.GetInsides())["array"]
+		}
+		if count := countNodes(insides, max); count > max {
+			return globals.BudgetExceeded.FillError(
+				fmt.Sprintf("scope has more nodes than MaxScopeNodes (%d)", max),
+				fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), fmt.Sprintf("%v", code.Script)),
+			)
+		}
+	}
+	return nil
+}
+
+// Resolves the timeout for the given Code using the options and the Code's "timeout" attribute.
+func (options *RunOptions) ScriptTimeoutFor(code Code) time.Duration {
+	timeout := options.ScriptTimeout
+	if timeout == 0 {
+		timeout = time.Duration(globals.HaltingDelay) * globals.HaltingDelayUnits
+	}
+	if code.Attributes.Timeout != 0 {
+		ceiling := options.MaxScriptTimeout
+		if ceiling == 0 {
+			ceiling = timeout
+		}
+		timeout = code.Attributes.Timeout
+		if timeout > ceiling {
+			timeout = ceiling
+		}
+	}
+	return timeout
+}
+
+// Resolves the Phase of the given Code using the options and the Code's "phase" attribute. Never returns DefaultPhase.
+func (options *RunOptions) PhaseFor(code Code) Phase {
+	if code.Attributes.Phase != DefaultPhase {
+		return code.Attributes.Phase
+	}
+	if options.Phase == Post {
+		return Post
+	}
+	return Pre
+}
+
 // Run the given Code in the given Code environment.
 // Returns a json_map.JsonMapInt containing the updated scope, and a non-nil error if an error has occurred, otherwise
 // err will be nil.
 func Run(code Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error) {
+	return RunContext(context.Background(), code, jsonMap)
+}
+
+// Like Run, only the Code will stop running once the given context is done. In which case, a globals.Cancelled error
+// which wraps the context's error will be returned.
+func RunContext(ctx context.Context, code Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error) {
+	return RunWithOptions(ctx, code, jsonMap, RunOptions{})
+}
+
+// Like RunContext, only the Code's timeout (Code.Timeout) is resolved from the given RunOptions and the Code must stay
+// within the budgets given in the RunOptions.
+//
+// The length of the script is checked before it is run. The size of the scope returned by the script is checked by
+// each language when De-JOM-ifying (see CheckScopeBytes), and the number of nodes within it is checked after it is run
+// (see CheckScope).
+func RunWithOptions(ctx context.Context, code Code, jsonMap json_map.JsonMapInt, options RunOptions) (data json_map.JsonMapInt, err error) {
+	code.options = options
 	if supportedLang, ok := supportedLangs[code.ScriptLangShebang()]; ok {
-		return supportedLang.runCode(code, jsonMap)
+		scriptErrorInfo := fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), fmt.Sprintf("%v", code.Script))
+		if err = ctx.Err(); err != nil {
+			return nil, globals.Cancelled.WrapError(err, scriptErrorInfo)
+		}
+		if script, ok := code.Script.(string); ok && options.MaxScriptLength > 0 && len(script) > options.MaxScriptLength {
+			return nil, globals.BudgetExceeded.FillError(fmt.Sprintf("script is %d bytes but MaxScriptLength is %d", len(script), options.MaxScriptLength), scriptErrorInfo)
+		}
+		if code.Attributes.WriteRoot || code.Attributes.WriteParent {
+			if !writeLangs[code.ScriptLangShebang()] {
+				return nil, globals.InvalidAttribute.FillError(fmt.Sprintf("write is not supported by %s scripts", code.ScriptLangShebang()), scriptErrorInfo)
+			}
+			// Scripts cannot write to the scopes of other subtrees when they are evaluated concurrently
+			if options.Parallelism > 1 {
+				return nil, globals.InvalidAttribute.FillError("write cannot be given when Parallelism is greater than 1", scriptErrorInfo)
+			}
+		}
+		// Scripts are given a copy of the scope without any values that cannot be serialised (such as Go callbacks), which
+		// are restored into the scope returned by the script
+		scope, hidden := jsonMap, Hidden{}
+		if code.ScriptLang != GO {
+			var visible map[string]interface{}
+			if visible, hidden = Hide(*jsonMap.GetInsides()); len(hidden) > 0 {
+				scope = jsonMap.Clone(false)
+				*scope.GetInsides() = visible
+			}
+		}
+		if data, err = supportedLang.runCode(ctx, code, scope); err != nil {
+			return nil, err
+		}
+		if err = code.CheckScope(jsonMap, data); err != nil {
+			return nil, err
+		}
+		hidden.Restore(*data.GetInsides())
+		return data, nil
 	}
 	//fmt.Println(supportedLangs)
 	return nil, globals.UnsupportedScriptLang.FillError(code.ScriptLangShebang(), fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), "func(json json_map.JsonMapInt)"))
 }
+
+// All the filter expression evaluators currently supported. Keyed by the same shebang suffix as supportedLangs.
+var filterLangs = make(map[string]func(expression string, currentNode interface{}) (truer bool, err error))
+
+// Registers a new filter expression evaluator to the filterLangs map.
+// Language packages that can evaluate JSON path filter expressions can call this within their init().
+func RegisterFilterLang(shebangName string, runFilter func(expression string, currentNode interface{}) (truer bool, err error)) bool {
+	filterLangs[shebangName] = runFilter
+	return true
+}
+
+// Evaluates the given filter expression against the given current node using the filter evaluator registered under
+// the given shebang suffix.
+// Returns an UnsupportedScriptLang error if there is no filter evaluator registered for the given shebang suffix.
+func RunFilter(shebangName string, expression string, currentNode interface{}) (truer bool, err error) {
+	if runFilter, ok := filterLangs[shebangName]; ok {
+		return runFilter(expression, currentNode)
+	}
+	return false, globals.UnsupportedScriptLang.FillError(shebangName, fmt.Sprintf(globals.ScriptErrorFormatString, globals.AnonymousScriptPath, expression))
+}
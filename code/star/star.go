@@ -0,0 +1,462 @@
+// Contains runner and getter/setter functions for the execution of Starlark scripts within a starlark.Thread.
+//
+// Starlark is a deterministic and hermetic dialect of Python. Scripts have no access to the clock, randomness or any
+// I/O, meaning that evaluating the same JOM will always produce the same output. Follows the rough structure of the js
+// package.
+package star
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/andygello555/json-dom/code"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Register this language in the code package.
+func init() {
+	code.RegisterLang("star", RunScript)
+}
+
+// These can be set when testing to check output.
+var (
+	ExternalConsoleLogStdout io.Writer = os.Stdout
+	ExternalConsoleLogStderr io.Writer = os.Stderr
+)
+
+// The dialect of Starlark that scripts are parsed with. Top-level control flow and while loops are allowed so that
+// scripts can be written in the same way as JS scripts.
+var fileOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+}
+
+// Converts a Go value that has been unmarshalled from JSON into a Starlark value.
+//
+// Whole numbers are converted to starlark.Int so that they can be used with builtins such as range. Keys of maps are
+// inserted in lexicographical order so that iteration order is always the same.
+func toStarlark(value interface{}) starlark.Value {
+	switch value.(type) {
+	case nil:
+		return starlark.None
+	case bool:
+		return starlark.Bool(value.(bool))
+	case float64:
+		f := value.(float64)
+		if f == math.Trunc(f) && math.Abs(f) < 1 << 53 {
+			return starlark.MakeInt64(int64(f))
+		}
+		return starlark.Float(f)
+	case int:
+		return starlark.MakeInt(value.(int))
+	case string:
+		return starlark.String(value.(string))
+	case map[string]interface{}:
+		m := value.(map[string]interface{})
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		dict := starlark.NewDict(len(m))
+		for _, k := range keys {
+			_ = dict.SetKey(starlark.String(k), toStarlark(m[k]))
+		}
+		return dict
+	case []interface{}:
+		arr := value.([]interface{})
+		elems := make([]starlark.Value, len(arr))
+		for i, v := range arr {
+			elems[i] = toStarlark(v)
+		}
+		return starlark.NewList(elems)
+	default:
+		// Anything else will be printed as a string
+		return starlark.String(fmt.Sprintf("%v", value))
+	}
+}
+
+// Converts a Starlark value into a Go value which can be marshalled into JSON.
+//
+// Functions and other values that cannot be represented within JSON are converted to nil and are skipped when found
+// within a dict. This is similar to how JSON.stringify works in the js package.
+func toGo(value starlark.Value) (out interface{}) {
+	switch value.(type) {
+	case starlark.Bool:
+		out = bool(value.(starlark.Bool))
+	case starlark.Int:
+		if i, ok := value.(starlark.Int).Int64(); ok {
+			out = float64(i)
+		} else {
+			out = float64(value.(starlark.Int).Float())
+		}
+	case starlark.Float:
+		out = float64(value.(starlark.Float))
+	case starlark.String:
+		out = string(value.(starlark.String))
+	case *starlark.Dict:
+		m := make(map[string]interface{})
+		for _, item := range value.(*starlark.Dict).Items() {
+			switch item[1].(type) {
+			case starlark.Callable, *starlarkstruct.Struct:
+				continue
+			}
+			if k, ok := item[0].(starlark.String); ok {
+				m[string(k)] = toGo(item[1])
+			} else {
+				m[item[0].String()] = toGo(item[1])
+			}
+		}
+		out = m
+	case starlark.Iterable:
+		// Lists, tuples and sets are all converted to arrays
+		arr := make([]interface{}, 0)
+		iter := value.(starlark.Iterable).Iterate()
+		defer iter.Done()
+		var elem starlark.Value
+		for iter.Next(&elem) {
+			arr = append(arr, toGo(elem))
+		}
+		out = arr
+	default:
+		out = nil
+	}
+	return out
+}
+
+// Normalises the given value by marshalling it into JSON and back again. This makes sure that the value only consists
+// of types that can be converted by toStarlark.
+func normalise(value interface{}) interface{} {
+	var out interface{}
+	if data, err := json.Marshal(value); err != nil {
+		panic(err)
+	} else if err = json.Unmarshal(data, &out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Composes a string to print from the given arguments.
+func composePrint(thread *starlark.Thread, scopePath string, args starlark.Tuple) *strings.Builder {
+	// Print the caller location
+	var out strings.Builder
+	callLocation := thread.CallFrame(1).Pos.String()
+	_, _ = fmt.Fprintln(&out, "call from:", strings.Replace(callLocation, globals.AnonymousScriptPath, fmt.Sprintf("<%s>", scopePath), -1))
+
+	var b strings.Builder
+	for i, arg := range args {
+		if s, ok := arg.(starlark.String); ok {
+			_, _ = fmt.Fprint(&b, string(s))
+		} else {
+			_, _ = fmt.Fprint(&b, arg.String())
+		}
+
+		// Add space between args
+		if i < len(args) - 1 {
+			_, _ = fmt.Fprint(&b, " ")
+		}
+	}
+
+	// Tabulate all lines that are being output and write them to out
+	for _, line := range strings.Split(b.String(), "\n") {
+		_, _ = fmt.Fprintf(&out, "\t%s\n", line)
+	}
+	return &out
+}
+
+// Replaces the contents of the given trail dict with the given map. This keeps the identity of the dict so that any
+// references to json.trail held by the script are still valid.
+func replaceTrail(trail *starlark.Dict, insides map[string]interface{}) error {
+	if err := trail.Clear(); err != nil {
+		return err
+	}
+	for _, item := range toStarlark(normalise(insides)).(*starlark.Dict).Items() {
+		if err := trail.SetKey(item[0], item[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Given a JSON path will return a "NodeSet" struct which contains the absolute paths to all values denoted by the
+// JSON path as well as getter and setter functions.
+//
+// • The JSON path will be parsed into json_map.AbsolutePaths.
+//
+// • json_map.AbsolutePaths will be converted into Starlark values.
+//
+// • The returned struct will be constructed (_absolutePaths, getValues, setValues).
+func jsonPathSelector(scope json_map.JsonMapInt, trail *starlark.Dict) *starlark.Builtin {
+	return starlark.NewBuiltin("jsonPathSelector", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var jsonPath string
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &jsonPath); err != nil {
+			return nil, err
+		}
+
+		// We set up a function to retrieve the JsonMap so we can retrieve the most up to date version of json.trail
+		getJsonMap := func() json_map.JsonMapInt {
+			jMap := scope.Clone(true)
+			*jMap.GetInsides() = toGo(trail).(map[string]interface{})
+			return jMap
+		}
+
+		// Then we will compile the JSON path, which is cached, and take a copy of its absolute paths
+		compiled, err := json_map.Compile(jsonPath)
+		if err != nil {
+			return nil, fmt.Errorf("JSONPathError: %v", err)
+		}
+		absolutePaths := compiled.AbsolutePaths()
+
+		var setupKeyObject func(path json_map.AbsolutePathKey) *starlark.Dict
+		setupKeyObject = func(path json_map.AbsolutePathKey) *starlark.Dict {
+			absolutePathKeyDict := starlark.NewDict(3)
+			_ = absolutePathKeyDict.SetKey(starlark.String("typeId"), starlark.MakeInt(int(path.KeyType)))
+			_ = absolutePathKeyDict.SetKey(starlark.String("typeName"), starlark.String(json_map.AbsolutePathKeyTypeNames[path.KeyType]))
+			switch path.KeyType {
+			case json_map.Slice:
+				// In cases of slices we have to setup a new list
+				sliceList := make([]starlark.Value, 0)
+				for _, slice := range path.Value.([]json_map.AbsolutePathKey) {
+					sliceList = append(sliceList, setupKeyObject(slice))
+				}
+				_ = absolutePathKeyDict.SetKey(starlark.String("key"), starlark.NewList(sliceList))
+			default:
+				_ = absolutePathKeyDict.SetKey(starlark.String("key"), toStarlark(path.Value))
+			}
+			return absolutePathKeyDict
+		}
+
+		absoluteValues := make([]starlark.Value, 0)
+		for _, paths := range absolutePaths {
+			currentPath := make([]starlark.Value, 0)
+			for _, path := range paths {
+				currentPath = append(currentPath, setupKeyObject(path))
+			}
+			absoluteValues = append(absoluteValues, starlark.NewList(currentPath))
+		}
+
+		// Set getter and setter funcs
+		getValues := starlark.NewBuiltin("getValues", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+				return nil, err
+			}
+			// Get the most "up to date" json map from json.trail
+			nodes, errs := getJsonMap().GetAbsolutePaths(&absolutePaths)
+			if errs != nil {
+				return nil, fmt.Errorf("JSONPathError: %v", globals.JsonPathError.FillFromErrors(errs))
+			}
+
+			// Expand the first element if we only have one element and its an array
+			if len(nodes) == 1 {
+				switch nodes[0].Value.(type) {
+				case []interface{}:
+					expandedNodes := make([]*json_map.JsonPathNode, 0)
+					for _, node := range nodes[0].Value.([]interface{}) {
+						expandedNodes = append(expandedNodes, &json_map.JsonPathNode{
+							Absolute: nodes[0].Absolute,
+							Value:    node,
+						})
+					}
+					nodes = expandedNodes
+				}
+			}
+
+			nodeValues := make([]starlark.Value, len(nodes))
+			for i, value := range nodes {
+				nodeValues[i] = toStarlark(normalise(value.Value))
+			}
+			return starlark.NewList(nodeValues), nil
+		})
+
+		setValues := starlark.NewBuiltin("setValues", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var value starlark.Value
+			if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &value); err != nil {
+				return nil, err
+			}
+			// Get the most "up to date" json map from json.trail
+			jsonMap := getJsonMap()
+
+			// Then we call SetAbsolutePaths
+			// NOTE: Same as in the js package, the absolute paths might be out of date if the user has changed the
+			//       structure of json.trail since creating the NodeSet
+			if err := jsonMap.SetAbsolutePaths(&absolutePaths, toGo(value)); err != nil {
+				return nil, fmt.Errorf("JSONPathError: %v", err)
+			}
+
+			// Then we update the current json.trail dict with the modified JsonMap
+			if err := replaceTrail(trail, *jsonMap.GetInsides()); err != nil {
+				return nil, err
+			}
+			return starlark.None, nil
+		})
+
+		return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"_absolutePaths": starlark.NewList(absoluteValues),
+			"getValues":      getValues,
+			"setValues":      setValues,
+		}), nil
+	})
+}
+
+// Create the JOM as a Starlark dict.
+//
+// This will create a dict for the scope of the given json map. The JsonMap is first normalised through JSON so that
+// the same values are seen by Starlark scripts as by JS scripts.
+func createJom(jsonMap json_map.JsonMapInt) *starlark.Dict {
+	return toStarlark(normalise(*jsonMap.GetInsides())).(*starlark.Dict)
+}
+
+// Given the trail dict, generate the json_map.JsonMapInt for the dict.
+//
+// Returns the json_map.JsonMapInt of the converted JOM and any errors (if there are any).
+func deJomIfy(code code.Code, jsonMap json_map.JsonMapInt, trail *starlark.Dict) (data json_map.JsonMapInt, err error) {
+	data = jsonMap.Clone(true)
+	*data.GetInsides() = toGo(trail).(map[string]interface{})
+
+	// The trail is converted directly from Starlark so it has to be marshalled to check its size against the budget
+	if err = code.CheckScopeSize(jsonMap, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Construct the predeclared builtins for the given scope. The trail is passed in separately so that it can be
+// De-JOM-ified after the script has run.
+func builtins(jsonMap json_map.JsonMapInt, trail *starlark.Dict) starlark.StringDict {
+	scopePath := jsonMap.GetCurrentScopePath()
+	return starlark.StringDict{
+		// Construct the main JOM struct
+		globals.JOMVariableName: starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"trail":            trail,
+			"vars":             toStarlark(normalise(jsonMap.Vars())),
+			"jsonPathSelector": jsonPathSelector(jsonMap, trail),
+			"scopePath":        starlark.String(scopePath),
+		}),
+		// Sets up the console struct
+		"console": starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"log": starlark.NewBuiltin("log", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				_, _ = fmt.Fprintf(ExternalConsoleLogStdout, "Print %s", composePrint(thread, scopePath, args))
+				return starlark.None, nil
+			}),
+			"error": starlark.NewBuiltin("error", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				// Redirect to stderr
+				_, _ = fmt.Fprintf(ExternalConsoleLogStderr, "Error %s", composePrint(thread, scopePath, args))
+				return starlark.None, nil
+			}),
+		}),
+	}
+}
+
+// Run the given script, with the given json_map.JsonMapInt and return the new json_map.JsonMapInt for the scope.
+//
+// Order of execution
+//
+// • The JOM is created.
+//
+// • The thread is created and the builtins are predeclared.
+//
+// • The instruction budget (code.RunOptions.MaxInstructions) is set on the thread.
+//
+// • The timer for the halting problem and the cancellation of the given context is setup.
+//
+// • The script is run.
+//
+// • The trail is De-JOM-ified.
+//
+// • If the script is an expression then the value it evaluated to is assigned to the script's key.
+//
+// • The new json_map.JsonMapInt is returned.
+func RunScript(ctx context.Context, code code.Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error) {
+	script := code.Script.(string)
+	trail := createJom(jsonMap)
+	scopePath := jsonMap.GetCurrentScopePath()
+
+	// Create the thread. The builtin print function is redirected to console.log
+	thread := &starlark.Thread{
+		Name: scopePath,
+		Print: func(thread *starlark.Thread, msg string) {
+			_, _ = fmt.Fprintf(ExternalConsoleLogStdout, "Print %s", composePrint(thread, scopePath, starlark.Tuple{starlark.String(msg)}))
+		},
+	}
+
+	// Limit the number of instructions the thread can execute
+	maxInstructions := code.Options().MaxInstructions
+	if maxInstructions > 0 {
+		thread.SetMaxExecutionSteps(maxInstructions)
+	}
+
+	// To stop infinite loops start a timer which will cancel the thread once the timer stops
+	var halted int32
+	start := time.Now()
+	timer := time.AfterFunc(code.Timeout(), func() {
+		atomic.StoreInt32(&halted, 1)
+		thread.Cancel(globals.HaltingProblem.FillError().Error())
+	})
+	defer timer.Stop()
+	// The thread is also cancelled when the context is done
+	stop := context.AfterFunc(ctx, func() {
+		thread.Cancel(globals.Cancelled.FillError().Error())
+	})
+	defer stop()
+
+	// Run the script. Expressions are evaluated using EvalOptions so that their value can be retrieved
+	var value starlark.Value
+	if code.IsExpression() {
+		value, err = starlark.EvalOptions(fileOptions, thread, globals.AnonymousScriptPath, script, builtins(jsonMap, trail))
+	} else {
+		_, err = starlark.ExecFileOptions(fileOptions, thread, globals.AnonymousScriptPath, script, builtins(jsonMap, trail))
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, globals.Cancelled.WrapError(
+				ctx.Err(),
+				time.Since(start).String(),
+				fmt.Sprintf(globals.ScriptErrorFormatString, scopePath, script),
+			)
+		}
+		if atomic.LoadInt32(&halted) == 1 {
+			return nil, globals.HaltingProblem.FillError(
+				time.Since(start).String(),
+				fmt.Sprintf(globals.ScriptErrorFormatString, scopePath, script),
+			)
+		}
+		if maxInstructions > 0 && thread.ExecutionSteps() >= maxInstructions {
+			return nil, globals.BudgetExceeded.FillError(
+				fmt.Sprintf("script executed more than MaxInstructions (%d)", maxInstructions),
+				fmt.Sprintf(globals.ScriptErrorFormatString, scopePath, script),
+			)
+		}
+		// Re-wrap the error as a ScriptError
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			err = fmt.Errorf("%s", evalErr.Backtrace())
+		}
+		return nil, globals.ScriptError.FillError(err.Error(), fmt.Sprintf(globals.ScriptErrorFormatString, scopePath, script))
+	}
+
+	// De-JOM-ify the trail and return the json_map.JsonMapInt
+	data, err = deJomIfy(code, jsonMap, trail)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the script is an expression then assign the value it evaluated to, to the script's key
+	if code.IsExpression() {
+		if err = code.Assign(data, toGo(value)); err != nil {
+			return nil, globals.ScriptError.FillError(err.Error(), fmt.Sprintf(globals.ScriptErrorFormatString, scopePath, script))
+		}
+	}
+	return data, nil
+}
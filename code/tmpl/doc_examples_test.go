@@ -0,0 +1,49 @@
+package tmpl
+
+import (
+	"fmt"
+	"github.com/andygello555/json-dom/jom"
+)
+
+// Templates are rendered against the current scope and the result is assigned to the script's key.
+func Example() {
+	jsonMap := jom.New()
+	err := jsonMap.Unmarshal([]byte(`
+	{
+		first_name: john
+		last_name: smith
+		tags: ["admin", "editor"]
+		display_name:
+			'''#//!tmpl
+			{{upper .first_name}} {{.last_name}} ({{join ", " .tags}})
+			'''
+		url:
+			'''#//!tmpl
+			https://example.com/users/{{lower .last_name}}?nickname={{default "none" .nickname}}
+			'''
+		summary:
+			'''#//!tmpl
+			{{toJson (jsonPath "$.tags[0]")}}
+			'''
+	}
+	`))
+	if err != nil {
+		panic(err)
+	}
+
+	jsonMap.Run()
+	fmt.Println(jsonMap)
+	// Output:
+	// {
+	//   display_name: JOHN smith (admin, editor)
+	//   first_name: john
+	//   last_name: smith
+	//   summary: '''["admin"]'''
+	//   tags:
+	//   [
+	//     admin
+	//     editor
+	//   ]
+	//   url: https://example.com/users/smith?nickname=none
+	// }
+}
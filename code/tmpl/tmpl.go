@@ -0,0 +1,151 @@
+// Contains runner and template functions for rendering text/template scripts.
+//
+// Unlike the other script languages, a template cannot modify its scope. Instead, the template is rendered against the
+// current scope and the result is assigned to the script's own key.
+package tmpl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/andygello555/json-dom/code"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Register this language in the code package.
+func init() {
+	code.RegisterValueLang("tmpl", RunScript)
+}
+
+// Returns true if the given value is the zero value for its type, or nil.
+func empty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.String:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+// Construct the function map for the given scope.
+//
+// • jsonPath: returns a list of the values pointed to by the given JSON path, relative to the current scope.
+//
+// • join: joins the given list of values with the given separator.
+//
+// • vars: returns the variables given to the evaluation of the document (code.RunOptions.Vars).
+//
+// • upper/lower: converts the given string to upper/lower case.
+//
+// • default: returns the given value if it is non-empty, otherwise the given default.
+//
+// • toJson: marshals the given value to JSON.
+func funcMap(jsonMap json_map.JsonMapInt) template.FuncMap {
+	return template.FuncMap{
+		"jsonPath": func(jsonPath string) ([]interface{}, error) {
+			nodes, err := jsonMap.JsonPathSelector(jsonPath)
+			if err != nil {
+				return nil, err
+			}
+			values := make([]interface{}, len(nodes))
+			for i, node := range nodes {
+				values[i] = node.Value
+			}
+			return values, nil
+		},
+		"join": func(sep string, values []interface{}) string {
+			strs := make([]string, len(values))
+			for i, value := range values {
+				strs[i] = fmt.Sprint(value)
+			}
+			return strings.Join(strs, sep)
+		},
+		"vars": jsonMap.Vars,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"default": func(def interface{}, value interface{}) interface{} {
+			if empty(value) {
+				return def
+			}
+			return value
+		},
+		"toJson": func(value interface{}) (string, error) {
+			out, err := json.Marshal(value)
+			return string(out), err
+		},
+	}
+}
+
+// A writer which fails once its context is done. Templates cannot be interrupted, so this stops the execution of a
+// template the next time it writes its output.
+type haltingWriter struct {
+	ctx context.Context
+	strings.Builder
+}
+
+func (w *haltingWriter) Write(p []byte) (n int, err error) {
+	if err = w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.Builder.Write(p)
+}
+
+// Render the given template, with the given json_map.JsonMapInt and return the new json_map.JsonMapInt for the scope.
+//
+// Order of execution
+//
+// • The template is parsed with the function map for the scope. Any errors will be returned as a globals.ScriptError.
+//
+// • The template is executed with the scope as its data (so "{{.name}}" will render the "name" key). Execution is
+// stopped once the script's timeout has elapsed or the given context is done, in which case a globals.HaltingProblem
+// or globals.Cancelled error is returned respectively.
+//
+// • A copy of the scope is returned with the rendered string assigned to the script's key.
+func RunScript(ctx context.Context, code code.Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error) {
+	script := code.Script.(string)
+	scriptErrorInfo := fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), script)
+
+	t, err := template.New(globals.AnonymousScriptPath).Funcs(funcMap(jsonMap)).Parse(script)
+	if err != nil {
+		return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
+	}
+
+	// To stop long running templates, execution is stopped once the context, derived from the given context, has passed
+	// its deadline (see haltingWriter)
+	start := time.Now()
+	haltCtx, cancel := context.WithTimeout(ctx, code.Timeout())
+	defer cancel()
+
+	b := haltingWriter{ctx: haltCtx}
+	err = t.Execute(&b, *jsonMap.GetInsides())
+	// If the given context is done then evaluation has been cancelled
+	if ctx.Err() != nil {
+		return nil, globals.Cancelled.WrapError(ctx.Err(), time.Since(start).String(), scriptErrorInfo)
+	}
+	// If the context's deadline was exceeded then package it up as a HaltingProblem
+	if haltCtx.Err() == context.DeadlineExceeded {
+		return nil, globals.HaltingProblem.FillError(time.Since(start).String(), scriptErrorInfo)
+	}
+	if err != nil {
+		return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
+	}
+
+	// Copy the top level of the scope so that the rendered string can be assigned to the script's key
+	data = jsonMap.Clone(false)
+	insides := make(map[string]interface{})
+	for key, value := range *jsonMap.GetInsides() {
+		insides[key] = value
+	}
+	insides[code.Key] = b.String()
+	*data.GetInsides() = insides
+	return data, nil
+}
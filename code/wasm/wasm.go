@@ -0,0 +1,298 @@
+// Contains runner and host functions for the execution of WebAssembly modules within a wazero.Runtime.
+//
+// Unlike the other script languages, the script following the "#//!wasm" shebang is not source code. It should be a
+// compiled module encoded as base64, or a path to a compiled ".wasm" module if code.RunOptions.WasmModulePaths is set.
+// This allows transformations to be written in any language which compiles to WebAssembly (Rust, TinyGo,
+// AssemblyScript, etc.).
+//
+// Host ABI
+//
+// All host functions are imported from the "json_dom" module. Strings and JSON are passed as (pointer, length) pairs
+// into the guest's exported linear memory. Functions that return data to the guest take an output pointer and a
+// capacity, write at most capacity bytes, and return the total length of the data so that the guest can call again
+// with a larger buffer if needed.
+//  scope_get(out_ptr, out_cap i32) i32                             // Reads the current scope as JSON
+//  scope_set(ptr, len i32)                                         // Replaces the current scope with the given JSON
+//  scope_path(out_ptr, out_cap i32) i32                            // Reads the JSON path to the current scope
+//  path_get(path_ptr, path_len, out_ptr, out_cap i32) i32          // Reads the values pointed to by a JSON path as a JSON array
+//  path_set(path_ptr, path_len, value_ptr, value_len i32)          // Sets the values pointed to by a JSON path to the given JSON (null deletes)
+//  console_log(ptr, len i32)                                       // Prints to stdout
+//  console_error(ptr, len i32)                                     // Prints to stderr
+//  result_set(ptr, len i32)                                        // Sets the value of an expression script (#//!wasm=) to the given JSON
+//
+// When the current scope is an array root, scope_get reads the array itself and scope_set must be given a JSON array.
+//
+// The guest must export its linear memory as "memory" and a function called "run" which takes no parameters and
+// returns nothing. If no "run" function is exported then the WASI "_start" function will be called instead. WASI
+// (wasi_snapshot_preview1) is available to guests but there is no access to the filesystem, environment or clock.
+package wasm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/andygello555/json-dom/code"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Register this language in the code package.
+func init() {
+	code.RegisterLang("wasm", RunScript)
+}
+
+// These can be set when testing to check output.
+var (
+	ExternalConsoleLogStdout io.Writer = os.Stdout
+	ExternalConsoleLogStderr io.Writer = os.Stderr
+)
+
+// The name of the module which all host functions are exported from.
+const HostModuleName = "json_dom"
+
+// The magic number which prefixes all WebAssembly binary modules.
+var wasmMagic = []byte{0x00, 0x61, 0x73, 0x6d}
+
+// Loads the WebAssembly binary referred to by the given script.
+//
+// • If the script is valid base64 which decodes to a WebAssembly binary then the decoded bytes are returned.
+//
+// • Otherwise, if paths is true (code.RunOptions.WasmModulePaths), the script is treated as a path to a ".wasm" file
+// which is read.
+func loadModule(script string, paths bool) ([]byte, error) {
+	script = strings.TrimSpace(script)
+	if decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(script), "")); err == nil && len(decoded) >= len(wasmMagic) && string(decoded[:len(wasmMagic)]) == string(wasmMagic) {
+		return decoded, nil
+	}
+	if !paths {
+		return nil, errors.New("script is not a base64 encoded module (module paths can only be given when WasmModulePaths is set)")
+	}
+
+	binary, err := os.ReadFile(script)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("script is neither a base64 encoded module nor a readable module path: %v", err))
+	}
+	if len(binary) < len(wasmMagic) || string(binary[:len(wasmMagic)]) != string(wasmMagic) {
+		return nil, errors.New(fmt.Sprintf("\"%s\" is not a WebAssembly module", script))
+	}
+	return binary, nil
+}
+
+// Reads the string at the given pointer and length within the given module's memory. Panics if out of range, which will
+// cause the guest to trap.
+func read(m api.Module, ptr, length uint32) []byte {
+	buf, ok := m.Memory().Read(ptr, length)
+	if !ok {
+		panic(errors.New(fmt.Sprintf("memory read out of range: ptr=%d len=%d", ptr, length)))
+	}
+	return buf
+}
+
+// Writes at most outCap bytes of the given data into the given module's memory at outPtr. Returns the total length of
+// the data.
+func write(m api.Module, outPtr, outCap uint32, data []byte) uint32 {
+	n := uint32(len(data))
+	if n > outCap {
+		n = outCap
+	}
+	if n > 0 && !m.Memory().Write(outPtr, data[:n]) {
+		panic(errors.New(fmt.Sprintf("memory write out of range: ptr=%d len=%d", outPtr, n)))
+	}
+	return uint32(len(data))
+}
+
+// Composes a string to print for the console_log and console_error host functions.
+func composePrint(scopePath string, message []byte) *strings.Builder {
+	var out strings.Builder
+	_, _ = fmt.Fprintln(&out, "call from:", fmt.Sprintf("<%s>", scopePath))
+	// Tabulate all lines that are being output and write them to out
+	for _, line := range strings.Split(string(message), "\n") {
+		_, _ = fmt.Fprintf(&out, "\t%s\n", line)
+	}
+	return &out
+}
+
+// Instantiates the host module containing all the functions of the host ABI within the given runtime. All functions
+// read from and write to the given scope. The given code.Code is used to assign the result of expression scripts.
+func instantiateHost(ctx context.Context, r wazero.Runtime, code code.Code, scope json_map.JsonMapInt) error {
+	_, err := r.NewHostModuleBuilder(HostModuleName).
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, outPtr, outCap uint32) uint32 {
+			// Array roots are read as the array itself rather than the object that wraps it
+			var insides interface{} = *scope.GetInsides()
+			if scope.IsArray() {
+				insides = (*scope.GetInsides())["array"]
+			}
+			scopeJson, err := json.Marshal(insides)
+			if err != nil {
+				panic(err)
+			}
+			return write(m, outPtr, outCap, scopeJson)
+		}).Export("scope_get").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, length uint32) {
+			if scope.IsArray() {
+				var array []interface{}
+				if err := json.Unmarshal(read(m, ptr, length), &array); err != nil {
+					panic(errors.New(fmt.Sprintf("scope_set was not given a JSON array when the scope is an array root: %v", err)))
+				}
+				*scope.GetInsides() = map[string]interface{}{"array": array}
+				return
+			}
+			insides := make(map[string]interface{})
+			if err := json.Unmarshal(read(m, ptr, length), &insides); err != nil {
+				panic(errors.New(fmt.Sprintf("scope_set was not given a JSON object: %v", err)))
+			}
+			*scope.GetInsides() = insides
+		}).Export("scope_set").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, outPtr, outCap uint32) uint32 {
+			return write(m, outPtr, outCap, []byte(scope.GetCurrentScopePath()))
+		}).Export("scope_path").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, pathPtr, pathLen, outPtr, outCap uint32) uint32 {
+			nodes, err := scope.JsonPathSelector(string(read(m, pathPtr, pathLen)))
+			if err != nil {
+				panic(err)
+			}
+			values := make([]interface{}, len(nodes))
+			for i, node := range nodes {
+				values[i] = node.Value
+			}
+			valuesJson, err := json.Marshal(values)
+			if err != nil {
+				panic(err)
+			}
+			return write(m, outPtr, outCap, valuesJson)
+		}).Export("path_get").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, pathPtr, pathLen, valuePtr, valueLen uint32) {
+			var value interface{}
+			if err := json.Unmarshal(read(m, valuePtr, valueLen), &value); err != nil {
+				panic(errors.New(fmt.Sprintf("path_set was not given a JSON value: %v", err)))
+			}
+			if err := scope.JsonPathSetter(string(read(m, pathPtr, pathLen)), value); err != nil {
+				panic(err)
+			}
+		}).Export("path_set").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, length uint32) {
+			_, _ = fmt.Fprintf(ExternalConsoleLogStdout, "Print %s", composePrint(scope.GetCurrentScopePath(), read(m, ptr, length)))
+		}).Export("console_log").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, length uint32) {
+			// Redirect to stderr
+			_, _ = fmt.Fprintf(ExternalConsoleLogStderr, "Error %s", composePrint(scope.GetCurrentScopePath(), read(m, ptr, length)))
+		}).Export("console_error").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, length uint32) {
+			if !code.IsExpression() {
+				panic(errors.New(fmt.Sprintf("result_set can only be called when the script is an expression (%s%s)", globals.ShebangPrefix + code.ScriptLangShebang(), globals.ExpressionModeSuffix)))
+			}
+			var value interface{}
+			if err := json.Unmarshal(read(m, ptr, length), &value); err != nil {
+				panic(errors.New(fmt.Sprintf("result_set was not given a JSON value: %v", err)))
+			}
+			if err := code.Assign(scope, value); err != nil {
+				panic(err)
+			}
+		}).Export("result_set").
+		Instantiate(ctx)
+	return err
+}
+
+// Run the given WebAssembly module, with the given json_map.JsonMapInt and return the new json_map.JsonMapInt for the
+// scope.
+//
+// Order of execution
+//
+// • The module is loaded from the script (base64, or a path if code.RunOptions.WasmModulePaths is set).
+//
+// • A runtime which closes once the script's timeout has elapsed, or the given context is done, is created.
+//
+// • WASI and the host module are instantiated.
+//
+// • The guest module is instantiated and its "run" (or "_start") function is called.
+//
+// • The scope, which has been read and written by the guest through the host ABI, is returned.
+func RunScript(ctx context.Context, code code.Code, jsonMap json_map.JsonMapInt) (data json_map.JsonMapInt, err error) {
+	script := code.Script.(string)
+	scriptErrorInfo := fmt.Sprintf(globals.ScriptErrorFormatString, jsonMap.GetCurrentScopePath(), script)
+	binary, err := loadModule(script, code.Options().WasmModulePaths)
+	if err != nil {
+		return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
+	}
+
+	// To stop infinite loops the runtime will be closed once the context's deadline has been exceeded. This context is
+	// derived from the given context so the runtime will also be closed when the given context is done
+	start := time.Now()
+	haltCtx, cancel := context.WithTimeout(ctx, code.Timeout())
+	defer cancel()
+
+	r := wazero.NewRuntimeWithConfig(haltCtx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	defer r.Close(context.Background())
+
+	// The scope is a deep copy so that any changes made before an error occurs are not reflected in the JOM
+	data = jsonMap.Clone(false)
+	insidesJson, err := json.Marshal(jsonMap.GetInsides())
+	if err == nil {
+		*data.GetInsides() = make(map[string]interface{})
+		err = json.Unmarshal(insidesJson, data.GetInsides())
+	}
+	if err != nil {
+		return nil, globals.BuiltinGetterError.FillError("scope", "Could not copy scope", err.Error())
+	}
+	// Expressions evaluate to null unless result_set is called
+	if code.IsExpression() {
+		(*data.GetInsides())[code.Key] = nil
+	}
+	if _, err = wasi_snapshot_preview1.Instantiate(haltCtx, r); err == nil {
+		err = instantiateHost(haltCtx, r, code, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Start functions are disabled so that the run function can be chosen below
+	config := wazero.NewModuleConfig().
+		WithName(globals.AnonymousScriptPath).
+		WithStdout(ExternalConsoleLogStdout).
+		WithStderr(ExternalConsoleLogStderr).
+		WithStartFunctions()
+	mod, err := r.InstantiateWithConfig(haltCtx, binary, config)
+	if err == nil {
+		run := mod.ExportedFunction("run")
+		if run == nil {
+			run = mod.ExportedFunction("_start")
+		}
+		if run == nil {
+			err = errors.New("module does not export a \"run\" or \"_start\" function")
+		} else {
+			_, err = run.Call(haltCtx)
+		}
+	}
+
+	if err != nil {
+		// If the given context is done then evaluation has been cancelled
+		if ctx.Err() != nil {
+			return nil, globals.Cancelled.WrapError(ctx.Err(), time.Since(start).String(), scriptErrorInfo)
+		}
+		// If the context's deadline was exceeded then package it up as a HaltingProblem
+		if haltCtx.Err() == context.DeadlineExceeded {
+			return nil, globals.HaltingProblem.FillError(time.Since(start).String(), scriptErrorInfo)
+		}
+		// WASI guests can exit with a zero exit code
+		if exitErr, ok := err.(*sys.ExitError); !ok || exitErr.ExitCode() != 0 {
+			return nil, globals.ScriptError.FillError(err.Error(), scriptErrorInfo)
+		}
+	}
+
+	// The scope is modified by the host functions as the module runs so it has to be marshalled to check its size
+	// against the budget
+	if err = code.CheckScopeSize(jsonMap, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -7,21 +7,33 @@ const (
 	ShebangPrefix                 = "#//!"
 	ShebangLen                    = len(ShebangPrefix)
 	ShortestSupportedScriptTagLen = 2
-	LongestSupportedScriptTagLen  = 2
+	LongestSupportedScriptTagLen  = 5
 	JOMVariableName               = "json"
+	ExpressionModeSuffix          = "="
+	AttributeDelim                = "="
+	AttributeListDelim            = ","
 	KeyValuePairDelim             = ':'
+	VarDelim                      = "="
 	HaltingDelayUnits             = time.Second
 	ScriptErrorFormatString       = "script <%s>:\n```\n%s\n```"
 	AnonymousScriptPath           = "<anonymous>"
 	CurrentNodeLiteralVarName     = "__currentNodeLiteral__"
 	CurrentNodeValueVarName       = "__currentNode__"
 	ModifiedTrailValueVarName     = "__modifiedTrail__"
+	NativeFilterScriptLang        = "native"
 )
 
 // These are global variables that can be changed.
 var (
 	// The delay time in HaltingDelayUnits after which a running script will panic to stop execution of infinitely executing scripts.
 	HaltingDelay = 4
+	// The language used to evaluate JSON path filter expressions. Defaults to NativeFilterScriptLang, which evaluates
+	// filter expressions without a script interpreter (see json_map.ParseFilter). Set to "js" to use otto instead, which
+	// was the default previously. Filter expressions which use Javascript outside the native syntax (e.g. arithmetic)
+	// fail to parse unless "js" is used.
+	//
+	// Note: any other language must have been registered using code.RegisterFilterLang (e.g. "es").
+	FilterScriptLang = NativeFilterScriptLang
 )
 
 // Returns a map of the descriptions for the subcommands that are used in the CLI application.
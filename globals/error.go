@@ -74,8 +74,36 @@ var (
 	OverriddenBuiltin     = RuntimeError{-4, "The following builtin was overridden"}
 	ScriptError           = RuntimeError{-5, "The following script has caused an error"}
 	JsonPathError		  = RuntimeError{-6, "A JSON path could not be evaluated for the following reason(s)"}
+	Cancelled             = RuntimeError{-7, "Evaluation has been cancelled"}
+	InvalidAttribute      = RuntimeError{-8, "Invalid attribute in shebang"}
+	BudgetExceeded        = RuntimeError{-9, "The following budget has been exceeded"}
+	ScriptOrderError      = RuntimeError{-10, "The scripts in the following scope could not be ordered"}
+	InvalidBuiltin        = RuntimeError{-11, "The following builtin is invalid"}
+	InvalidVars           = RuntimeError{-12, "The following vars are invalid"}
+	JsonPointerError      = RuntimeError{-13, "A JSON pointer could not be evaluated for the following reason(s)"}
 )
 
+// A RuntimeError which wraps an underlying error (e.g. a context.Context's error) so that it can be inspected using
+// errors.Is and errors.As.
+type WrappedRuntimeError struct {
+	// The RuntimeError which has been filled out.
+	RuntimeError
+	// The filled out message.
+	message string
+	// The underlying error.
+	err     error
+}
+
+// Returns the filled out message.
+func (e *WrappedRuntimeError) Error() string {
+	return e.message
+}
+
+// Returns the underlying error.
+func (e *WrappedRuntimeError) Unwrap() error {
+	return e.err
+}
+
 // Fill out a RuntimeError error with the given extra info.
 func (e *RuntimeError) FillError(extraInfo ...string) error {
 	var b strings.Builder
@@ -97,6 +125,16 @@ func (e *RuntimeError) FillError(extraInfo ...string) error {
 	return errors.New(message)
 }
 
+// Fill out a RuntimeError error with the given underlying error followed by the given extra info. Unlike FillError, the
+// returned error is a *WrappedRuntimeError which unwraps to the given error.
+func (e *RuntimeError) WrapError(err error, extraInfo ...string) error {
+	return &WrappedRuntimeError{
+		RuntimeError: *e,
+		message:      e.FillError(append([]string{err.Error()}, extraInfo...)...).Error(),
+		err:          err,
+	}
+}
+
 // Fill out a RuntimeError error with the given list of errors.
 //
 // For all errors with the same code and message the code and message will be removed from that error before being
@@ -1,10 +1,26 @@
 module github.com/andygello555/json-dom
 
-go 1.13
+go 1.25.0
 
 require (
 	github.com/andygello555/gotils v1.2.1
+	github.com/dop251/goja v0.0.0-20260917113740-793a2a65c13b
 	github.com/hjson/hjson-go v3.1.0+incompatible
+	github.com/itchyny/gojq v0.12.19
 	github.com/robertkrimen/otto v0.0.0-20200922221731-ef014fd054ac
+	github.com/tetratelabs/wazero v1.12.0
+	github.com/traefik/yaegi v0.16.1
+	github.com/yuin/gopher-lua v1.1.1
+	go.starlark.net v0.0.0-20260908191801-89a6a09411d5
+)
+
+require (
+	github.com/dlclark/regexp2/v2 v2.5.2 // indirect
+	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
+	github.com/go-test/deep v1.0.7 // indirect
+	github.com/google/pprof v0.0.0-20230207041349-798e818bf904 // indirect
+	github.com/itchyny/timefmt-go v0.1.8 // indirect
+	golang.org/x/sys v0.44.0 // indirect
+	golang.org/x/text v0.3.8 // indirect
 	gopkg.in/sourcemap.v1 v1.0.5 // indirect
 )
@@ -64,6 +64,24 @@ func ExampleEval() {
 	// {"eval":"does this!"}
 }
 
+// Suffixing the shebang with "=" evaluates the script as an expression. The key of the script is kept and set to the
+// value of the expression.
+func ExampleEval_expression() {
+	out, _ := Eval([]byte(`
+	{
+		a: 40
+		b: 2
+		total:
+			'''#//!js=
+			json.trail.a + json.trail.b
+			'''
+	}
+	`), false)
+	fmt.Println(string(out))
+	// Output:
+	// {"a":40,"b":2,"total":42}
+}
+
 // Deleting a key from a JSON map using a JSON path.
 func ExampleJsonMap_MustDelete() {
 	jsonMap := New()
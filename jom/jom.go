@@ -6,6 +6,7 @@ package jom
 
 import (
 	"container/heap"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -33,6 +34,16 @@ type Traversal struct {
 	scopePath *strings.Builder
 	script    map[string]interface{}
 	nonScript map[string]interface{}
+	// The root of the document being evaluated. Nil if the JsonMap is the root or is not being evaluated
+	root      *JsonMap
+	// The scope enclosing the JsonMap's scope. Nil if the JsonMap is the root or is not being evaluated
+	parent    *JsonMap
+	// Joins the JsonMap's insides back into its parent whenever they are replaced
+	join      func(insides map[string]interface{})
+	// The workerPool used to evaluate the document. This also guards the document when it is evaluated in parallel
+	pool      *workerPool
+	// The variables given to the evaluation of the document (RunOptions.Vars)
+	vars      map[string]interface{}
 }
 
 // Creates a new Traversal object (used within JsonMap).
@@ -87,6 +98,7 @@ func (jsonMap *JsonMap) Clone(clear bool) json_map.JsonMapInt {
 		return &JsonMap{
 			insides:   jsonMap.insides,
 			traversal: jsonMap.traversal,
+			Array:     jsonMap.Array,
 		}
 	}
 	cleared := New()
@@ -95,6 +107,149 @@ func (jsonMap *JsonMap) Clone(clear bool) json_map.JsonMapInt {
 	return cleared
 }
 
+// Returns the JsonMap at the root of the document that the JsonMap is being evaluated within. This is the JsonMap
+// itself if it is the root, or if it is not being evaluated.
+//
+// Note: when evaluating in parallel (RunOptions.Parallelism is greater than 1), Go callbacks have exclusive access to
+// the document whilst they run, so they can read the root. However, they must not modify it.
+func (jsonMap *JsonMap) Root() json_map.JsonMapInt {
+	if jsonMap.traversal.root == nil {
+		return jsonMap
+	}
+	return jsonMap.traversal.root
+}
+
+// Returns the JsonMap of the scope enclosing the JsonMap's scope within the document that it is being evaluated within.
+// For objects within arrays this is the scope containing the array. Returns nil if the JsonMap is the root, or if it is
+// not being evaluated.
+//
+// Note: the same restrictions apply as for Root.
+func (jsonMap *JsonMap) Parent() json_map.JsonMapInt {
+	if jsonMap.traversal.parent == nil {
+		return nil
+	}
+	return jsonMap.traversal.parent
+}
+
+// Returns the variables given to the evaluation of the document that the JsonMap is being evaluated within (see
+// RunOptions.Vars). Returns an empty map if no variables were given, or if it is not being evaluated.
+//
+// Note: the variables are shared by all the scopes within the document so they must not be modified.
+func (jsonMap *JsonMap) Vars() map[string]interface{} {
+	if jsonMap.traversal.vars == nil {
+		return map[string]interface{}{}
+	}
+	return jsonMap.traversal.vars
+}
+
+// Like Marshal, only no other scopes within the document that the JsonMap is being evaluated within can modify the
+// document whilst it is being marshalled. This should be used by languages to read the Root and Parent of a scope.
+//
+// Any values that cannot be serialised, such as Go callbacks, are left out (see code.Omit).
+//
+// Note: this should not be called from within Go callbacks, which already have exclusive access to the document.
+func (jsonMap *JsonMap) Snapshot() (out []byte, err error) {
+	defer jsonMap.traversal.pool.readLock()()
+	snapshot := &JsonMap{insides: code.Omit(jsonMap.insides), Array: jsonMap.Array}
+	return snapshot.Marshal()
+}
+
+// Updates the JsonMap in place so that it is equal to the given insides. Objects, and arrays of the same length, which
+// are within both the JsonMap and the given insides are updated in place rather than replaced. Therefore, any scopes
+// which are being evaluated within the JsonMap will see the update.
+//
+// Values which cannot be serialised, such as Go callbacks, are kept unless they are replaced, so that a snapshot of the
+// JsonMap (see Snapshot) can be used to update it.
+//
+// Arrays which contain objects can only be updated in place, as each object may be the scope of a subtree that is being
+// evaluated (see Run), which would otherwise be joined back into an array that is no longer within the JsonMap. If the
+// given insides change the length of such an array (or replace or remove it) then an error is returned and the JsonMap
+// is not updated.
+func (jsonMap *JsonMap) Update(insides map[string]interface{}) (err error) {
+	scopePath := jsonMap.GetCurrentScopePath()
+	if scopePath == "" {
+		scopePath = "$"
+	}
+	if jsonMap.Array {
+		err = checkUpdate(jsonMap.insides["array"], insides["array"], scopePath)
+	} else {
+		err = checkUpdate(jsonMap.insides, insides, scopePath)
+	}
+	if err != nil {
+		return err
+	}
+	jsonMap.insides = update(jsonMap.insides, insides).(map[string]interface{})
+	return nil
+}
+
+// Checks whether the given old value, at the given JSON path, can be updated to the given new value by update. Returns an
+// error if an array which contains objects would not be updated in place.
+func checkUpdate(old interface{}, new interface{}, jsonPath string) error {
+	switch old.(type) {
+	case map[string]interface{}:
+		newMap, ok := new.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for key, value := range old.(map[string]interface{}) {
+			newValue, ok := newMap[key]
+			if !ok && !code.IsSerialisable(value) {
+				continue
+			}
+			if err := checkUpdate(value, newValue, json_map.AppendMember(jsonPath, key)); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		oldArray := old.([]interface{})
+		if newArray, ok := new.([]interface{}); ok && len(newArray) == len(oldArray) {
+			for i, value := range newArray {
+				if err := checkUpdate(oldArray[i], value, fmt.Sprintf("%s[%d]", jsonPath, i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for _, value := range oldArray {
+			if _, ok := value.(map[string]interface{}); ok {
+				return errors.New(fmt.Sprintf("the array at %s contains objects, so it cannot be resized, replaced or removed", jsonPath))
+			}
+		}
+	}
+	return nil
+}
+
+// Updates the given old value so that it is equal to the given new value, updating objects and arrays of the same
+// length in place. Returns the updated value.
+func update(old interface{}, new interface{}) interface{} {
+	switch new.(type) {
+	case map[string]interface{}:
+		if oldMap, ok := old.(map[string]interface{}); ok {
+			newMap := new.(map[string]interface{})
+			for key, value := range oldMap {
+				if _, ok = newMap[key]; !ok && code.IsSerialisable(value) {
+					delete(oldMap, key)
+				}
+			}
+			for key, value := range newMap {
+				oldMap[key] = update(oldMap[key], value)
+			}
+			return oldMap
+		}
+	case []interface{}:
+		if oldArray, ok := old.([]interface{}); ok && len(oldArray) == len(new.([]interface{})) {
+			for i, value := range new.([]interface{}) {
+				if value == nil && !code.IsSerialisable(oldArray[i]) {
+					continue
+				}
+				oldArray[i] = update(oldArray[i], value)
+			}
+			return oldArray
+		}
+	}
+	return new
+}
+
 // Returns the current scopes JSON Path to itself.
 //
 // This just uses the string builder within the traversal field.
@@ -108,12 +263,70 @@ func (jsonMap *JsonMap) GetInsides() *map[string]interface{} {
 	return &jsonMap.insides
 }
 
+// Creates the slice that filterRunner returns the truthy nodes in. If returnIndices is true then this will be a slice of
+// indices (string if mapType is true, otherwise int) rather than a slice of nodes.
+func newTruers(mapType bool, returnIndices bool) interface{} {
+	if !returnIndices {
+		return make([]interface{}, 0)
+	}
+	// If we are returning indices then we will create the array according to whether we are going to return string
+	// keys or numerical indices
+	if mapType {
+		return make([]string, 0)
+	}
+	return make([]int, 0)
+}
+
+// Adds the node/node index to the given truers slice (created by newTruers) and returns the new slice.
+func appendTruer(truers interface{}, nodeIdx interface{}, node interface{}) interface{} {
+	switch truers.(type) {
+	case []interface{}:
+		truers = append(truers.([]interface{}), node)
+	case []string:
+		truers = append(truers.([]string), nodeIdx.(string))
+	case []int:
+		truers = append(truers.([]int), nodeIdx.(int))
+	}
+	return truers
+}
+
+// Evaluates the given JSON path filter expression natively (see json_map.ParseFilter). The expression is parsed once
+// and then evaluated against each node in the given obj with the given json map as the root ($). Takes the same
+// arguments and returns the same values as filterRunner.
+func nativeFilterRunner(obj interface{}, filterExp []byte, jsonMap map[string]interface{}, mapType bool, returnIndices bool) (truers interface{}, err error) {
+	filter, err := json_map.ParseFilter(string(filterExp))
+	if err != nil {
+		return nil, err
+	}
+
+	truers = newTruers(mapType, returnIndices)
+	if mapType {
+		for k, node := range obj.(map[string]interface{}) {
+			if filter.Match(node, jsonMap) {
+				truers = appendTruer(truers, k, node)
+			}
+		}
+	} else {
+		for i, node := range obj.([]interface{}) {
+			if filter.Match(node, jsonMap) {
+				truers = appendTruer(truers, i, node)
+			}
+		}
+	}
+	return truers, nil
+}
+
 // Evaluates the given JSON path filter expression on the given obj on the given json map. Returns a list of values of
-// all nodes which are satisfied by the given filter expression. Filter expressions are evaluated using the otto JS
+// all nodes which are satisfied by the given filter expression. By default, filter expressions are evaluated natively
+// using nativeFilterRunner. If globals.FilterScriptLang is set to "js" then they are evaluated using the otto JS
 // interpreter so (pretty much) any valid javascript can be written within them as long as they return a boolean value.
 // If the returnIndices flag is true then the function will return the slice of indices (string/int) where the true
 // values (as decided by the filter exp) occur.
 func filterRunner(obj interface{}, filterExp []byte, jsonMap map[string]interface{}, mapType bool, returnIndices bool) (truers interface{}, err error) {
+	if globals.FilterScriptLang == globals.NativeFilterScriptLang {
+		return nativeFilterRunner(obj, filterExp, jsonMap, mapType, returnIndices)
+	}
+
 	// For Filters we first have to replace all all @ chars with the current node that has been Marshalled
 	// into JSON then JSON.parse-d. And we have to also replace all the JSON paths with calculated literals
 	stringLiterals := regexp.MustCompile("['\"]([^\\\\\"']|\\\\.)*['\"]")
@@ -220,23 +433,31 @@ func filterRunner(obj interface{}, filterExp []byte, jsonMap map[string]interfac
 	}
 
 	// Set up the truers slice to store all truthy values within the map/arr and setup the VM to run everything inside
-	if !returnIndices {
-		truers = make([]interface{}, 0)
-	} else {
-		// If we are returning indices then we will create the array according to whether we are going to return string
-		// keys or numerical indices
-		if mapType {
-			truers = make([]string, 0)
-		} else {
-			truers = make([]int, 0)
-		}
-	}
+	truers = newTruers(mapType, returnIndices)
 	vm := otto.New()
 
 	// Setup up an anonymous function which will make up our for loop body which iterates over our obj
 	loopBody := func(nodeIdx interface{}, node interface{}) (err error) {
 		// The current expression with all the @s replaced with the literal of the current node
 		currentExpression := string(filterExp)
+
+		// If a filter language other than otto is being used then evaluate the expression using the registered filter
+		// evaluator instead
+		if globals.FilterScriptLang != "js" {
+			if len(currentNodeIndices) != 0 {
+				currentExpression = str.ReplaceCharIndex(currentExpression, currentNodeIndices, globals.CurrentNodeValueVarName)
+			}
+			var truer bool
+			truer, err = code.RunFilter(globals.FilterScriptLang, currentExpression, node)
+			if err != nil {
+				return err
+			}
+			if truer {
+				truers = appendTruer(truers, nodeIdx, node)
+			}
+			return nil
+		}
+
 		if len(currentNodeIndices) != 0 {
 			// Then we want to marshal the current node and replace all occurrences with that unmarshalled literal
 			var literal []byte
@@ -289,13 +510,13 @@ func filterRunner(obj interface{}, filterExp []byte, jsonMap map[string]interfac
 
 			vm.Interrupt = make(chan func(), 1)
 
-			// Start the timer
-			go func() {
-				time.Sleep(1 * globals.HaltingDelayUnits)
+			// Start the timer which is stopped once the expression has been evaluated
+			timer := time.AfterFunc(1 * globals.HaltingDelayUnits, func() {
 				vm.Interrupt <- func() {
 					panic(globals.HaltingProblem)
 				}
-			}()
+			})
+			defer timer.Stop()
 			// NOTE: how we wrap the expression in !!() this is to try to convert to boolean
 			currentExpression = fmt.Sprintf("!!(%s)", currentExpression)
 			expressionReturn, err = vm.Run(currentExpression)
@@ -312,14 +533,7 @@ func filterRunner(obj interface{}, filterExp []byte, jsonMap map[string]interfac
 		//fmt.Println("expression at node", node, "is", currentExpression, "=", truer)
 		// Otherwise add the node to the truers slice if the returned value is true
 		if truer {
-			switch truers.(type) {
-			case []interface{}:
-				truers = append(truers.([]interface{}), node)
-			case []string:
-				truers = append(truers.([]string), nodeIdx.(string))
-			case []int:
-				truers = append(truers.([]int), nodeIdx.(int))
-			}
+			truers = appendTruer(truers, nodeIdx, node)
 		}
 		return nil
 	}
@@ -351,14 +565,41 @@ func filterRunner(obj interface{}, filterExp []byte, jsonMap map[string]interfac
 
 // Run by GetAbsolutePaths in parallel for each absolute path in an json_map.AbsolutePaths array to find the requested values.
 //
-// Each found value is pushed to valChan and each error is pushed to errChan. Once it has complete it calls Done on the wait group.
-func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{}, errChan chan<- error, valChan chan<- json_map.JsonPathNode, wg *sync.WaitGroup) {
+// The nodes found are pushed to valChan, each with the absolute path to the node consisting of only StringKeys and
+// IndexKeys. Each error is pushed to errChan. Once it has complete it calls Done on the wait group.
+func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{}, errChan chan<- error, valChan chan<- []*json_map.JsonPathNode, wg *sync.WaitGroup) {
 	defer wg.Done()
 	var currValue interface{} = jsonMap
 	var err error = nil
 
+	// The absolute paths of the current value. If the current value is an array then these are the absolute paths of
+	// each of its elements, otherwise this contains the absolute path of the current value only
+	currPaths := [][]json_map.AbsolutePathKey{{}}
+
+	// Temp helper function which returns a copy of the given absolute path with a key of the given type appended
+	appendKey := func(absolute []json_map.AbsolutePathKey, keyType json_map.AbsolutePathKeyType, value interface{}) []json_map.AbsolutePathKey {
+		amended := make([]json_map.AbsolutePathKey, len(absolute), len(absolute) + 1)
+		copy(amended, absolute)
+		return append(amended, json_map.AbsolutePathKey{
+			KeyType: keyType,
+			Value:   value,
+		})
+	}
+
+	// Temp helper function which returns the current paths for the given value found at the given absolute path
+	pathsOf := func(value interface{}, absolute []json_map.AbsolutePathKey) [][]json_map.AbsolutePathKey {
+		if arr, ok := value.([]interface{}); ok {
+			paths := make([][]json_map.AbsolutePathKey, len(arr))
+			for i := range arr {
+				paths[i] = appendKey(absolute, json_map.IndexKey, i)
+			}
+			return paths
+		}
+		return [][]json_map.AbsolutePathKey{absolute}
+	}
+
 	// Temp helper function for recursive lookups
-	recursiveLookup := func(key json_map.AbsolutePathKey, arrOrMap interface{}) []interface{} {
+	recursiveLookup := func(key json_map.AbsolutePathKey, arrOrMap interface{}, absolutes [][]json_map.AbsolutePathKey) ([]interface{}, [][]json_map.AbsolutePathKey) {
 		// We'll have to spin up additional finders for every key within this map
 		// Create a wait group which all Sub-Finders will be added to
 		var subWg sync.WaitGroup
@@ -366,10 +607,11 @@ func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{},
 		inFound, outFound := concurrency.InOut()
 		toFind := key.Value.(string)
 		foundValues := make([]interface{}, 0)
+		foundPaths := make([][]json_map.AbsolutePathKey, 0)
 
 		// Set up a temp function for the RecursiveLookup finders
-		var subFinder func(subtree interface{}, subWg *sync.WaitGroup, toFind string, foundlings chan<- interface{})
-		subFinder = func(subtree interface{}, subWg *sync.WaitGroup, toFind string, foundlings chan<- interface{}) {
+		var subFinder func(subtree interface{}, absolute []json_map.AbsolutePathKey, subWg *sync.WaitGroup, toFind string, foundlings chan<- interface{})
+		subFinder = func(subtree interface{}, absolute []json_map.AbsolutePathKey, subWg *sync.WaitGroup, toFind string, foundlings chan<- interface{}) {
 			// Only defer done when a wait group is given
 			if subWg != nil {
 				defer subWg.Done()
@@ -379,19 +621,23 @@ func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{},
 			case map[string]interface{}:
 				subM := subtree.(map[string]interface{})
 				for subSubKey, subSubtree := range subM {
+					subAbsolute := appendKey(absolute, json_map.StringKey, subSubKey)
 					// Recurse into all the keys within the map checking if the key of the current subtree is equal to
 					// the key we are meant to be finding
 					if subSubKey == toFind {
-						// If so we add the subtree to the values channel
-						foundlings <- subSubtree
+						// If so we add the subtree, along with its absolute path, to the values channel
+						foundlings <- json_map.JsonPathNode{
+							Absolute: subAbsolute,
+							Value:    subSubtree,
+						}
 					}
 					// ... we still traverse in order to explore everything
-					subFinder(subSubtree, nil, toFind, foundlings)
+					subFinder(subSubtree, subAbsolute, nil, toFind, foundlings)
 				}
 			case []interface{}:
 				// Since an array doesn't have any keys to search for we will just recurse down
-				for _, subSubtree := range subtree.([]interface{}) {
-					subFinder(subSubtree, nil, toFind, foundlings)
+				for i, subSubtree := range subtree.([]interface{}) {
+					subFinder(subSubtree, appendKey(absolute, json_map.IndexKey, i), nil, toFind, foundlings)
 				}
 			default:
 				// Base case so we'll break and return
@@ -406,14 +652,14 @@ func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{},
 		case map[string]interface{}:
 			m := arrOrMap.(map[string]interface{})
 			subWg.Add(len(m))
-			for _, value := range m {
-				go subFinder(value, &subWg, toFind, inFound)
+			for k, value := range m {
+				go subFinder(value, appendKey(absolutes[0], json_map.StringKey, k), &subWg, toFind, inFound)
 			}
 		case []interface{}:
 			arr := arrOrMap.([]interface{})
 			subWg.Add(len(arr))
-			for _, value := range arr {
-				go subFinder(value, &subWg, toFind, inFound)
+			for i, value := range arr {
+				go subFinder(value, absolutes[i], &subWg, toFind, inFound)
 			}
 		}
 
@@ -421,19 +667,22 @@ func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{},
 		subWg.Wait()
 		close(inFound)
 
-		// Finally we read all the values from the out channel and append them to the foundValues array
+		// Finally we read all the nodes from the out channel and append them to the foundValues and foundPaths arrays
 		for v := range outFound {
+			node := v.(json_map.JsonPathNode)
 			// If the value added was an array then we will "unwrap" it
-			switch v.(type) {
+			switch node.Value.(type) {
 			case []interface{}:
-				for _, av := range v.([]interface{}) {
+				for i, av := range node.Value.([]interface{}) {
 					foundValues = append(foundValues, av)
+					foundPaths = append(foundPaths, appendKey(node.Absolute, json_map.IndexKey, i))
 				}
 			default:
-				foundValues = append(foundValues, v)
+				foundValues = append(foundValues, node.Value)
+				foundPaths = append(foundPaths, node.Absolute)
 			}
 		}
-		return foundValues
+		return foundValues, foundPaths
 	}
 
 
@@ -450,6 +699,7 @@ func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{},
 		case map[string]interface{}:
 			var ok bool
 			m := currValue.(map[string]interface{})
+			absolute := currPaths[0]
 			switch key.KeyType {
 			case json_map.StringKey:
 				if currValue, ok = m[key.Value.(string)]; !ok {
@@ -457,6 +707,7 @@ func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{},
 					err = globals.JsonPathError.FillError(fmt.Sprintf("Key '%v' does not exist in map", key.Value))
 					break
 				}
+				currPaths = pathsOf(currValue, appendKey(absolute, json_map.StringKey, key.Value))
 			case json_map.IndexKey | json_map.Slice:
 				err = globals.JsonPathError.FillError(fmt.Sprintf("Cannot access map %v with numerical key %v", currValue, key.Value))
 				break
@@ -475,17 +726,31 @@ func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{},
 
 				// Add the values of each key to a slice then set that slice to be the current value
 				currValueArr := make([]interface{}, 0)
+				currPaths = make([][]json_map.AbsolutePathKey, 0)
 				for keyQueue.Len() > 0 {
-					currValueArr = append(currValueArr, m[heap.Pop(&keyQueue).(string)])
+					k := heap.Pop(&keyQueue).(string)
+					currValueArr = append(currValueArr, m[k])
+					currPaths = append(currPaths, appendKey(absolute, json_map.StringKey, k))
 				}
 				currValue = currValueArr
 			case json_map.Filter:
-				// Using the filterRunner function we can run the filter on the values of each key in the map
+				// Using the filterRunner function we can find the keys of the map whose values match the filter
 				filterExp := []byte(key.Value.(string))
-				currValue, err = filterRunner(m, filterExp, jsonMap, true, false)
+				var truers interface{}
+				truers, err = filterRunner(m, filterExp, jsonMap, true, true)
 				if err != nil {
 					break
 				}
+				// Sort the keys so that the values are in the same order each time we evaluate this map
+				keys := truers.([]string)
+				sort.Strings(keys)
+				currValueArr := make([]interface{}, len(keys))
+				currPaths = make([][]json_map.AbsolutePathKey, len(keys))
+				for i, k := range keys {
+					currValueArr[i] = m[k]
+					currPaths[i] = appendKey(absolute, json_map.StringKey, k)
+				}
+				currValue = currValueArr
 			case json_map.First:
 				// Similar as with the wildcards we sort the keys alphabetically then set the value of the first, THAT
 				// IS A MAP, as the current value
@@ -506,9 +771,10 @@ func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{},
 				// Otherwise sort the strings and take the value of the first key as the new current value
 				sort.Strings(keys)
 				currValue = m[keys[0]]
+				currPaths = pathsOf(currValue, appendKey(absolute, json_map.StringKey, keys[0]))
 			case json_map.RecursiveLookup:
 				// We set the current value to be all found values
-				currValue = recursiveLookup(key, m)
+				currValue, currPaths = recursiveLookup(key, m, currPaths)
 				break
 			default:
 				err = globals.JsonPathError.FillError(fmt.Sprintf("AbsolutePathKey of type: %v is unrecognised for type \"%s\"", key.KeyType, str.TypeName(currValue)))
@@ -521,17 +787,19 @@ func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{},
 				// When given a string key we will iterate over all elements seeing if we have a map which we can test
 				// if it contains the required StringKey
 				newArr := make([]interface{}, 0)
-				for _, item := range arr {
+				newPaths := make([][]json_map.AbsolutePathKey, 0)
+				for i, item := range arr {
 					switch item.(type) {
 					case map[string]interface{}:
 						if match, ok := item.(map[string]interface{})[key.Value.(string)]; ok {
 							newArr = append(newArr, match)
+							newPaths = append(newPaths, appendKey(currPaths[i], json_map.StringKey, key.Value))
 						}
 					default:
 						continue
 					}
 				}
-				currValue = newArr
+				currValue, currPaths = newArr, newPaths
 			case json_map.IndexKey:
 				i := key.Value.(int)
 				if i >= len(arr) || i < 0 {
@@ -540,16 +808,26 @@ func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{},
 				}
 				//fmt.Println("Getting index:", i, "from", arr, "=", arr[i])
 				currValue = arr[i]
+				currPaths = pathsOf(currValue, currPaths[i])
 			case json_map.Wildcard:
 				// If a wildcard then just set the current value to be equal to the array
 				currValue = arr
 			case json_map.Filter:
-				// Using the filterRunner function we can run the filter on the elements of the array
+				// Using the filterRunner function we can find the indices of the elements which match the filter
 				filterExp := []byte(key.Value.(string))
-				currValue, err = filterRunner(arr, filterExp, jsonMap, false, false)
+				var truers interface{}
+				truers, err = filterRunner(arr, filterExp, jsonMap, false, true)
 				if err != nil {
 					break
 				}
+				indices := truers.([]int)
+				currValueArr := make([]interface{}, len(indices))
+				newPaths := make([][]json_map.AbsolutePathKey, len(indices))
+				for i, idx := range indices {
+					currValueArr[i] = arr[idx]
+					newPaths[i] = currPaths[idx]
+				}
+				currValue, currPaths = currValueArr, newPaths
 			case json_map.First:
 				err = globals.JsonPathError.FillError("Cannot recurse into an array")
 				break
@@ -599,6 +877,7 @@ func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{},
 					// Then set the current value to the slice
 					// NOTE this might panic so we set up a recovery function above so we can re-wrap any slice errors that occur
 					currValue = arr[sliceIndices[0]:sliceIndices[1]]
+					currPaths = currPaths[sliceIndices[0]:sliceIndices[1]]
 				}()
 
 				// Break from the loop if an error has occurred
@@ -607,7 +886,7 @@ func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{},
 				}
 			case json_map.RecursiveLookup:
 				// We set the current value to be all found values from the recursive lookup helper
-				currValue = recursiveLookup(key, arr)
+				currValue, currPaths = recursiveLookup(key, arr, currPaths)
 				break
 			default:
 				err = globals.JsonPathError.FillError(fmt.Sprintf("AbsolutePathKey of type: %v is unrecognised for type \"%s\"", key.KeyType, str.TypeName(currValue)))
@@ -622,20 +901,35 @@ func pathFinder(path []json_map.AbsolutePathKey, jsonMap map[string]interface{},
 	if err != nil {
 		// Push the error to the error channel if one has occurred
 		errChan <- err
-	} else {
-		// Push the value into the value channel
-		valChan <- json_map.JsonPathNode{
-			Absolute: path,
-			Value:    currValue,
+		return
+	}
+
+	// Otherwise push the nodes into the value channel. Any array that was found is unwrapped into a node for each of
+	// its elements
+	nodes := make([]*json_map.JsonPathNode, 0)
+	switch currValue.(type) {
+	case []interface{}:
+		for i, v := range currValue.([]interface{}) {
+			nodes = append(nodes, &json_map.JsonPathNode{
+				Absolute: currPaths[i],
+				Value:    v,
+			})
 		}
+	default:
+		nodes = append(nodes, &json_map.JsonPathNode{
+			Absolute: currPaths[0],
+			Value:    currValue,
+		})
 	}
+	valChan <- nodes
 }
 
 // Given the list of absolute paths for a JsonMap, will return the list of values that said paths lead to.
 //
 // An absolute path is an array of json_map.AbsolutePathKey(s), each of which represent a descent down the JsonMap.
 // Will start a goroutine for each absolute path slice in the given json_map.AbsolutePaths struct meaning that lookup
-// is pretty fast.
+// is pretty fast. The absolute path of each returned node only contains StringKeys and IndexKeys, so it points to the
+// node itself rather than to the path that selected it (and can be formatted using json_map.JsonPointer).
 func (jsonMap *JsonMap) GetAbsolutePaths(absolutePaths *json_map.AbsolutePaths) (values []*json_map.JsonPathNode, errs []error) {
 	// Create a wait group which all Finders will be added to
 	var wg sync.WaitGroup
@@ -644,7 +938,7 @@ func (jsonMap *JsonMap) GetAbsolutePaths(absolutePaths *json_map.AbsolutePaths)
 	// Create a channel of errors which records all the errors that happen within the Finders
 	errsChan := make(chan error, len(*absolutePaths))
 	// Also create a channel for the return values found by the Finders
-	valuesChan := make(chan json_map.JsonPathNode, len(*absolutePaths))
+	valuesChan := make(chan []*json_map.JsonPathNode, len(*absolutePaths))
 
 	// Start the finders
 	wg.Add(len(*absolutePaths))
@@ -668,31 +962,8 @@ func (jsonMap *JsonMap) GetAbsolutePaths(absolutePaths *json_map.AbsolutePaths)
 
 	// Fill out the values array by consuming from the values channel
 	values = make([]*json_map.JsonPathNode, 0)
-	for value := range valuesChan {
-		//fmt.Println("Appending", value)
-		switch value.Value.(type) {
-		case []interface{}:
-			// We unwrap any arrays returned from the finders
-			for i, v := range value.Value.([]interface{}) {
-				// We have to amend the absolute paths for the nodes by adding on an IndexKey at each iteration
-				amendedAbsolute := make([]json_map.AbsolutePathKey, len(value.Absolute) + 1)
-				copy(amendedAbsolute, value.Absolute)
-				amendedAbsolute = append(amendedAbsolute, json_map.AbsolutePathKey{
-					KeyType: json_map.IndexKey,
-					Value:   i,
-				})
-				values = append(values, &json_map.JsonPathNode{
-					Absolute: amendedAbsolute,
-					Value:    v,
-				})
-			}
-		default:
-			// Otherwise we just append normally
-			values = append(values, &json_map.JsonPathNode{
-				Absolute: value.Absolute,
-				Value:    value.Value,
-			})
-		}
+	for nodes := range valuesChan {
+		values = append(values, nodes...)
 	}
 	return values, nil
 }
@@ -1050,17 +1321,20 @@ func (jsonMap *JsonMap) SetAbsolutePaths(absolutePaths *json_map.AbsolutePaths,
 
 // Given a valid JSON path will return the list of pointers to json_map.JsonPathNode(s) that satisfies the JSON path.
 //
-// A wrapper for json_map.ParseJsonPath and GetAbsolutePaths.
+// A wrapper for json_map.Compile and GetAbsolutePaths, so the JSON path is only parsed once (see json_map.CompiledPath).
 // Note: The JSON path syntax is very particular. If a JSON path is not being parsed make sure it looks like the below examples.
 //
 // This function supports the following JSON path syntax:
 //
 // Property selection
 //
-// Selects a property from a map.
+// Selects a property from a map. Properties can contain unicode letters and digits, as well as underscores and hyphens.
 //  .property
-//  // BUT NOT
+// Any other property can be given in single or double quotes within brackets. Quotes and backslashes must be escaped
+// using a backslash. If a comma separated list is given this will select each of the properties.
 //  ['property']
+//  // OR
+//  ["x", 'y', 'z']
 //
 // Element selection
 //
@@ -1110,41 +1384,222 @@ func (jsonMap *JsonMap) SetAbsolutePaths(absolutePaths *json_map.AbsolutePaths,
 // Filter expressions
 //
 // A filter expression will be run against every value within a map and every element in an array. The resulting array
-// it will produce will be all the values on which the filter expression evaluated to true. Any JS expression which can
-// be processed by the Otto interpreter can be run as a filter expression. Therefore the expression must be a boolean
-// expression or one which can be cast to boolean using "!!".
+// it will produce will be all the values on which the filter expression evaluated to true. Filter expressions are
+// evaluated natively (see json_map.ParseFilter for the supported syntax) unless globals.FilterScriptLang is set to a
+// script language, such as "js", in which case any expression which can be cast to boolean using "!!" can be used.
 //  [?(expression)]
 // The current node can be referred to using the '@' character.
 //  $.property[?(@.name)]
 // Any JSON paths used within an expression will also be evaluated from the current scope.
 //  $.property[?($[0].name == @.name)]
 func (jsonMap *JsonMap) JsonPathSelector(jsonPath string) (out []*json_map.JsonPathNode, err error) {
-	out = make([]*json_map.JsonPathNode, 0)
-	paths, err := json_map.ParseJsonPath(jsonPath)
+	path, err := json_map.Compile(jsonPath)
 	if err != nil {
 		return nil, err
 	}
-	values, errs := jsonMap.GetAbsolutePaths(&paths)
+	return path.Select(jsonMap)
+}
 
-	// Handle errors
-	if errs != nil {
-		return nil, globals.JsonPathError.FillFromErrors(errs)
+// Like JsonPathSelector, only the JSON path is parsed and evaluated in strict mode (RFC 9535) using
+// json_map.ParseJsonPathStrict. If the JsonMap is an array at its root then the root of the JSON path is the array.
+//
+// The absolute paths of the returned nodes are relative to the root of the JSON path, so they can be formatted using
+// json_map.NormalizedPath.
+func (jsonMap *JsonMap) JsonPathSelectorStrict(jsonPath string) (out []*json_map.JsonPathNode, err error) {
+	path, err := json_map.ParseJsonPathStrict(jsonPath)
+	if err != nil {
+		return nil, err
 	}
-	return values, nil
+	var root interface{} = jsonMap.insides
+	if jsonMap.Array {
+		root = jsonMap.insides["array"]
+	}
+	return path.Select(root), nil
 }
 
 // Given a valid JSON path: will set the values pointed to by the JSON path to be the value given.
 //
 // If nil is given as the value then the pointed to elements will be deleted.
-// A wrapper for json_map.ParseJsonPath -> SetAbsolutePaths.
+// A wrapper for json_map.Compile -> SetAbsolutePaths, so the JSON path is only parsed once (see json_map.CompiledPath).
 func (jsonMap *JsonMap) JsonPathSetter(jsonPath string, value interface{}) (err error) {
-	var paths json_map.AbsolutePaths
-	paths, err = json_map.ParseJsonPath(jsonPath)
+	path, err := json_map.Compile(jsonPath)
 	if err != nil {
 		return err
 	}
-	err = jsonMap.SetAbsolutePaths(&paths, value)
-	return err
+	return path.Set(jsonMap, value)
+}
+
+// Returns the value pointed to by the given JSON pointer (RFC 6901), such as "/people/0/name". If the JsonMap is an
+// array at its root then the root of the JSON pointer is the array.
+//
+// Returns a globals.JsonPointerError if the JSON pointer is invalid or does not point to a value.
+func (jsonMap *JsonMap) PointerGet(pointer string) (value interface{}, err error) {
+	path, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	value = jsonMap.pointerRoot()
+	for _, key := range path {
+		if value, err = pointerChild(value, key, pointer); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// Sets the value pointed to by the given JSON pointer (RFC 6901) to the given value. Unlike JsonPathSetter, a nil value
+// sets the value to null rather than deleting it (see PointerDelete).
+//
+// The object or array containing the value must exist. Members that don't exist are added to objects, and values are
+// appended to arrays when the last reference token is "-" (json_map.PointerEnd) or the length of the array. The empty
+// JSON pointer ("") replaces the entire JsonMap with the given object or array.
+func (jsonMap *JsonMap) PointerSet(pointer string, value interface{}) (err error) {
+	return jsonMap.pointerSet(pointer, value, false)
+}
+
+// Deletes the value pointed to by the given JSON pointer (RFC 6901). Elements after a deleted array element are
+// shifted down.
+//
+// Returns a globals.JsonPointerError if the JSON pointer is invalid, does not point to a value or is the root.
+func (jsonMap *JsonMap) PointerDelete(pointer string) (err error) {
+	return jsonMap.pointerSet(pointer, nil, true)
+}
+
+// Parses the given JSON pointer and returns its only absolute path.
+func parsePointer(pointer string) (path []json_map.AbsolutePathKey, err error) {
+	paths, err := json_map.ParseJsonPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	return paths[0], nil
+}
+
+// Returns the value that JSON pointers are evaluated from. This is the array if the JsonMap is an array at its root.
+func (jsonMap *JsonMap) pointerRoot() interface{} {
+	if jsonMap.Array {
+		return jsonMap.insides["array"]
+	}
+	return jsonMap.insides
+}
+
+// Returns the member name that the given key, parsed from a JSON pointer, refers to within an object.
+func pointerMember(key json_map.AbsolutePathKey) string {
+	if key.KeyType == json_map.IndexKey {
+		return fmt.Sprint(key.Value)
+	}
+	return key.Value.(string)
+}
+
+// Returns the index that the given key, parsed from a JSON pointer, refers to within the given array. If end is true
+// then the index can also be the length of the array, which "-" (json_map.PointerEnd) refers to.
+func pointerIndex(array []interface{}, key json_map.AbsolutePathKey, end bool, pointer string) (index int, err error) {
+	switch {
+	case key.KeyType == json_map.IndexKey && (key.Value.(int) < len(array) || end && key.Value.(int) == len(array)):
+		return key.Value.(int), nil
+	case end && key.Value == json_map.PointerEnd:
+		return len(array), nil
+	case key.KeyType == json_map.IndexKey || key.Value == json_map.PointerEnd:
+		return 0, globals.JsonPointerError.FillError(fmt.Sprintf("Index %v is out of range for array of length %d in \"%s\"", key.Value, len(array), pointer))
+	default:
+		return 0, globals.JsonPointerError.FillError(fmt.Sprintf("\"%v\" is not an array index in \"%s\"", key.Value, pointer))
+	}
+}
+
+// Returns the child of the given object or array that the given key, parsed from the given JSON pointer, refers to.
+func pointerChild(value interface{}, key json_map.AbsolutePathKey, pointer string) (child interface{}, err error) {
+	switch value.(type) {
+	case map[string]interface{}:
+		var ok bool
+		if child, ok = value.(map[string]interface{})[pointerMember(key)]; !ok {
+			return nil, globals.JsonPointerError.FillError(fmt.Sprintf("Member \"%s\" does not exist in \"%s\"", pointerMember(key), pointer))
+		}
+		return child, nil
+	case []interface{}:
+		index, err := pointerIndex(value.([]interface{}), key, false, pointer)
+		if err != nil {
+			return nil, err
+		}
+		return value.([]interface{})[index], nil
+	default:
+		return nil, globals.JsonPointerError.FillError(fmt.Sprintf("Cannot descend into value of type \"%s\" in \"%s\"", str.TypeName(value), pointer))
+	}
+}
+
+// Sets or deletes (if remove is true) the value pointed to by the given JSON pointer.
+func (jsonMap *JsonMap) pointerSet(pointer string, value interface{}, remove bool) (err error) {
+	path, err := parsePointer(pointer)
+	if err != nil {
+		return err
+	}
+
+	// The root is replaced entirely
+	if len(path) == 0 {
+		if remove {
+			return globals.JsonPointerError.FillError("Cannot delete the root")
+		}
+		switch value.(type) {
+		case map[string]interface{}:
+			jsonMap.insides, jsonMap.Array = value.(map[string]interface{}), false
+		case []interface{}:
+			jsonMap.insides, jsonMap.Array = map[string]interface{}{"array": value}, true
+		default:
+			return globals.JsonPointerError.FillError(fmt.Sprintf("Cannot set the root to value of type \"%s\"", str.TypeName(value)))
+		}
+		return nil
+	}
+
+	// Find the object or array containing the value, as well as its own container so that arrays can be replaced when
+	// they change length
+	var container, grandparent interface{} = jsonMap.pointerRoot(), nil
+	var containerKey json_map.AbsolutePathKey
+	if jsonMap.Array {
+		grandparent, containerKey = jsonMap.insides, json_map.AbsolutePathKey{KeyType: json_map.StringKey, Value: "array"}
+	}
+	for _, key := range path[:len(path) - 1] {
+		grandparent, containerKey = container, key
+		if container, err = pointerChild(container, key, pointer); err != nil {
+			return err
+		}
+	}
+
+	key := path[len(path) - 1]
+	switch container.(type) {
+	case map[string]interface{}:
+		m := container.(map[string]interface{})
+		if remove {
+			if _, ok := m[pointerMember(key)]; !ok {
+				return globals.JsonPointerError.FillError(fmt.Sprintf("Member \"%s\" does not exist in \"%s\"", pointerMember(key), pointer))
+			}
+			delete(m, pointerMember(key))
+		} else {
+			m[pointerMember(key)] = value
+		}
+	case []interface{}:
+		arr := container.([]interface{})
+		index, err := pointerIndex(arr, key, !remove, pointer)
+		if err != nil {
+			return err
+		}
+		switch {
+		case remove:
+			arr = append(arr[:index:index], arr[index + 1:]...)
+		case index == len(arr):
+			arr = append(arr, value)
+		default:
+			arr[index] = value
+			return nil
+		}
+		// The array has changed length so it is replaced within its container
+		switch grandparent.(type) {
+		case map[string]interface{}:
+			grandparent.(map[string]interface{})[pointerMember(containerKey)] = arr
+		case []interface{}:
+			grandparent.([]interface{})[containerKey.Value.(int)] = arr
+		}
+	default:
+		return globals.JsonPointerError.FillError(fmt.Sprintf("Cannot set a value within value of type \"%s\" in \"%s\"", str.TypeName(container), pointer))
+	}
+	return nil
 }
 
 // Adds the given script of the given shebangName (must be a supported language) at the path pointed to by the given
@@ -1219,11 +1674,14 @@ func (jsonMap *JsonMap) FindScriptFields() (found bool) {
 			}
 			// Always join nonScriptArrayInner back into the main tree (nonScriptFields)
 			jsonMap.traversal.nonScript[key] = nonScriptArrayInner
-		case func(json json_map.JsonMapInt), string:
+		case func(json json_map.JsonMapInt), func(json json_map.JsonMapInt) interface{},
+			func(ctx context.Context, json json_map.JsonMapInt) error,
+			func(ctx context.Context, json json_map.JsonMapInt) (interface{}, error), string:
 			// Check if the element contains a script
 			if runnable, ok := code.NewFrom(element); ok {
 				// If it is then add the key to the script map as a Code object and set found to true
 				found = true
+				runnable.Key = key
 				jsonMap.traversal.script[key] = runnable
 			} else {
 				// Add the field to the nonScriptFields map
@@ -1253,13 +1711,187 @@ func (jsonMap *JsonMap) Strip() {
 //
 // • All scripts will be run and removed from the JsonMap.
 //
-// • In cases where there are more than one script tag on a level: scripts will be evaluated in lexicographical script-key order.
+// • In cases where there are more than one script tag on a level: scripts will be evaluated in lexicographical script-key order,
+// unless their order is given using the "after" and "priority" shebang attributes (see code.Order).
+//
+// • Scripts are run before the nested objects within their scope are evaluated, unless they are given the "phase=post"
+// shebang attribute (or RunOptions.Phase is code.Post) in which case they are run afterwards.
 func (jsonMap *JsonMap) Run() {
+	jsonMap.RunContext(context.Background())
+}
+
+// Like Run, only all scripts will stop running once the given context is done.
+//
+// The context is checked before each script is run and is passed to the script's language so that a running script can
+// be interrupted. If the context is done then RunContext will panic with a globals.Cancelled error which wraps the
+// context's error (so errors.Is(err, context.Canceled) and errors.Is(err, context.DeadlineExceeded) can be used).
+func (jsonMap *JsonMap) RunContext(ctx context.Context) {
+	jsonMap.RunWithOptions(ctx, RunOptions{})
+}
+
+// Options which limit how long scripts can run for. See code.RunOptions.
+type RunOptions = code.RunOptions
+
+// Bounds the number of subtrees of a JsonMap that are evaluated concurrently when RunOptions.Parallelism is greater
+// than 1.
+//
+// The first panic that occurs within any subtree is recorded and the evaluation of all the other subtrees is cancelled.
+// A nil *workerPool evaluates all subtrees sequentially.
+//
+// The workerPool also guards the document being evaluated, so that scopes can read the root and parent of their scope
+// (see JsonMap.Snapshot) whilst other subtrees are being evaluated.
+type workerPool struct {
+	// Holds a token for each running worker goroutine
+	tokens   chan struct{}
+	// Cancels the context passed to all subtrees
+	cancel   context.CancelFunc
+	mutex    sync.Mutex
+	caught   interface{}
+	// Must be held for writing when modifying any part of the document which could be read by another subtree
+	document sync.RWMutex
+}
+
+// Creates a new workerPool which will run at most parallelism subtrees at once (including the calling goroutine).
+// Returns nil if parallelism is less than 2.
+func newWorkerPool(parallelism int, cancel context.CancelFunc) *workerPool {
+	if parallelism < 2 {
+		return nil
+	}
+	return &workerPool{
+		tokens: make(chan struct{}, parallelism - 1),
+		cancel: cancel,
+	}
+}
+
+// Records the given panic if it is the first one, and cancels the evaluation of all other subtrees.
+func (pool *workerPool) recover() {
+	if caught := recover(); caught != nil {
+		pool.mutex.Lock()
+		defer pool.mutex.Unlock()
+		if pool.caught == nil {
+			pool.caught = caught
+			pool.cancel()
+		}
+	}
+}
+
+// Returns the first panic that occurred within a subtree, if any.
+func (pool *workerPool) panicked() interface{} {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return pool.caught
+}
+
+// Evaluates the given subtree using the given task. The task is run in a new goroutine if there is a free worker,
+// otherwise it is run in the calling goroutine so that nested subtrees can never deadlock waiting for workers. The given
+// WaitGroup is used to wait for all the subtrees started at a level.
+func (pool *workerPool) run(wg *sync.WaitGroup, task func()) {
+	if pool == nil {
+		task()
+		return
+	}
+	// Subtrees are skipped once any subtree has panicked
+	if pool.panicked() != nil {
+		return
+	}
+	select {
+	case pool.tokens <- struct{}{}:
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-pool.tokens }()
+			defer pool.recover()
+			task()
+		}()
+	default:
+		func() {
+			defer pool.recover()
+			task()
+		}()
+	}
+}
+
+// Locks the document for reading and returns the function to unlock it. Does nothing for a nil *workerPool.
+func (pool *workerPool) readLock() (unlock func()) {
+	if pool == nil {
+		return func() {}
+	}
+	pool.document.RLock()
+	return pool.document.RUnlock
+}
+
+// Locks the document for writing and returns the function to unlock it. Does nothing for a nil *workerPool.
+func (pool *workerPool) writeLock() (unlock func()) {
+	if pool == nil {
+		return func() {}
+	}
+	pool.document.Lock()
+	return pool.document.Unlock
+}
+
+// Waits for all the subtrees started at a level using the given WaitGroup, then re-panics the first panic that occurred
+// within any subtree.
+func (pool *workerPool) wait(wg *sync.WaitGroup) {
+	if pool == nil {
+		return
+	}
+	wg.Wait()
+	if caught := pool.panicked(); caught != nil {
+		panic(caught)
+	}
+}
+
+// Like RunContext, only the timeout for each script and the total timeout for all scripts are taken from the given
+// RunOptions rather than globals.HaltingDelay.
+//
+// If the TotalTimeout is exceeded then RunWithOptions will panic with a globals.Cancelled error which wraps
+// context.DeadlineExceeded.
+//
+// If RunOptions.Parallelism is greater than 1 then the subtrees (nested objects and objects within arrays) of each
+// level are evaluated concurrently, once all the scripts on that level have been run. The output is the same as
+// evaluating sequentially as each script can only access its own scope. If a script panics then the evaluation of all
+// the other subtrees is cancelled and RunWithOptions panics with the first error once they have stopped.
+//
+// RunOptions.Vars are normalised by marshalling them to JSON and back, so that scripts see the same types as the rest
+// of the document. If they cannot be marshalled then RunWithOptions will panic with a globals.InvalidVars error.
+func (jsonMap *JsonMap) RunWithOptions(ctx context.Context, options RunOptions) {
+	if options.Vars != nil {
+		literal, err := json.Marshal(options.Vars)
+		if err == nil {
+			options.Vars = nil
+			err = json.Unmarshal(literal, &options.Vars)
+		}
+		if err != nil {
+			panic(globals.InvalidVars.FillError(err.Error()))
+		}
+	}
+
+	// The total timeout applies to the entire document so it is only applied once, at the root
+	if options.TotalTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.TotalTimeout)
+		defer cancel()
+		options.TotalTimeout = 0
+	}
+
+	var pool *workerPool
+	if options.Parallelism > 1 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		pool = newWorkerPool(options.Parallelism, cancel)
+	}
+	jsonMap.run(ctx, options, pool)
+}
+
+// Runs all the scripts within the JsonMap and its subtrees. Subtrees are evaluated using the given workerPool.
+func (jsonMap *JsonMap) run(ctx context.Context, options RunOptions, pool *workerPool) {
+
 	// At every level of the json map
-	// 1. Create a script priority queue of all the script tags at that level
-	// 2. While the script queue isn't empty ->
+	// 1. Order all the script tags at that level using code.OrderPhases
+	// 2. For each script in the pre phase in order ->
 	// 		1. Run the script in the script lang's environment using code.Run -> new scope JsonMap
-	//		2. Delete the script from the new De-JOM-ified JsonMap
+	//		2. Delete the script from the new De-JOM-ified JsonMap (unless the script assigns its result to its key)
 	//		3. Set the current scope to the De-JOM-ified JsonMap
 	// 3. Iterate over each key in the new updated scope
 	// 		1. If the element at the key is an array:
@@ -1269,81 +1901,136 @@ func (jsonMap *JsonMap) Run() {
 	//			- Remember to update the traversal scopePath
 	//			- Recurse into the object
 	//		3. Default just passes
+	// 4. Run each script in the post phase in order, in the same way as step 2
 	// Find all the script fields
+	// FindScriptFields writes to the scope, so other subtrees cannot read the document whilst the fields are found
+	jsonMap.traversal.pool = pool
+	jsonMap.traversal.vars = options.Vars
+	unlock := pool.writeLock()
 	jsonMap.FindScriptFields()
+	unlock()
 	// Set up path
 	if jsonMap.traversal.scopePath.Len() == 0 {
 		_, _ = fmt.Fprint(jsonMap.traversal.scopePath, "$")
 	}
 
-	// Get all script keys at the current level
-	scriptQueue := make(str.StringHeap, 0)
+	// Get all scripts at the current level
+	scripts := make(map[string]code.Code)
 	for k, e := range jsonMap.traversal.script {
 		switch e.(type) {
 		case code.Code:
-			scriptQueue = append(scriptQueue, k)
+			scripts[k] = e.(code.Code)
 		default:
 			continue
 		}
 	}
-	// Initialise the heap so that all script tags can be dequeued in lexicographical order
-	heap.Init(&scriptQueue)
-
-	// Iterate over all scripts
-	for scriptQueue.Len() > 0 {
-		// Dequeue the scriptKey from the scriptQueue
-		scriptKey := heap.Pop(&scriptQueue).(string)
-
-		// Get the script language by CheckIfScript
-		script := jsonMap.traversal.script[scriptKey].(code.Code)
-
-		// Run the script for the script's language. This will...
-		// 1. Create the JOM object, setup any builtin functions and insert the JOM into the script environment
-		// 2. Setup any interrupts for the halting problem
-		// 3. Extract and decode the JOM from the environment and return it
-		// Any errors that occur have to be panicked as they can effect the entire runtime
-		newScope, err := code.Run(script, jsonMap)
-		if err != nil {
-			panic(err)
-		}
-
-		// Delete the script key from the newScope
-		delete(*newScope.GetInsides(), scriptKey)
-		// Set the current scope to the new scope
-		(*jsonMap).insides = *newScope.GetInsides()
+	// Order the scripts using their "after" and "priority" attributes then their keys (lexicographical order), and split
+	// them into the scripts run before and after the subtrees
+	preOrder, postOrder, err := code.OrderPhases(scripts, jsonMap.GetCurrentScopePath(), options)
+	if err != nil {
+		panic(err)
 	}
+	jsonMap.runScripts(ctx, options, scripts, preOrder)
 
-	// Iterate over each key within the new scope (or the same scope if no scripts were run)
+	// Find each subtree within the new scope (or the same scope if no scripts were run) before any are evaluated, so
+	// that the scope is not read whilst the subtrees are joining themselves back into it
+	subtrees := make([]*JsonMap, 0)
 	for key, element := range (*jsonMap).insides {
 		switch element.(type) {
 		case map[string]interface{}:
 			// Recurse when there is a nested object
-			jsonInnerMap := NewFromMap(element.(map[string]interface{}))
-			// Remember to update the scope path of the new JsonMap
-			_, _ = fmt.Fprintf(jsonInnerMap.traversal.scopePath, "%s.%s", jsonMap.traversal.scopePath.String(), key)
-			jsonInnerMap.Run()
-			// Join the subtree back into the main tree
-			jsonMap.insides[key] = jsonInnerMap.insides
+			key := key
+			subtrees = append(subtrees, jsonMap.subtree(
+				element.(map[string]interface{}),
+				json_map.AppendMember(jsonMap.traversal.scopePath.String(), key),
+				func(insides map[string]interface{}) {
+					jsonMap.insides[key] = insides
+				},
+			))
 		case []interface{}:
 			elementArray := element.([]interface{})
 			// Iterate over array and recurse on all objects that may be inside the array
 			for i, inner := range elementArray {
 				switch inner.(type) {
 				case map[string]interface{}:
-					jsonInnerInnerMap := NewFromMap(inner.(map[string]interface{}))
-					// Remember to update the scope path of the new JsonMap
-					_, _ = fmt.Fprintf(jsonInnerInnerMap.traversal.scopePath, "%s.%s.[%d]", jsonMap.traversal.scopePath.String(), key, i)
-					jsonInnerInnerMap.Run()
-					// Join the subtree back into the array
-					elementArray[i] = jsonInnerInnerMap.insides
+					i := i
+					subtrees = append(subtrees, jsonMap.subtree(
+						inner.(map[string]interface{}),
+						fmt.Sprintf("%s[%d]", json_map.AppendMember(jsonMap.traversal.scopePath.String(), key), i),
+						// Each subtree writes to its own element
+						func(insides map[string]interface{}) {
+							elementArray[i] = insides
+						},
+					))
 				}
 			}
-			// Join array back into the main tree
-			jsonMap.insides[key] = elementArray
+		}
+	}
+
+	// Evaluate each subtree. Subtrees join themselves back into the main tree whenever a script is run within them
+	var wg sync.WaitGroup
+	for _, subtree := range subtrees {
+		subtree := subtree
+		pool.run(&wg, func() {
+			subtree.run(ctx, options, pool)
+		})
+	}
+	pool.wait(&wg)
+
+	// Finally, run the scripts which can see the evaluated subtrees
+	jsonMap.runScripts(ctx, options, scripts, postOrder)
+}
+
+// Creates the JsonMap for a subtree of the JsonMap with the given insides and scope path. The given join function
+// should join the subtree's insides back into the JsonMap.
+func (jsonMap *JsonMap) subtree(insides map[string]interface{}, scopePath string, join func(insides map[string]interface{})) *JsonMap {
+	subtree := NewFromMap(insides)
+	// Remember to update the scope path of the new JsonMap
+	_, _ = fmt.Fprint(subtree.traversal.scopePath, scopePath)
+	subtree.traversal.root = jsonMap.Root().(*JsonMap)
+	subtree.traversal.parent = jsonMap
+	subtree.traversal.join = join
+	return subtree
+}
+
+// Runs the scripts with the given keys in order, setting the current scope to the scope returned by each script.
+func (jsonMap *JsonMap) runScripts(ctx context.Context, options RunOptions, scripts map[string]code.Code, order []string) {
+	for _, scriptKey := range order {
+		script := scripts[scriptKey]
+
+		// Run the script for the script's language. This will...
+		// 1. Create the JOM object, setup any builtin functions and insert the JOM into the script environment
+		// 2. Setup any interrupts for the halting problem
+		// 3. Extract and decode the JOM from the environment and return it
+		// Any errors that occur have to be panicked as they can effect the entire runtime
+		newScope, err := jsonMap.runScript(ctx, options, script)
+		if err != nil {
+			panic(err)
+		}
+
+		// Delete the script key from the newScope, unless the script's result has been assigned to it
+		if !script.KeepsKey() {
+			delete(*newScope.GetInsides(), scriptKey)
+		}
+		// Set the current scope to the new scope and join it back into the main tree
+		(*jsonMap).insides = *newScope.GetInsides()
+		if jsonMap.traversal.join != nil {
+			unlock := jsonMap.traversal.pool.writeLock()
+			jsonMap.traversal.join(jsonMap.insides)
+			unlock()
 		}
 	}
 }
 
+// Runs the given script within the JsonMap. Go callbacks are given exclusive access to the document whilst they run, as
+// they can modify their scope in place.
+func (jsonMap *JsonMap) runScript(ctx context.Context, options RunOptions, script code.Code) (newScope json_map.JsonMapInt, err error) {
+	if script.ScriptLang == code.GO {
+		defer jsonMap.traversal.pool.writeLock()()
+	}
+	return code.RunWithOptions(ctx, script, jsonMap, options)
+}
+
 // Unmarshal a hjson byte string and package it as a JsonMap.
 func (jsonMap *JsonMap) Unmarshal(jsonBytes []byte) (err error) {
 	// Decode and a check for errors.
@@ -1383,6 +2070,18 @@ func (jsonMap *JsonMap) Marshal() (out []byte, err error) {
 // Returns the evaluated JSON as a byte array and nil if everything is good. Otherwise an empty byte array and an error
 // will be returned if an error occurs.
 func Eval(jsonBytes []byte, verbose bool) (out []byte, err error) {
+	return EvalContext(context.Background(), jsonBytes, verbose)
+}
+
+// Like Eval, only all scripts will stop running once the given context is done. In which case, the returned error
+// will wrap a globals.Cancelled error which itself wraps the context's error.
+func EvalContext(ctx context.Context, jsonBytes []byte, verbose bool) (out []byte, err error) {
+	return EvalWithOptions(ctx, jsonBytes, verbose, RunOptions{})
+}
+
+// Like EvalContext, only the timeout for each script and the total timeout for all scripts are taken from the given
+// RunOptions. See JsonMap.RunWithOptions.
+func EvalWithOptions(ctx context.Context, jsonBytes []byte, verbose bool, options RunOptions) (out []byte, err error) {
 	// Create map to keep decoded data
 	jsonMap := New()
 
@@ -1395,14 +2094,18 @@ func Eval(jsonBytes []byte, verbose bool) (out []byte, err error) {
 	// Catch any panics that might happen when running scripts
 	defer func() {
 		if p := recover(); p != nil {
-			// Set the error so that it is returned
-			err = errors.New(fmt.Sprintf("Error occured while evaluating JSON-DOM: %v", p))
+			// Set the error so that it is returned. Errors are wrapped so that they can be inspected using errors.Is/As
+			if pErr, ok := p.(error); ok {
+				err = fmt.Errorf("Error occured while evaluating JSON-DOM: %w", pErr)
+			} else {
+				err = errors.New(fmt.Sprintf("Error occured while evaluating JSON-DOM: %v", p))
+			}
 			return
 		}
 	}()
 
 	// Run the scripts within each scope of the JsonMap
-	jsonMap.Run()
+	jsonMap.RunWithOptions(ctx, options)
 
 	if verbose {
 		fmt.Println("\ngo map:", jsonMap.insides)
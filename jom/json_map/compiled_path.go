@@ -0,0 +1,124 @@
+package json_map
+
+import (
+	"container/list"
+	"github.com/andygello555/json-dom/globals"
+	"sync"
+)
+
+// The maximum number of compiled JSON paths that are cached by Compile. JSON paths are evicted in least recently used
+// order. JSON paths are not cached if this is less than 1.
+var CompiledPathCacheSize = 1024
+
+// A JSON path that has been parsed into AbsolutePaths (see ParseJsonPath), so that it can be evaluated against any
+// number of JsonMapInts without being parsed again. A CompiledPath is immutable, so it can be used concurrently.
+type CompiledPath struct {
+	source string
+	paths  AbsolutePaths
+}
+
+// A least recently used cache of compiled JSON paths keyed by their source.
+type compiledPathCache struct {
+	mutex sync.Mutex
+	order *list.List
+	paths map[string]*list.Element
+}
+
+var compiledPaths = compiledPathCache{
+	order: list.New(),
+	paths: make(map[string]*list.Element),
+}
+
+// Returns the cached compiled JSON path for the given source. Returns nil if the JSON path isn't cached.
+func (cache *compiledPathCache) get(jsonPath string) *CompiledPath {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, ok := cache.paths[jsonPath]; ok {
+		cache.order.MoveToFront(element)
+		return element.Value.(*CompiledPath)
+	}
+	return nil
+}
+
+// Caches the given compiled JSON path, evicting the least recently used JSON paths if the cache is full. Returns the
+// compiled JSON path that is cached for the same source.
+func (cache *compiledPathCache) put(path *CompiledPath) *CompiledPath {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if CompiledPathCacheSize < 1 {
+		return path
+	}
+	if element, ok := cache.paths[path.source]; ok {
+		// The JSON path has been cached by another goroutine in the meantime
+		return element.Value.(*CompiledPath)
+	}
+	cache.paths[path.source] = cache.order.PushFront(path)
+	for cache.order.Len() > CompiledPathCacheSize {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.paths, oldest.Value.(*CompiledPath).source)
+	}
+	return path
+}
+
+// Parses the given JSON path into a CompiledPath. Compiled JSON paths are cached, so compiling the same JSON path again
+// returns the same CompiledPath without parsing it (see CompiledPathCacheSize).
+//
+// Returns a globals.JsonPathError if the JSON path cannot be parsed.
+func Compile(jsonPath string) (path *CompiledPath, err error) {
+	if path = compiledPaths.get(jsonPath); path != nil {
+		return path, nil
+	}
+
+	// Parse the JSON path outside the lock so that other JSON paths are not blocked
+	path = &CompiledPath{source: jsonPath}
+	if path.paths, err = ParseJsonPath(jsonPath); err != nil {
+		return nil, err
+	}
+	return compiledPaths.put(path), nil
+}
+
+// Like Compile, only it panics when the JSON path cannot be parsed. This is intended for JSON paths which are known to
+// be valid, such as those in package level variables.
+func MustCompile(jsonPath string) *CompiledPath {
+	path, err := Compile(jsonPath)
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
+
+// Returns a copy of the AbsolutePaths that the JSON path was parsed into. The copy can be modified without affecting
+// the CompiledPath.
+func (path *CompiledPath) AbsolutePaths() AbsolutePaths {
+	paths := make(AbsolutePaths, len(path.paths))
+	for i, absolutePath := range path.paths {
+		paths[i] = make([]AbsolutePathKey, len(absolutePath))
+		copy(paths[i], absolutePath)
+	}
+	return paths
+}
+
+// Returns the nodes pointed to by the JSON path within the given JsonMapInt. This is the same as calling
+// JsonMapInt.JsonPathSelector with the source of the JSON path.
+func (path *CompiledPath) Select(jsonMap JsonMapInt) (out []*JsonPathNode, err error) {
+	paths := path.AbsolutePaths()
+	values, errs := jsonMap.GetAbsolutePaths(&paths)
+	if errs != nil {
+		return nil, globals.JsonPathError.FillFromErrors(errs)
+	}
+	return values, nil
+}
+
+// Sets the values pointed to by the JSON path within the given JsonMapInt to be the given value. If the value is nil
+// then the values pointed to are deleted. This is the same as calling JsonMapInt.JsonPathSetter with the source of the
+// JSON path.
+func (path *CompiledPath) Set(jsonMap JsonMapInt, value interface{}) (err error) {
+	paths := path.AbsolutePaths()
+	return jsonMap.SetAbsolutePaths(&paths, value)
+}
+
+// Returns the source of the JSON path.
+func (path *CompiledPath) String() string {
+	return path.source
+}
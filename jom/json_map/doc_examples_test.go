@@ -50,4 +50,40 @@ func ExampleAbsolutePaths() {
 	fmt.Println(absolutePaths)
 	// Output:
 	// [[|RecursiveLookup: property| |IndexKey: 0| |StringKey: name|] [|RecursiveLookup: property| |IndexKey: 1| |StringKey: name|] [|RecursiveLookup: property| |IndexKey: 2| |StringKey: name|]]
-}
\ No newline at end of file
+}
+// Parsing a filter expression and matching it against decoded JSON values.
+func ExampleParseFilter() {
+	filter, _ := ParseFilter("@.age > $.min && @.name =~ /^j/i")
+	root := map[string]interface{}{"min": 18.0}
+	fmt.Println(filter.Match(map[string]interface{}{"name": "Jane", "age": 24.0}, root))
+	fmt.Println(filter.Match(map[string]interface{}{"name": "Bob", "age": 55.0}, root))
+	// Output:
+	// true
+	// false
+}
+
+// Selecting nodes using a strict (RFC 9535) JSON path and formatting their normalized paths.
+func ExampleParseJsonPathStrict() {
+	path, _ := ParseJsonPathStrict("$.people[?@.age > 30]['name', 'age']")
+	root := map[string]interface{}{"people": []interface{}{
+		map[string]interface{}{"name": "Jane", "age": 24.0},
+		map[string]interface{}{"name": "Bob", "age": 55.0},
+	}}
+	for _, node := range path.Select(root) {
+		normalized, _ := NormalizedPath(node.Absolute)
+		fmt.Println(normalized, node.Value)
+	}
+	// Output:
+	// $['people'][1]['name'] Bob
+	// $['people'][1]['age'] 55
+}
+
+func ExampleParseJsonPointer() {
+	paths, _ := ParseJsonPointer("/people/0/a~1b")
+	fmt.Println(paths)
+	pointer, _ := JsonPointer(paths[0])
+	fmt.Println(pointer)
+	// Output:
+	// [[|StringKey: people| |IndexKey: 0| |StringKey: a/b|]]
+	// /people/0/a~1b
+}
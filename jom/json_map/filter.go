@@ -0,0 +1,1351 @@
+package json_map
+
+import (
+	"fmt"
+	"github.com/andygello555/json-dom/globals"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A parsed filter expression (the expression within "[?(...)]") which can be evaluated directly against decoded JSON
+// values (map[string]interface{}, []interface{}, etc.) without a script interpreter.
+//
+// The syntax is based on the filter expressions of RFC 9535:
+//
+// • The current node is referred to using "@" and the root of the document using "$". Either can be followed by any
+// number of segments: ".name", ".*", "[n]", "[start:end:step]", "['name']", "[*]", "[?expr]" and "..name" (descendants).
+//
+// • Literals: numbers, strings (single or double quoted), true, false, null, arrays ([1, 'a']) and regular expressions
+// (/pattern/flags).
+//
+// • Comparisons: ==, !=, <, <=, > and >=. Also === and !== which are the same as == and !=.
+//
+// • Logical operators: &&, || and !. A query on its own is an existence test (true if it selects any nodes).
+//
+// • Membership: "a in b" is true if b is an array containing a, or an object containing the key a. "a nin b" is the
+// negation.
+//
+// • Regular expressions: "a =~ b" is true if the string a contains a match for the regular expression (or string) b.
+//
+// • Functions: length(value), count(query), match(string, pattern), search(string, pattern) and value(query).
+//
+// • For compatibility with Javascript filter expressions: "typeof value" returns the name of the value's Javascript type
+// and ".length" returns the length of strings and arrays.
+type FilterExpression struct {
+	source string
+	root   filterNode
+}
+
+// Parses the given filter expression (without the surrounding "[?(" and ")]"). Returns a globals.JsonPathError if the
+// expression is invalid.
+func ParseFilter(expression string) (filter *FilterExpression, err error) {
+	parser := &filterParser{source: expression}
+	filter = &FilterExpression{source: expression}
+	if err = parser.parse("filter expression", func() {
+		filter.root = parser.or()
+		parser.end()
+	}); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// Returns whether the filter expression is true for the given current node (@) within the given root ($).
+func (filter *FilterExpression) Match(current interface{}, root interface{}) bool {
+	return filter.root.evaluate(&filterContext{current: current, root: root}).truthy()
+}
+
+// Returns the source of the filter expression.
+func (filter *FilterExpression) String() string {
+	return filter.source
+}
+
+// The nodes which a filter expression is evaluated against.
+type filterContext struct {
+	current interface{}
+	root    interface{}
+}
+
+// The kinds of filterResult.
+type filterResultKind int
+
+const (
+	// A single value, or nothing (e.g. the result of length() on an object)
+	valueResult filterResultKind = iota
+	// The nodes selected by a query
+	nodesResult
+	// The result of a comparison or logical operator
+	logicalResult
+)
+
+// The result of evaluating a filterNode.
+type filterResult struct {
+	kind    filterResultKind
+	value   interface{}
+	nothing bool
+	nodes   []interface{}
+	logical bool
+}
+
+var nothing = filterResult{kind: valueResult, nothing: true}
+
+// Returns the single value of the result. Returns false if the result is nothing (or a query which selected no nodes).
+// Queries which select multiple nodes return an array of the values of the nodes.
+func (result filterResult) single() (value interface{}, ok bool) {
+	switch result.kind {
+	case nodesResult:
+		switch len(result.nodes) {
+		case 0:
+			return nil, false
+		case 1:
+			return result.nodes[0], true
+		}
+		return append([]interface{}{}, result.nodes...), true
+	case logicalResult:
+		return result.logical, true
+	}
+	return result.value, !result.nothing
+}
+
+// Returns whether the result is true when used as a logical expression. Queries are true if they select any nodes and
+// values are true if they are truthy (in the same way as Javascript).
+func (result filterResult) truthy() bool {
+	switch result.kind {
+	case nodesResult:
+		return len(result.nodes) > 0
+	case logicalResult:
+		return result.logical
+	}
+	if result.nothing {
+		return false
+	}
+	switch value := result.value.(type) {
+	case nil:
+		return false
+	case bool:
+		return value
+	case string:
+		return value != ""
+	}
+	if number, ok := toFloat(result.value); ok {
+		return number != 0 && !math.IsNaN(number)
+	}
+	return true
+}
+
+func logical(value bool) filterResult {
+	return filterResult{kind: logicalResult, logical: value}
+}
+
+// A node within the abstract syntax tree of a filter expression.
+type filterNode interface {
+	evaluate(ctx *filterContext) filterResult
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (node *literalNode) evaluate(ctx *filterContext) filterResult {
+	return filterResult{kind: valueResult, value: node.value}
+}
+
+type arrayNode struct {
+	elements []filterNode
+}
+
+func (node *arrayNode) evaluate(ctx *filterContext) filterResult {
+	array := make([]interface{}, 0, len(node.elements))
+	for _, element := range node.elements {
+		if value, ok := element.evaluate(ctx).single(); ok {
+			array = append(array, value)
+		}
+	}
+	return filterResult{kind: valueResult, value: array}
+}
+
+type notNode struct {
+	operand filterNode
+}
+
+func (node *notNode) evaluate(ctx *filterContext) filterResult {
+	return logical(!node.operand.evaluate(ctx).truthy())
+}
+
+type andNode struct {
+	left, right filterNode
+}
+
+func (node *andNode) evaluate(ctx *filterContext) filterResult {
+	return logical(node.left.evaluate(ctx).truthy() && node.right.evaluate(ctx).truthy())
+}
+
+type orNode struct {
+	left, right filterNode
+}
+
+func (node *orNode) evaluate(ctx *filterContext) filterResult {
+	return logical(node.left.evaluate(ctx).truthy() || node.right.evaluate(ctx).truthy())
+}
+
+type typeofNode struct {
+	operand filterNode
+}
+
+func (node *typeofNode) evaluate(ctx *filterContext) filterResult {
+	value, ok := node.operand.evaluate(ctx).single()
+	name := "object"
+	switch {
+	case !ok:
+		name = "undefined"
+	case value == nil:
+	default:
+		switch value.(type) {
+		case bool:
+			name = "boolean"
+		case string:
+			name = "string"
+		default:
+			if _, number := toFloat(value); number {
+				name = "number"
+			}
+		}
+	}
+	return filterResult{kind: valueResult, value: name}
+}
+
+type comparisonNode struct {
+	operator    string
+	left, right filterNode
+	// The compiled regular expression for "=~" when the right operand is a literal
+	pattern     *regexp.Regexp
+}
+
+func (node *comparisonNode) evaluate(ctx *filterContext) filterResult {
+	left, leftOk := node.left.evaluate(ctx).single()
+	if node.operator == "=~" {
+		pattern := node.pattern
+		if pattern == nil {
+			right, ok := node.right.evaluate(ctx).single()
+			source, isString := right.(string)
+			if !ok || !isString {
+				return logical(false)
+			}
+			var err error
+			if pattern, err = regexp.Compile(source); err != nil {
+				return logical(false)
+			}
+		}
+		str, isString := left.(string)
+		return logical(leftOk && isString && pattern.MatchString(str))
+	}
+
+	right, rightOk := node.right.evaluate(ctx).single()
+	switch node.operator {
+	case "==", "===":
+		return logical(leftOk == rightOk && (!leftOk || equalValues(left, right)))
+	case "!=", "!==":
+		return logical(!(leftOk == rightOk && (!leftOk || equalValues(left, right))))
+	case "<":
+		return logical(leftOk && rightOk && lessValues(left, right))
+	case "<=":
+		return logical(leftOk && rightOk && (lessValues(left, right) || equalValues(left, right)))
+	case ">":
+		return logical(leftOk && rightOk && lessValues(right, left))
+	case ">=":
+		return logical(leftOk && rightOk && (lessValues(right, left) || equalValues(left, right)))
+	case "in":
+		return logical(leftOk && rightOk && containsValue(right, left))
+	case "nin":
+		return logical(!(leftOk && rightOk && containsValue(right, left)))
+	}
+	return logical(false)
+}
+
+type functionNode struct {
+	name    string
+	args    []filterNode
+	// The compiled regular expression for match() and search() when the pattern is a literal
+	pattern *regexp.Regexp
+	// Whether the literal pattern for match() or search() is invalid, in which case the function is always false
+	invalid bool
+}
+
+func (node *functionNode) evaluate(ctx *filterContext) filterResult {
+	switch node.name {
+	case "length":
+		value, ok := node.args[0].evaluate(ctx).single()
+		if !ok {
+			return nothing
+		}
+		switch value.(type) {
+		case string:
+			return filterResult{kind: valueResult, value: float64(utf8.RuneCountInString(value.(string)))}
+		case []interface{}:
+			return filterResult{kind: valueResult, value: float64(len(value.([]interface{})))}
+		case map[string]interface{}:
+			return filterResult{kind: valueResult, value: float64(len(value.(map[string]interface{})))}
+		}
+		return nothing
+	case "count":
+		return filterResult{kind: valueResult, value: float64(len(node.args[0].evaluate(ctx).nodes))}
+	case "value":
+		if nodes := node.args[0].evaluate(ctx).nodes; len(nodes) == 1 {
+			return filterResult{kind: valueResult, value: nodes[0]}
+		}
+		return nothing
+	case "match", "search":
+		value, ok := node.args[0].evaluate(ctx).single()
+		str, isString := value.(string)
+		if !ok || !isString || node.invalid {
+			return logical(false)
+		}
+		pattern := node.pattern
+		if pattern == nil {
+			source, ok := node.args[1].evaluate(ctx).single()
+			sourceString, isString := source.(string)
+			if !ok || !isString {
+				return logical(false)
+			}
+			var err error
+			if pattern, err = compileFunctionPattern(node.name, sourceString); err != nil {
+				return logical(false)
+			}
+		}
+		return logical(pattern.MatchString(str))
+	}
+	return nothing
+}
+
+// Compiles the I-Regexp (RFC 9485) pattern for the match (which must match the entire string) or search function.
+func compileFunctionPattern(function string, pattern string) (*regexp.Regexp, error) {
+	// In I-Regexp "." matches any character except for line feeds and carriage returns. So any "." outside of escapes
+	// and character classes is replaced
+	var b strings.Builder
+	class := false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i + 1 < len(pattern):
+			b.WriteByte(c)
+			i++
+			b.WriteByte(pattern[i])
+		case c == '[':
+			class = true
+			b.WriteByte(c)
+		case c == ']':
+			class = false
+			b.WriteByte(c)
+		case c == '.' && !class:
+			b.WriteString("[^\\n\\r]")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	pattern = b.String()
+	if function == "match" {
+		pattern = fmt.Sprintf("^(?:%s)$", pattern)
+	}
+	return regexp.Compile(pattern)
+}
+
+// The kinds of selectors within a segment of a query.
+type selectorKind int
+
+const (
+	nameSelector selectorKind = iota
+	wildcardSelector
+	indexSelector
+	sliceSelector
+	filterSelector
+)
+
+type selector struct {
+	kind   selectorKind
+	name   string
+	// Whether a name selector was given using dot notation (".name"). ".length" returns the length of strings and arrays
+	dotted bool
+	index  int
+	// The start, end and step of a slice selector. Nil if not given
+	slice  [3]*int
+	filter filterNode
+}
+
+type segment struct {
+	descendant bool
+	selectors  []selector
+}
+
+type queryNode struct {
+	absolute bool
+	segments []segment
+}
+
+// Whether the query is a singular query (RFC 9535). That is, it only contains name and index selectors outside of
+// brackets or on their own within brackets, so it can select at most one node.
+func (node *queryNode) singular() bool {
+	for _, segment := range node.segments {
+		if segment.descendant || len(segment.selectors) != 1 {
+			return false
+		}
+		if kind := segment.selectors[0].kind; kind != nameSelector && kind != indexSelector {
+			return false
+		}
+	}
+	return true
+}
+
+func (node *queryNode) evaluate(ctx *filterContext) filterResult {
+	located := node.locate(ctx, false)
+	nodes := make([]interface{}, len(located))
+	for i, n := range located {
+		nodes[i] = n.value
+	}
+	return filterResult{kind: nodesResult, nodes: nodes}
+}
+
+// A node selected by a query along with its absolute path. The path is only set when paths are being tracked.
+type locatedNode struct {
+	value interface{}
+	path  []AbsolutePathKey
+}
+
+// Returns the child of the node at the given key of an object.
+func (n locatedNode) member(key string, value interface{}, track bool) locatedNode {
+	if !track {
+		return locatedNode{value: value}
+	}
+	return locatedNode{value: value, path: append(append(make([]AbsolutePathKey, 0, len(n.path) + 1), n.path...), AbsolutePathKey{KeyType: StringKey, Value: key})}
+}
+
+// Returns the child of the node at the given index of an array.
+func (n locatedNode) element(index int, value interface{}, track bool) locatedNode {
+	if !track {
+		return locatedNode{value: value}
+	}
+	return locatedNode{value: value, path: append(append(make([]AbsolutePathKey, 0, len(n.path) + 1), n.path...), AbsolutePathKey{KeyType: IndexKey, Value: index})}
+}
+
+// Returns the nodes selected by the query. If track is true then the absolute path of each node, relative to the start
+// of the query, is also found.
+func (node *queryNode) locate(ctx *filterContext, track bool) []locatedNode {
+	start := locatedNode{value: ctx.current}
+	if node.absolute {
+		start.value = ctx.root
+	}
+	if track {
+		start.path = make([]AbsolutePathKey, 0)
+	}
+
+	nodes := []locatedNode{start}
+	for _, segment := range node.segments {
+		next := make([]locatedNode, 0)
+		for _, n := range nodes {
+			targets := []locatedNode{n}
+			if segment.descendant {
+				targets = descendants(n, track, targets[:0])
+			}
+			for _, target := range targets {
+				for i := range segment.selectors {
+					next = segment.selectors[i].apply(ctx, target, track, next)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// Returns the keys of the given object in sorted order so that the order of selected nodes is deterministic.
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Appends the given node and all of its descendants to the given slice in document order.
+func descendants(n locatedNode, track bool, out []locatedNode) []locatedNode {
+	out = append(out, n)
+	switch value := n.value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(value) {
+			out = descendants(n.member(key, value[key], track), track, out)
+		}
+	case []interface{}:
+		for i, element := range value {
+			out = descendants(n.element(i, element, track), track, out)
+		}
+	}
+	return out
+}
+
+// Appends the nodes selected by the selector from the given node to the given slice.
+func (selector *selector) apply(ctx *filterContext, n locatedNode, track bool, out []locatedNode) []locatedNode {
+	switch selector.kind {
+	case nameSelector:
+		switch value := n.value.(type) {
+		case map[string]interface{}:
+			if child, ok := value[selector.name]; ok {
+				out = append(out, n.member(selector.name, child, track))
+			}
+		case string:
+			if selector.dotted && selector.name == "length" {
+				out = append(out, n.member(selector.name, float64(utf8.RuneCountInString(value)), track))
+			}
+		case []interface{}:
+			if selector.dotted && selector.name == "length" {
+				out = append(out, n.member(selector.name, float64(len(value)), track))
+			}
+		}
+	case wildcardSelector, filterSelector:
+		matches := func(child interface{}) bool {
+			return selector.kind == wildcardSelector || selector.filter.evaluate(&filterContext{current: child, root: ctx.root}).truthy()
+		}
+		switch value := n.value.(type) {
+		case map[string]interface{}:
+			for _, key := range sortedKeys(value) {
+				if matches(value[key]) {
+					out = append(out, n.member(key, value[key], track))
+				}
+			}
+		case []interface{}:
+			for i, element := range value {
+				if matches(element) {
+					out = append(out, n.element(i, element, track))
+				}
+			}
+		}
+	case indexSelector:
+		if array, ok := n.value.([]interface{}); ok {
+			index := selector.index
+			if index < 0 {
+				index += len(array)
+			}
+			if index >= 0 && index < len(array) {
+				out = append(out, n.element(index, array[index], track))
+			}
+		}
+	case sliceSelector:
+		if array, ok := n.value.([]interface{}); ok {
+			for _, index := range sliceIndices(selector.slice, len(array)) {
+				out = append(out, n.element(index, array[index], track))
+			}
+		}
+	}
+	return out
+}
+
+// Returns the indices selected by the given slice (start, end and step) of an array of the given length, following the
+// semantics of RFC 9535.
+func sliceIndices(slice [3]*int, length int) (indices []int) {
+	step := 1
+	if slice[2] != nil {
+		step = *slice[2]
+	}
+	if step == 0 {
+		return nil
+	}
+	normalise := func(index int) int {
+		if index < 0 {
+			return index + length
+		}
+		return index
+	}
+	clamp := func(index int, lower int, upper int) int {
+		return int(math.Min(math.Max(float64(index), float64(lower)), float64(upper)))
+	}
+
+	if step > 0 {
+		start, end := 0, length
+		if slice[0] != nil {
+			start = clamp(normalise(*slice[0]), 0, length)
+		}
+		if slice[1] != nil {
+			end = clamp(normalise(*slice[1]), 0, length)
+		}
+		for i := start; i < end; i += step {
+			indices = append(indices, i)
+		}
+		return indices
+	}
+	start, end := length - 1, -1
+	if slice[0] != nil {
+		start = clamp(normalise(*slice[0]), -1, length - 1)
+	}
+	if slice[1] != nil {
+		end = clamp(normalise(*slice[1]), -1, length - 1)
+	}
+	for i := start; i > end; i += step {
+		indices = append(indices, i)
+	}
+	return indices
+}
+
+// Converts the given number to a float64. Returns false if the given value is not a number.
+func toFloat(value interface{}) (float64, bool) {
+	switch number := reflect.ValueOf(value); number.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return number.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(number.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(number.Uint()), true
+	}
+	return 0, false
+}
+
+// Whether the given values are equal. Numbers are equal if they have the same value, and arrays and objects are equal
+// if their elements/members are equal.
+func equalValues(a interface{}, b interface{}) bool {
+	if aNumber, ok := toFloat(a); ok {
+		bNumber, ok := toFloat(b)
+		return ok && aNumber == bNumber
+	}
+	switch a.(type) {
+	case nil:
+		return b == nil
+	case bool, string:
+		return a == b
+	case []interface{}:
+		bArray, ok := b.([]interface{})
+		if !ok || len(a.([]interface{})) != len(bArray) {
+			return false
+		}
+		for i, element := range a.([]interface{}) {
+			if !equalValues(element, bArray[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bObject, ok := b.(map[string]interface{})
+		if !ok || len(a.(map[string]interface{})) != len(bObject) {
+			return false
+		}
+		for key, member := range a.(map[string]interface{}) {
+			if bMember, ok := bObject[key]; !ok || !equalValues(member, bMember) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// Whether a is less than b. Only numbers and strings can be compared.
+func lessValues(a interface{}, b interface{}) bool {
+	if aNumber, ok := toFloat(a); ok {
+		bNumber, ok := toFloat(b)
+		return ok && aNumber < bNumber
+	}
+	if aString, ok := a.(string); ok {
+		bString, ok := b.(string)
+		return ok && aString < bString
+	}
+	return false
+}
+
+// Whether the given container (an array or object) contains the given value (as an element or key).
+func containsValue(container interface{}, value interface{}) bool {
+	switch container.(type) {
+	case []interface{}:
+		for _, element := range container.([]interface{}) {
+			if equalValues(element, value) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		if key, ok := value.(string); ok {
+			_, ok = container.(map[string]interface{})[key]
+			return ok
+		}
+	}
+	return false
+}
+
+// Panicked by filterParser when the filter expression is invalid. This is recovered by filterParser.parse.
+type filterParseError struct {
+	message string
+	pos     int
+}
+
+// A recursive descent parser for filter expressions. If strict is true then only the syntax of RFC 9535 is accepted and
+// the well-typedness of function arguments, comparisons and test expressions is checked (see ParseJsonPathStrict).
+type filterParser struct {
+	source string
+	pos    int
+	strict bool
+}
+
+// Calls the given function, recovering any filterParseError and returning it as a globals.JsonPathError for the given
+// description of the source.
+func (parser *filterParser) parse(description string, parse func()) (err error) {
+	defer func() {
+		if caught := recover(); caught != nil {
+			parseErr, ok := caught.(filterParseError)
+			if !ok {
+				panic(caught)
+			}
+			err = globals.JsonPathError.FillError(fmt.Sprintf("Could not parse the %s \"%s\": %s at position %d", description, parser.source, parseErr.message, parseErr.pos))
+		}
+	}()
+	parse()
+	return nil
+}
+
+func (parser *filterParser) fail(format string, args ...interface{}) {
+	panic(filterParseError{fmt.Sprintf(format, args...), parser.pos})
+}
+
+// Fails at the given position.
+func (parser *filterParser) failAt(pos int, format string, args ...interface{}) {
+	parser.pos = pos
+	parser.fail(format, args...)
+}
+
+// Skips any whitespace.
+func (parser *filterParser) skip() {
+	for parser.pos < len(parser.source) && strings.ContainsRune(" \t\n\r", rune(parser.source[parser.pos])) {
+		parser.pos++
+	}
+}
+
+// Whether the remaining source starts with the given token, after skipping any whitespace.
+func (parser *filterParser) peek(token string) bool {
+	parser.skip()
+	return strings.HasPrefix(parser.source[parser.pos:], token)
+}
+
+// Consumes the given token if the remaining source starts with it.
+func (parser *filterParser) consume(token string) bool {
+	if parser.peek(token) {
+		parser.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// Consumes the given token or fails.
+func (parser *filterParser) expect(token string) {
+	if !parser.consume(token) {
+		parser.fail("expected %q", token)
+	}
+}
+
+// Consumes the given keyword if the remaining source starts with it and it is not followed by any name characters.
+func (parser *filterParser) keyword(keyword string) bool {
+	if parser.peek(keyword) {
+		if next, _ := utf8.DecodeRuneInString(parser.source[parser.pos + len(keyword):]); !isNameChar(next) {
+			parser.pos += len(keyword)
+			return true
+		}
+	}
+	return false
+}
+
+// Fails if there is anything left to parse other than whitespace.
+func (parser *filterParser) end() {
+	if parser.skip(); parser.pos < len(parser.source) {
+		parser.fail("unexpected %q", parser.source[parser.pos:])
+	}
+}
+
+// The first character of a member name shorthand. This matches the propertyPattern used by ParseJsonPath.
+func isNameStart(r rune) bool {
+	return isStrictNameStart(r)
+}
+
+func isNameChar(r rune) bool {
+	return isStrictNameChar(r) || r == '-'
+}
+
+// The first character of a member name shorthand in RFC 9535.
+func isStrictNameStart(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= 0x80 && r != utf8.RuneError
+}
+
+func isStrictNameChar(r rune) bool {
+	return isStrictNameStart(r) || r >= '0' && r <= '9'
+}
+
+// Parses a member name after a dot.
+func (parser *filterParser) name() string {
+	nameStart, nameChar := isNameStart, isNameChar
+	if parser.strict {
+		nameStart, nameChar = isStrictNameStart, isStrictNameChar
+	}
+	start := parser.pos
+	for parser.pos < len(parser.source) {
+		r, size := utf8.DecodeRuneInString(parser.source[parser.pos:])
+		if parser.pos == start && !nameStart(r) || parser.pos != start && !nameChar(r) {
+			break
+		}
+		parser.pos += size
+	}
+	if parser.pos == start {
+		parser.fail("expected a name")
+	}
+	return parser.source[start:parser.pos]
+}
+
+// or := and ("||" and)*
+func (parser *filterParser) or() filterNode {
+	node := parser.and()
+	for parser.consume("||") {
+		node = &orNode{node, parser.and()}
+	}
+	return node
+}
+
+// and := unary ("&&" unary)*
+func (parser *filterParser) and() filterNode {
+	node := parser.unary()
+	for parser.consume("&&") {
+		node = &andNode{node, parser.unary()}
+	}
+	return node
+}
+
+// unary := "!" unary | comparison
+//
+// In strict mode only test expressions and parenthesised expressions can be negated.
+func (parser *filterParser) unary() filterNode {
+	if parser.peek("!") && !parser.peek("!=") {
+		parser.pos++
+		if parser.strict {
+			parser.skip()
+			start := parser.pos
+			operand := parser.operand()
+			parser.checkTest(operand, start)
+			return &notNode{operand}
+		}
+		return &notNode{parser.unary()}
+	}
+	return parser.comparison()
+}
+
+// The comparison operators in the order they are matched (longest first).
+var (
+	comparisonOperators       = []string{"===", "!==", "==", "!=", "=~", "<=", ">=", "<", ">"}
+	strictComparisonOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+)
+
+// comparison := operand (operator operand)?
+func (parser *filterParser) comparison() filterNode {
+	parser.skip()
+	leftStart := parser.pos
+	left := parser.operand()
+	operators := comparisonOperators
+	if parser.strict {
+		operators = strictComparisonOperators
+	}
+	operator := ""
+	for _, candidate := range operators {
+		if parser.consume(candidate) {
+			operator = candidate
+			break
+		}
+	}
+	if operator == "" {
+		switch {
+		case parser.strict:
+			parser.checkTest(left, leftStart)
+			return left
+		case parser.keyword("in"):
+			operator = "in"
+		case parser.keyword("nin"):
+			operator = "nin"
+		default:
+			return left
+		}
+	}
+
+	parser.skip()
+	rightStart := parser.pos
+	node := &comparisonNode{operator: operator, left: left, right: parser.operand()}
+	if parser.strict {
+		parser.checkComparable(node.left, leftStart)
+		parser.checkComparable(node.right, rightStart)
+	}
+	if operator == "=~" {
+		if literal, ok := node.right.(*literalNode); ok {
+			switch pattern := literal.value.(type) {
+			case *regexp.Regexp:
+				node.pattern = pattern
+			case string:
+				var err error
+				if node.pattern, err = regexp.Compile(pattern); err != nil {
+					parser.failAt(rightStart, "invalid regular expression %q: %v", pattern, err)
+				}
+			}
+		}
+	}
+	return node
+}
+
+// Fails if the given node, which starts at the given position, cannot be used as a test expression in strict mode. A
+// test expression is a query (existence test), a function which returns a logical value, or a parenthesised
+// expression.
+func (parser *filterParser) checkTest(node filterNode, start int) {
+	switch node := node.(type) {
+	case *queryNode, *groupNode:
+		return
+	case *functionNode:
+		if node.logical() {
+			return
+		}
+		parser.failAt(start, "the result of %s() must be compared", node.name)
+	case *literalNode:
+		parser.failAt(start, "a literal must be compared")
+	}
+	parser.failAt(start, "expected a test expression")
+}
+
+// Fails if the given node, which starts at the given position, cannot be compared in strict mode. Only literals,
+// singular queries and functions which return a value can be compared.
+func (parser *filterParser) checkComparable(node filterNode, start int) {
+	switch node := node.(type) {
+	case *literalNode:
+		return
+	case *queryNode:
+		if node.singular() {
+			return
+		}
+		parser.failAt(start, "only singular queries can be compared")
+	case *functionNode:
+		if !node.logical() {
+			return
+		}
+		parser.failAt(start, "the result of %s() cannot be compared", node.name)
+	}
+	parser.failAt(start, "expected a comparable")
+}
+
+// A parenthesised expression. Only used in strict mode, so that parenthesised expressions can be told apart from
+// comparables.
+type groupNode struct {
+	expression filterNode
+}
+
+func (node *groupNode) evaluate(ctx *filterContext) filterResult {
+	return node.expression.evaluate(ctx)
+}
+
+// The number of arguments taken by each function.
+var filterFunctions = map[string]int{
+	"length": 1,
+	"count":  1,
+	"match":  2,
+	"search": 2,
+	"value":  1,
+}
+
+// Whether the function returns a logical value rather than a value.
+func (node *functionNode) logical() bool {
+	return node.name == "match" || node.name == "search"
+}
+
+// operand := "(" or ")" | array | string | number | regex | query | "typeof" operand | "true" | "false" | "null" | function
+//
+// In strict mode array literals, regular expressions and typeof are not supported.
+func (parser *filterParser) operand() filterNode {
+	parser.skip()
+	if parser.pos >= len(parser.source) {
+		parser.fail("unexpected end of expression")
+	}
+
+	switch c := parser.source[parser.pos]; {
+	case c == '(':
+		parser.pos++
+		node := parser.or()
+		parser.expect(")")
+		if parser.strict {
+			return &groupNode{node}
+		}
+		return node
+	case c == '[' && !parser.strict:
+		parser.pos++
+		array := &arrayNode{elements: make([]filterNode, 0)}
+		if !parser.consume("]") {
+			for {
+				array.elements = append(array.elements, parser.operand())
+				if parser.consume("]") {
+					break
+				}
+				parser.expect(",")
+			}
+		}
+		return array
+	case c == '\'' || c == '"':
+		return &literalNode{parser.string()}
+	case c == '-' || c >= '0' && c <= '9':
+		return &literalNode{parser.number()}
+	case c == '/' && !parser.strict:
+		return &literalNode{parser.regex()}
+	case c == '@' || c == '$':
+		parser.pos++
+		return &queryNode{absolute: c == '$', segments: parser.segments()}
+	}
+
+	switch {
+	case !parser.strict && parser.keyword("typeof"):
+		return &typeofNode{parser.operand()}
+	case parser.keyword("true"):
+		return &literalNode{true}
+	case parser.keyword("false"):
+		return &literalNode{false}
+	case parser.keyword("null"):
+		return &literalNode{nil}
+	}
+	return parser.function()
+}
+
+var strictFunctionNameRegex = regexp.MustCompile(`^[a-z][a-z_0-9]*`)
+
+// function := name "(" (or ("," or)*)? ")"
+//
+// In strict mode the opening parenthesis must immediately follow the name and the arguments must be well-typed.
+func (parser *filterParser) function() filterNode {
+	start := parser.pos
+	var name string
+	if parser.strict {
+		if name = strictFunctionNameRegex.FindString(parser.source[parser.pos:]); name == "" {
+			parser.fail("unexpected %q", parser.source[parser.pos:])
+		}
+		parser.pos += len(name)
+	} else {
+		name = parser.name()
+	}
+	arity, ok := filterFunctions[name]
+	if !ok {
+		parser.failAt(start, "unknown function or value %q", name)
+	}
+	if parser.strict && !strings.HasPrefix(parser.source[parser.pos:], "(") {
+		parser.fail("expected \"(\"")
+	}
+	parser.expect("(")
+
+	node := &functionNode{name: name, args: make([]filterNode, 0, arity)}
+	argStarts := make([]int, 0, arity)
+	if !parser.consume(")") {
+		for {
+			parser.skip()
+			argStarts = append(argStarts, parser.pos)
+			node.args = append(node.args, parser.argument())
+			if parser.consume(")") {
+				break
+			}
+			parser.expect(",")
+		}
+	}
+	if len(node.args) != arity {
+		parser.failAt(start, "%s() takes %d argument(s) but was given %d", name, arity, len(node.args))
+	}
+
+	for i, arg := range node.args {
+		switch name {
+		case "count", "value":
+			if _, ok := arg.(*queryNode); !ok {
+				parser.failAt(argStarts[i], "the argument of %s() must be a query", name)
+			}
+		default:
+			if parser.strict {
+				parser.checkComparable(arg, argStarts[i])
+			}
+		}
+	}
+
+	if literal, ok := node.args[len(node.args) - 1].(*literalNode); ok && node.logical() {
+		if pattern, ok := literal.value.(string); ok {
+			// An invalid pattern never matches
+			var err error
+			if node.pattern, err = compileFunctionPattern(name, pattern); err != nil {
+				node.invalid = true
+			}
+		}
+	}
+	return node
+}
+
+// Parses an argument of a function. In strict mode arguments which are not logical expressions are parsed as operands,
+// so that they are not checked as test expressions.
+func (parser *filterParser) argument() filterNode {
+	if parser.strict {
+		start := parser.pos
+		operand := parser.operand()
+		if parser.peek(",") || parser.peek(")") {
+			return operand
+		}
+		parser.pos = start
+	}
+	return parser.or()
+}
+
+// Parses a single or double quoted string literal.
+//
+// In strict mode control characters must be escaped, only the escapes of RFC 9535 are supported, and surrogates must
+// be paired.
+func (parser *filterParser) string() string {
+	quote := parser.source[parser.pos]
+	parser.pos++
+	var b strings.Builder
+	for {
+		if parser.pos >= len(parser.source) {
+			parser.fail("unterminated string")
+		}
+		c := parser.source[parser.pos]
+		parser.pos++
+		switch {
+		case c == quote:
+			return b.String()
+		case c < 0x20 && parser.strict:
+			parser.failAt(parser.pos - 1, "unescaped control character in string")
+		case c == '\\':
+			if parser.pos >= len(parser.source) {
+				parser.fail("unterminated string")
+			}
+			escaped := parser.source[parser.pos]
+			parser.pos++
+			switch escaped {
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				b.WriteRune(parser.unicodeEscape())
+			case quote, '\\', '/':
+				b.WriteByte(escaped)
+			default:
+				if parser.strict {
+					parser.failAt(parser.pos - 2, "invalid escape \"\\%c\"", escaped)
+				}
+				b.WriteByte(escaped)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// Parses the hex digits of a unicode escape (after "\u") and decodes surrogate pairs.
+func (parser *filterParser) unicodeEscape() rune {
+	hex := func() rune {
+		if parser.pos + 4 > len(parser.source) {
+			parser.fail("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(parser.source[parser.pos:parser.pos + 4], 16, 32)
+		if err != nil {
+			parser.fail("invalid unicode escape")
+		}
+		parser.pos += 4
+		return rune(code)
+	}
+
+	r := hex()
+	switch {
+	case r >= 0xD800 && r < 0xDC00:
+		if strings.HasPrefix(parser.source[parser.pos:], "\\u") {
+			start := parser.pos
+			parser.pos += 2
+			if low := hex(); low >= 0xDC00 && low < 0xE000 {
+				return (r - 0xD800) << 10 + (low - 0xDC00) + 0x10000
+			}
+			parser.pos = start
+		}
+		if parser.strict {
+			parser.fail("unpaired surrogate in unicode escape")
+		}
+	case r >= 0xDC00 && r < 0xE000 && parser.strict:
+		parser.fail("unpaired surrogate in unicode escape")
+	}
+	return r
+}
+
+var (
+	numberRegex         = regexp.MustCompile(`^-?\d+(\.\d+)?([eE][-+]?\d+)?`)
+	strictNumberRegex   = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?([eE][-+]?\d+)?`)
+	integerRegex        = regexp.MustCompile(`^-?\d+`)
+	strictIntegerRegex  = regexp.MustCompile(`^(0|-?[1-9]\d*)$`)
+)
+
+// The largest magnitude of an index or slice parameter in strict mode (the I-JSON range of exact integers).
+const maxStrictInteger = 1<<53 - 1
+
+// Parses a number literal.
+func (parser *filterParser) number() float64 {
+	numberRegex := numberRegex
+	if parser.strict {
+		numberRegex = strictNumberRegex
+	}
+	literal := numberRegex.FindString(parser.source[parser.pos:])
+	if literal == "" {
+		parser.fail("invalid number")
+	}
+	number, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		parser.fail("invalid number %q", literal)
+	}
+	parser.pos += len(literal)
+	return number
+}
+
+// Parses an integer (used within index and slice selectors).
+func (parser *filterParser) integer() int {
+	parser.skip()
+	literal := integerRegex.FindString(parser.source[parser.pos:])
+	if literal == "" {
+		parser.fail("expected an integer")
+	}
+	integer, err := strconv.Atoi(literal)
+	if err != nil || parser.strict && (!strictIntegerRegex.MatchString(literal) || integer > maxStrictInteger || integer < -maxStrictInteger) {
+		parser.fail("invalid integer %q", literal)
+	}
+	parser.pos += len(literal)
+	return integer
+}
+
+// Parses a regular expression literal (/pattern/flags). The i, m and s flags are supported.
+func (parser *filterParser) regex() *regexp.Regexp {
+	parser.pos++
+	var b strings.Builder
+	for {
+		if parser.pos >= len(parser.source) {
+			parser.fail("unterminated regular expression")
+		}
+		c := parser.source[parser.pos]
+		parser.pos++
+		if c == '/' {
+			break
+		}
+		if c == '\\' && parser.pos < len(parser.source) && parser.source[parser.pos] == '/' {
+			c = '/'
+			parser.pos++
+		} else if c == '\\' && parser.pos < len(parser.source) {
+			b.WriteByte(c)
+			c = parser.source[parser.pos]
+			parser.pos++
+		}
+		b.WriteByte(c)
+	}
+
+	flags := ""
+	for parser.pos < len(parser.source) && strings.ContainsRune("gimsuy", rune(parser.source[parser.pos])) {
+		if flag := parser.source[parser.pos]; strings.ContainsRune("ims", rune(flag)) && !strings.ContainsRune(flags, rune(flag)) {
+			flags += string(flag)
+		}
+		parser.pos++
+	}
+	pattern := b.String()
+	if flags != "" {
+		pattern = fmt.Sprintf("(?%s)%s", flags, pattern)
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		parser.fail("invalid regular expression %q: %v", pattern, err)
+	}
+	return compiled
+}
+
+// Parses the segments of a query after "@" or "$". In strict mode segments can be preceded by whitespace.
+func (parser *filterParser) segments() (segments []segment) {
+	segments = make([]segment, 0)
+	for {
+		start := parser.pos
+		if parser.strict {
+			parser.skip()
+		}
+		switch {
+		case strings.HasPrefix(parser.source[parser.pos:], ".."):
+			parser.pos += 2
+			descendant := segment{descendant: true}
+			switch {
+			case strings.HasPrefix(parser.source[parser.pos:], "["):
+				parser.pos++
+				descendant.selectors = parser.selectors()
+			case strings.HasPrefix(parser.source[parser.pos:], "*"):
+				parser.pos++
+				descendant.selectors = []selector{{kind: wildcardSelector}}
+			default:
+				descendant.selectors = []selector{{kind: nameSelector, name: parser.name()}}
+			}
+			segments = append(segments, descendant)
+		case strings.HasPrefix(parser.source[parser.pos:], "."):
+			parser.pos++
+			if strings.HasPrefix(parser.source[parser.pos:], "*") {
+				parser.pos++
+				segments = append(segments, segment{selectors: []selector{{kind: wildcardSelector}}})
+			} else {
+				segments = append(segments, segment{selectors: []selector{{kind: nameSelector, name: parser.name(), dotted: !parser.strict}}})
+			}
+		case strings.HasPrefix(parser.source[parser.pos:], "["):
+			parser.pos++
+			segments = append(segments, segment{selectors: parser.selectors()})
+		default:
+			parser.pos = start
+			return segments
+		}
+	}
+}
+
+// Parses the comma separated selectors within brackets, after the opening bracket.
+func (parser *filterParser) selectors() (selectors []selector) {
+	selectors = make([]selector, 0)
+	for {
+		parser.skip()
+		if parser.pos >= len(parser.source) {
+			parser.fail("unterminated selector")
+		}
+		switch c := parser.source[parser.pos]; {
+		case c == '*':
+			parser.pos++
+			selectors = append(selectors, selector{kind: wildcardSelector})
+		case c == '\'' || c == '"':
+			selectors = append(selectors, selector{kind: nameSelector, name: parser.string()})
+		case c == '?':
+			parser.pos++
+			selectors = append(selectors, selector{kind: filterSelector, filter: parser.or()})
+		default:
+			selectors = append(selectors, parser.indexOrSlice())
+		}
+		if parser.consume("]") {
+			return selectors
+		}
+		parser.expect(",")
+	}
+}
+
+// Parses an index selector ([n]) or a slice selector ([start:end:step]).
+func (parser *filterParser) indexOrSlice() selector {
+	var slice [3]*int
+	part := 0
+	for {
+		if !parser.peek(":") && !parser.peek("]") && !parser.peek(",") {
+			integer := parser.integer()
+			slice[part] = &integer
+		}
+		if part == 2 || !parser.consume(":") {
+			break
+		}
+		part++
+	}
+	switch {
+	case part == 0 && slice[0] != nil:
+		return selector{kind: indexSelector, index: *slice[0]}
+	case part == 0:
+		parser.fail("expected a selector")
+	}
+	return selector{kind: sliceSelector, slice: slice}
+}
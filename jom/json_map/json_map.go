@@ -2,6 +2,8 @@
 // AbsolutePaths and JSON path parsing to AbsolutePaths.
 package json_map
 
+import "context"
+
 // Acts as an interface for jom.JsonMap.
 //
 // Primarily created to stop cyclic imports.
@@ -20,6 +22,8 @@ type JsonMapInt interface {
 	IsArray() bool
 	// Given a valid JSON path will return the list of pointers to json_map.JsonPathNode(s) that satisfies the JSON path.
 	JsonPathSelector(jsonPath string) (out []*JsonPathNode, err error)
+	// Like JsonPathSelector, only the JSON path is parsed and evaluated in strict mode (RFC 9535).
+	JsonPathSelectorStrict(jsonPath string) (out []*JsonPathNode, err error)
 	// Given a valid JSON path: will set the values pointed to by the JSON path to be the value given.
 	JsonPathSetter(jsonPath string, value interface{}) (err error)
 	// Adds the given script of the given shebangName (must be a supported language) at the path pointed to by the given jsonPath.
@@ -36,14 +40,37 @@ type JsonMapInt interface {
 	MustPush(jsonPath string, value interface{}, indices... int)
 	// Like JsonPathSetter, only it panics when an error occurs.
 	MustSet(jsonPath string, value interface{})
+	// Deletes the value pointed to by the given JSON pointer (RFC 6901).
+	PointerDelete(pointer string) (err error)
+	// Returns the value pointed to by the given JSON pointer (RFC 6901).
+	PointerGet(pointer string) (value interface{}, err error)
+	// Sets the value pointed to by the given JSON pointer (RFC 6901) to the given value.
+	PointerSet(pointer string, value interface{}) (err error)
+	// Returns the JsonMap of the scope enclosing the JsonMap's scope within the document that it is being evaluated
+	// within. Returns nil if the JsonMap is the root, or if it is not being evaluated.
+	Parent() JsonMapInt
+	// Returns the JsonMap at the root of the document that the JsonMap is being evaluated within. This is the JsonMap
+	// itself if it is the root, or if it is not being evaluated.
+	Root() JsonMapInt
 	// Given a JsonMap this will traverse it and execute all scripts. Will update the given JsonMap in place.
 	Run()
+	// Like Run, only all scripts will stop running once the given context is done.
+	RunContext(ctx context.Context)
 	// Given the list of absolute paths for a JsonMap: will set the values pointed to by the given JSON path to be the given value.
 	SetAbsolutePaths(absolutePaths *AbsolutePaths, value interface{}) (err error)
+	// Like Marshal, only no other scopes within the document that the JsonMap is being evaluated within can modify the
+	// document whilst it is being marshalled.
+	Snapshot() (out []byte, err error)
 	// Strips any script key-value pairs found within the JsonMap and updates it in place.
 	Strip()
 	// Marshals the JsonMap into hjson and returns the stringified byte array.
 	String() string
 	// Unmarshal a hjson byte string and package it as a JsonMap.
 	Unmarshal(jsonBytes []byte) (err error)
+	// Updates the JsonMap in place so that it is equal to the given insides. Returns an error, without updating the
+	// JsonMap, if the length of an array which contains objects would be changed.
+	Update(insides map[string]interface{}) (err error)
+	// Returns the variables given to the evaluation of the document that the JsonMap is being evaluated within (see
+	// code.RunOptions.Vars). Returns an empty map if no variables were given, or if it is not being evaluated.
+	Vars() map[string]interface{}
 }
@@ -2,6 +2,7 @@ package json_map
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	str "github.com/andygello555/gotils/strings"
 	"github.com/andygello555/json-dom/globals"
@@ -23,14 +24,32 @@ type state struct {
 	validator  func(token []byte, togo []byte) (absolutePathKeys []AbsolutePathKey, errs []error)
 }
 
+const (
+	// A member name that can be given without quotes. This can contain any non-ASCII characters (including combining
+	// marks), ASCII letters, digits, underscores and hyphens, but cannot start with a digit or hyphen.
+	propertyPattern = "[a-zA-Z_\\x{80}-\\x{10FFFF}][a-zA-Z0-9_\\x{80}-\\x{10FFFF}-]*"
+	// One or more comma separated single or double quoted member names within square brackets.
+	quotedPattern   = "\\[\\s*('([^'\\\\]|\\\\.)*'|\"([^\"\\\\]|\\\\.)*\")(\\s*,\\s*('([^'\\\\]|\\\\.)*'|\"([^\"\\\\]|\\\\.)*\"))*\\s*]"
+)
+
+var (
+	// Matches member names that can be given without quotes.
+	propertyName = regexp.MustCompile("^" + propertyPattern + "$")
+	// Used by the index validator to find which kind of index a token is. These are compiled once rather than every
+	// time a token is validated.
+	singleIndex  = regexp.MustCompile("\\[\\d+]")
+	indexList    = regexp.MustCompile("\\[\\d+(,\\s*\\d+)*]")
+	digits       = regexp.MustCompile("\\d+")
+)
+
 var (
 	property = state{
 		name:       "Property (property)",
-		tokenRegex: regexp.MustCompile("([a-zA-Z_]+([a-zA-Z0-9_-]*)|\\*)"),
+		tokenRegex: regexp.MustCompile("(" + propertyPattern + "|\\*)"),
 		validator:  func(token []byte, togo []byte) (absolutePathKeys []AbsolutePathKey, errs []error) {
 			absolutePathKeys = make([]AbsolutePathKey, 0)
 			switch {
-			case regexp.MustCompile("\\*").Match(token):
+			case string(token) == "*":
 				// If the property is a wildcard then append an AbsolutePathKey of type wildcard to the end of all paths
 				absolutePathKeys = append(absolutePathKeys, AbsolutePathKey{
 					KeyType: Wildcard,
@@ -46,6 +65,25 @@ var (
 			return absolutePathKeys, nil
 		},
 	}
+	quotedProperty = state{
+		name:       "Quoted property (['property'])",
+		tokenRegex: regexp.MustCompile(quotedPattern),
+		validator:  func(token []byte, togo []byte) (absolutePathKeys []AbsolutePathKey, errs []error) {
+			names, err := unquoteNames(string(token))
+			if err != nil {
+				return nil, []error{err}
+			}
+			// Each member name is appended as a StringKey. If there is more than one name then this creates a union
+			absolutePathKeys = make([]AbsolutePathKey, len(names))
+			for i, name := range names {
+				absolutePathKeys[i] = AbsolutePathKey{
+					KeyType: StringKey,
+					Value:   name,
+				}
+			}
+			return absolutePathKeys, nil
+		},
+	}
 	filter = state{
 		name:       "Filter Expression ([?(...)])",
 		// We allow anything to be written as a filter expression as it will be passed to otto which will parse the
@@ -55,7 +93,7 @@ var (
 			// We just add the expression body to the absolute path keys
 			absolutePathKeys = []AbsolutePathKey{{
 				KeyType: Filter,
-				Value:   string(regexp.MustCompile("(\\[\\?\\(|\\)])").ReplaceAll(token, []byte(""))),
+				Value:   string(token[len("[?("):len(token) - len(")]")]),
 			}}
 			return absolutePathKeys, nil
 		},
@@ -68,21 +106,21 @@ var (
 		validator:  func(token []byte, togo []byte) (absolutePathKeys []AbsolutePathKey, errs []error) {
 			// Function to remove square braces and whitespace then split at the given separator
 			stripSplitIndex := func(token []byte, separator string) []string {
-				return strings.Split(str.StripWhitespace(string(regexp.MustCompile("[\\[\\]]").ReplaceAll(token, []byte("")))), separator)
+				return strings.Split(str.StripWhitespace(strings.Trim(string(token), "[]")), separator)
 			}
 
 			// Create an array of AbsolutePathKeys which will be added to the AbsolutePaths at the end
 			absolutePathKeys = make([]AbsolutePathKey, 0)
 			switch {
-			case regexp.MustCompile("\\[\\d+]").Match(token):
+			case singleIndex.Match(token):
 				// Normal array index
-				n, err := strconv.Atoi(string(regexp.MustCompile("\\d+").Find(token)))
+				n, err := strconv.Atoi(string(digits.Find(token)))
 				if err != nil {
 					return absolutePathKeys, []error{globals.JsonPathError.FillError(fmt.Sprintf("Could not convert index %s into an integer", string(token)))}
 				}
 				// Add n to the end of all absolute paths
 				absolutePathKeys = append(absolutePathKeys, AbsolutePathKey{KeyType: IndexKey, Value: n})
-			case regexp.MustCompile("\\[\\d+(,\\s*\\d+)*]").Match(token):
+			case indexList.Match(token):
 				// Comma separated list of indexes
 				// 1. Remove open/close brackets
 				// 2. Strip all whitespace
@@ -97,13 +135,13 @@ var (
 						Value:   indexInt,
 					})
 				}
-			case regexp.MustCompile("\\[\\*]").Match(token):
+			case string(token) == "[*]":
 				// For wildcards we just add a AbsoluteKeyPath of the Wildcard type
 				absolutePathKeys = append(absolutePathKeys, AbsolutePathKey{
 					KeyType: Wildcard,
 					Value:   nil,
 				})
-			case regexp.MustCompile(":").Match(token):
+			case bytes.ContainsRune(token, ':'):
 				// Array slices are parsed into an array [start, end]. This is of type []AbsolutePathKey to accommodate
 				// empty start and end slices using the StartEnd AbsolutePathKeyType
 				slice := make([]AbsolutePathKey, 0)
@@ -162,14 +200,23 @@ var (
 	}
 	recursiveLookup = state{
 		name:       "Recursive lookup (.property)",
-		// Similar to property state but with a '.' at the front
-		tokenRegex: regexp.MustCompile("\\.\\.[a-zA-Z_]+([a-zA-Z0-9_-]*)"),
+		// Similar to property and quoted property states but with a '..' at the front
+		tokenRegex: regexp.MustCompile("\\.\\.(" + propertyPattern + "|" + quotedPattern + ")"),
 		validator:  func(token []byte, togo []byte) (absolutePathKeys []AbsolutePathKey, errs []error) {
-			absolutePathKeys = make([]AbsolutePathKey, 1)
 			// Create an absolute path key from the token[2:]
-			absolutePathKeys[0] = AbsolutePathKey{
-				KeyType: RecursiveLookup,
-				Value:   string(token[2:]),
+			names := []string{string(token[2:])}
+			if token[2] == '[' {
+				var err error
+				if names, err = unquoteNames(string(token[2:])); err != nil {
+					return nil, []error{err}
+				}
+			}
+			absolutePathKeys = make([]AbsolutePathKey, len(names))
+			for i, name := range names {
+				absolutePathKeys[i] = AbsolutePathKey{
+					KeyType: RecursiveLookup,
+					Value:   name,
+				}
 			}
 			return absolutePathKeys, nil
 		},
@@ -198,12 +245,50 @@ var (
 // Note: recursiveLookup will always takes precedence over dot. This is to ensure that recursive lookups are consumed first.
 var fromStateToStates = map[string][]*state{
 	"Start": {},
-	"Root node ($)": {&recursiveLookup, &dot, &index, &filter},
-	"Recursive lookup (.property)": {&recursiveLookup, &dot, &index, &filter},
-	"Dot (.)": {&recursiveLookup, &dot, &index, &filter, &property},
-	"Array Index ([n])": {&recursiveLookup, &index, &dot, &filter},
-	"Property (property)": {&recursiveLookup, &dot, &index, &filter},
-	"Filter Expression ([?(...)])": {&recursiveLookup, &dot, &index, &filter},
+	"Root node ($)": {&recursiveLookup, &dot, &quotedProperty, &index, &filter},
+	"Recursive lookup (.property)": {&recursiveLookup, &dot, &quotedProperty, &index, &filter},
+	"Dot (.)": {&recursiveLookup, &dot, &quotedProperty, &index, &filter, &property},
+	"Array Index ([n])": {&recursiveLookup, &quotedProperty, &index, &dot, &filter},
+	"Property (property)": {&recursiveLookup, &dot, &quotedProperty, &index, &filter},
+	"Quoted property (['property'])": {&recursiveLookup, &dot, &quotedProperty, &index, &filter},
+	"Filter Expression ([?(...)])": {&recursiveLookup, &dot, &quotedProperty, &index, &filter},
+}
+
+// Sets all token regexes to always find the longest match. This is done once as Longest modifies the regex, so it
+// cannot be called while JSON paths are being parsed concurrently.
+func init() {
+	for _, state := range []*state{&root, &dot, &index, &filter, &property, &quotedProperty, &recursiveLookup} {
+		state.tokenRegex.Longest()
+	}
+}
+
+// Unquotes the comma separated member names within the given quoted property token (e.g. ['a', "b"]). Member names
+// can contain the same escape sequences as string literals in filter expressions.
+func unquoteNames(token string) (names []string, err error) {
+	parser := &filterParser{source: token, pos: 1}
+	err = parser.parse("quoted property", func() {
+		for {
+			parser.skip()
+			names = append(names, parser.string())
+			if !parser.consume(",") {
+				break
+			}
+		}
+		parser.expect("]")
+	})
+	return names, err
+}
+
+// Appends the given member name to the given JSON path. The member name is appended as a property (.name) if it can
+// be given without quotes, otherwise it is appended as a quoted property (['name']).
+func AppendMember(jsonPath string, name string) string {
+	if propertyName.MatchString(name) {
+		return jsonPath + "." + name
+	}
+	var b strings.Builder
+	b.WriteString(jsonPath)
+	writeQuotedName(&b, name)
+	return b.String()
 }
 
 // Will decide the next state given a list of possible states and call the validator for that next state.
@@ -263,10 +348,6 @@ func ParseJsonPath(jsonPath string) (absolutePaths AbsolutePaths, err error) {
 	currentState := &root
 	jsonPathReader := bufio.NewReader(strings.NewReader(jsonPath))
 
-	for _, state := range []*state{&root, &dot, &index, &filter, &property, &recursiveLookup} {
-		state.tokenRegex.Longest()
-	}
-
 	for {
 		// Break out if at finish state
 		if currentState.name == "End" {
@@ -0,0 +1,123 @@
+package json_map
+
+import (
+	"fmt"
+	"github.com/andygello555/json-dom/globals"
+	"strings"
+)
+
+// A JSON path parsed in strict mode, which only accepts the syntax of RFC 9535 and evaluates it with the semantics of
+// RFC 9535. This is intended for JSON paths that are shared with other JSONPath implementations.
+//
+// The differences to the JSON paths parsed by ParseJsonPath are:
+//
+// • Any number of names, indices, slices, wildcards and filters can be mixed within brackets ($['a','b', 0, ?@.c]).
+//
+// • Slices can have a step ($[::2], $[::-1]) and "[:]" is supported.
+//
+// • The descendant segment ("..") can be followed by a wildcard ($..*) or brackets ($..[0]).
+//
+// • There is no first descent ("...") and member name shorthands cannot contain hyphens.
+//
+// • Filter expressions only support the syntax of RFC 9535 (see ParseFilter). "typeof", "in", "nin", "=~", array and
+// regular expression literals, and ".length" on strings and arrays are not supported. Function arguments, comparisons
+// and test expressions must be well-typed.
+//
+// • Paths that select nothing result in no nodes rather than an error.
+type StrictJsonPath struct {
+	source string
+	query  *queryNode
+}
+
+// Parses the given JSON path in strict mode (RFC 9535). Returns a globals.JsonPathError if the path is not a
+// well-formed and valid RFC 9535 JSON path.
+func ParseJsonPathStrict(jsonPath string) (path *StrictJsonPath, err error) {
+	parser := &filterParser{source: jsonPath, strict: true}
+	path = &StrictJsonPath{source: jsonPath}
+	if err = parser.parse("JSON path", func() {
+		if !strings.HasPrefix(jsonPath, "$") {
+			parser.fail("expected \"$\"")
+		}
+		parser.pos++
+		path.query = &queryNode{absolute: true, segments: parser.segments()}
+		// Unlike filter expressions, trailing whitespace is not allowed
+		if parser.pos < len(parser.source) {
+			parser.fail("unexpected %q", parser.source[parser.pos:])
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+// Returns the nodes selected by the JSON path from the given root value (a decoded JSON value). The absolute path of
+// each node consists of StringKey and IndexKeys from the given root, and can be formatted using NormalizedPath.
+//
+// Arrays are traversed in order and the members of objects are traversed in the lexicographical order of their keys.
+func (path *StrictJsonPath) Select(root interface{}) (out []*JsonPathNode) {
+	located := path.query.locate(&filterContext{current: root, root: root}, true)
+	out = make([]*JsonPathNode, len(located))
+	for i, node := range located {
+		out[i] = &JsonPathNode{Absolute: node.path, Value: node.value}
+	}
+	return out
+}
+
+// Whether the JSON path is a singular query. That is, it can select at most one node.
+func (path *StrictJsonPath) Singular() bool {
+	return path.query.singular()
+}
+
+// Returns the source of the JSON path.
+func (path *StrictJsonPath) String() string {
+	return path.source
+}
+
+// Formats the given absolute path, consisting of StringKey and IndexKeys, as an RFC 9535 normalized path (e.g.
+// $['a'][0]). Returns an error if the path contains any other AbsolutePathKeyType.
+func NormalizedPath(absolute []AbsolutePathKey) (string, error) {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, key := range absolute {
+		switch key.KeyType {
+		case StringKey:
+			writeQuotedName(&b, key.Value.(string))
+		case IndexKey:
+			_, _ = fmt.Fprintf(&b, "[%d]", key.Value)
+		default:
+			return "", globals.JsonPathError.FillError(fmt.Sprintf("Cannot format %s as a normalized path", key))
+		}
+	}
+	return b.String(), nil
+}
+
+// Writes the given member name to the given builder as a single quoted name selector (e.g. ['a']), escaping it as in
+// a normalized path.
+func writeQuotedName(b *strings.Builder, name string) {
+	b.WriteString("['")
+	for _, r := range name {
+		switch r {
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '\\':
+			b.WriteString(`\\`)
+		default:
+			if r < 0x20 {
+				_, _ = fmt.Fprintf(b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteString("']")
+}
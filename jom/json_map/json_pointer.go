@@ -0,0 +1,62 @@
+package json_map
+
+import (
+	"fmt"
+	"github.com/andygello555/json-dom/globals"
+	"strconv"
+	"strings"
+)
+
+// The reference token of a JSON pointer that refers to the (nonexistent) element after the last element of an array.
+const PointerEnd = "-"
+
+// Parses the given JSON pointer (RFC 6901), such as "/people/0/name", into AbsolutePaths containing a single absolute
+// path. The empty JSON pointer ("") refers to the root and is parsed into a single empty absolute path.
+//
+// Reference tokens which are array indices (0, or digits without a leading zero) are parsed into IndexKeys, and all
+// other reference tokens (including PointerEnd) are parsed into StringKeys. As JSON pointers do not distinguish between
+// object members and array elements, an IndexKey refers to the member of that name when it is applied to an object.
+//
+// Returns a globals.JsonPointerError if the JSON pointer does not start with "/" or contains an invalid escape.
+func ParseJsonPointer(pointer string) (absolutePaths AbsolutePaths, err error) {
+	absolutePath := make([]AbsolutePathKey, 0)
+	if pointer != "" {
+		if !strings.HasPrefix(pointer, "/") {
+			return nil, globals.JsonPointerError.FillError(fmt.Sprintf("\"%s\" does not start with \"/\"", pointer))
+		}
+		for _, token := range strings.Split(pointer[1:], "/") {
+			// "~" can only be followed by "0" (an escaped "~") or "1" (an escaped "/")
+			for i := 0; i < len(token); i++ {
+				if token[i] == '~' && (i == len(token) - 1 || token[i + 1] != '0' && token[i + 1] != '1') {
+					return nil, globals.JsonPointerError.FillError(fmt.Sprintf("\"%s\" contains an invalid escape in \"%s\"", pointer, token))
+				}
+			}
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+
+			if index, err := strconv.Atoi(token); err == nil && index >= 0 && strconv.Itoa(index) == token {
+				absolutePath = append(absolutePath, AbsolutePathKey{KeyType: IndexKey, Value: index})
+			} else {
+				absolutePath = append(absolutePath, AbsolutePathKey{KeyType: StringKey, Value: token})
+			}
+		}
+	}
+	return AbsolutePaths{absolutePath}, nil
+}
+
+// Formats the given absolute path, consisting of StringKey and IndexKeys, as a JSON pointer (RFC 6901) (e.g.
+// /people/0/name). Returns a globals.JsonPointerError if the path contains any other AbsolutePathKeyType.
+func JsonPointer(absolute []AbsolutePathKey) (string, error) {
+	var b strings.Builder
+	for _, key := range absolute {
+		switch key.KeyType {
+		case StringKey:
+			b.WriteString("/")
+			b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(key.Value.(string)))
+		case IndexKey:
+			_, _ = fmt.Fprintf(&b, "/%d", key.Value)
+		default:
+			return "", globals.JsonPointerError.FillError(fmt.Sprintf("Cannot format %s as a JSON pointer", key))
+		}
+	}
+	return b.String(), nil
+}
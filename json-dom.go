@@ -2,15 +2,24 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/andygello555/gotils/files"
+	_ "github.com/andygello555/json-dom/code/es"
 	_ "github.com/andygello555/json-dom/code/go"
+	_ "github.com/andygello555/json-dom/code/gosrc"
+	_ "github.com/andygello555/json-dom/code/jq"
 	_ "github.com/andygello555/json-dom/code/js"
+	_ "github.com/andygello555/json-dom/code/lua"
+	_ "github.com/andygello555/json-dom/code/star"
+	_ "github.com/andygello555/json-dom/code/tmpl"
+	_ "github.com/andygello555/json-dom/code/wasm"
 	"github.com/andygello555/json-dom/globals"
 	"github.com/andygello555/json-dom/jom"
 	"github.com/andygello555/json-dom/jom/json_map"
+	"github.com/hjson/hjson-go"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -86,7 +95,68 @@ func (jpscp *JsonPathScriptPair) Set(value string) error {
 	return nil
 }
 
-// usage: json-dom { eval | markup [-language <language>] [-eval] [-strip] <key>:<value>,... } { -input <input> | -files <file>... } [-verbose]
+// Flag Type for a list of variables given as key-value pairs. The flag can be given multiple times
+type Vars map[string]interface{}
+
+// Returns the String representation of the Vars flag
+func (v *Vars) String() string {
+	return fmt.Sprintf("%v", *v)
+}
+
+// Sets a variable within the Vars flag
+func (v *Vars) Set(value string) error {
+	keyValue := strings.SplitN(value, globals.VarDelim, 2)
+	if len(keyValue) != 2 || keyValue[0] == "" {
+		return errors.New(fmt.Sprintf("%v is not a variable (syntax is \"<key>%s<value>\")", value, globals.VarDelim))
+	}
+	if *v == nil {
+		*v = make(Vars)
+	}
+	(*v)[keyValue[0]] = keyValue[1]
+	return nil
+}
+
+// Flag Type for a list of files containing variables. The flag can be given multiple times
+type VarFiles []string
+
+// Returns the String representation of the VarFiles flag
+func (s *VarFiles) String() string {
+	return fmt.Sprintf("%v", *s)
+}
+
+// Adds a file to the VarFiles flag
+func (s *VarFiles) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// Reads the variables within each of the given hjson files and merges them with the given variables. Variables within
+// later files override those within earlier files, and the given variables override those within any file.
+func readVars(varFiles VarFiles, vars Vars) map[string]interface{} {
+	merged := make(map[string]interface{})
+	for _, file := range varFiles {
+		if !files.IsFile(file) {
+			globals.FileDoesNotExistErr.Handle(errors.New(file))
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			globals.ReadFileErr.Handle(err)
+		}
+		fileVars := make(map[string]interface{})
+		if err = hjson.Unmarshal(data, &fileVars); err != nil {
+			globals.UnmarshalErr.Handle(errors.New(fmt.Sprintf("var file: %s, err: %v", file, err)))
+		}
+		for key, value := range fileVars {
+			merged[key] = value
+		}
+	}
+	for key, value := range vars {
+		merged[key] = value
+	}
+	return merged
+}
+
+// usage: json-dom { eval | markup [-language <language>] [-eval] [-strip] <key>:<value>,... } { -input <input> | -files <file>... } [-var <key>=<value>]... [-var-file <file>]... [-wasm-paths] [-verbose]
 
 func main() {
 	// Subcommands
@@ -107,6 +177,15 @@ func main() {
 		subcommandMap[key]["input"] = flagSet.String("input", "", "The json-dom object to read in (required if <file> is not given)")
 		subcommandMap[key]["verbose"] = flagSet.Bool("verbose", false, "Verbose output")
 
+		// Add the variable flags which can be given multiple times
+		vars := new(Vars)
+		subcommandMap[key]["var"] = vars
+		flagSet.Var(vars, "var", fmt.Sprintf("A variable which scripts can read using json.vars. Format: \"<key>%s<value>\" (can be given multiple times)", globals.VarDelim))
+		varFiles := new(VarFiles)
+		subcommandMap[key]["var-file"] = varFiles
+		flagSet.Var(varFiles, "var-file", "An hjson file containing an object of variables which scripts can read using json.vars (can be given multiple times)")
+		subcommandMap[key]["wasm-paths"] = flagSet.Bool("wasm-paths", false, "Allow wasm scripts to be paths to WebAssembly modules on the host rather than only base64 encoded modules")
+
 		// Add the extra JsonPathScriptPair flag, language flag and eval flag to the markup subcommand
 		if key == "markup" {
 			keyValPair := new(JsonPathScriptPair)
@@ -156,11 +235,9 @@ func main() {
 			for flagKey, flagElement := range element {
 				if flagKey != "flagSet" {
 					switch flagKey {
-					case "path-scripts":
-						fallthrough
-					case "files":
+					case "path-scripts", "files", "var", "var-file":
 						fmt.Printf(formatString, flagKey, flagElement)
-					case "verbose", "eval", "strip":
+					case "verbose", "eval", "strip", "wasm-paths":
 						fmt.Printf(formatString, flagKey, *flagElement.(*bool))
 					default:
 						// Default just casts the pointer to a string pointer and takes the value at the location
@@ -174,6 +251,10 @@ func main() {
 			// Recast the pointers
 			filesPtr := element["files"].(*Files)
 			inputPtr := element["input"].(*string)
+			options := jom.RunOptions{
+				Vars:            readVars(*element["var-file"].(*VarFiles), *element["var"].(*Vars)),
+				WasmModulePaths: *element["wasm-paths"].(*bool),
+			}
 
 			dataSet := make(map[string][]byte, 0)
 			if len(*filesPtr) != 0 || *inputPtr != "" {
@@ -227,7 +308,7 @@ func main() {
 				switch subcommand {
 				case "eval":
 					// Evaluate the json-dom object
-					eval, err := jom.Eval(data, verbose)
+					eval, err := jom.EvalWithOptions(context.Background(), data, verbose, options)
 					if err != nil {
 						globals.EvaluationErr.Handle(err)
 					}
@@ -276,7 +357,7 @@ func main() {
 						}
 
 						var evalOut []byte
-						evalOut, err = jom.Eval(data, verbose)
+						evalOut, err = jom.EvalWithOptions(context.Background(), data, verbose, options)
 						if err != nil {
 							globals.EvaluationErr.Handle(err)
 						}
@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"context"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"strings"
+	"testing"
+)
+
+var budgetTable = []struct{
+	name    string
+	script  interface{}
+	options jom.RunOptions
+	// The error that should be panicked. Empty if no error should be panicked
+	err     globals.RuntimeError
+}{
+	{
+		name:    "script_length",
+		script:  "#//!js\njson.trail.hello = \"js\";",
+		options: jom.RunOptions{MaxScriptLength: 16},
+		err:     globals.BudgetExceeded,
+	},
+	{
+		name:    "script_length_within",
+		script:  "#//!js\njson.trail.hello = \"js\";",
+		options: jom.RunOptions{MaxScriptLength: 64},
+	},
+	{
+		name:    "scope_bytes_js",
+		script:  "#//!js\njson.trail.hello = new Array(100).join(\"js\");",
+		options: jom.RunOptions{MaxScopeBytes: 64},
+		err:     globals.BudgetExceeded,
+	},
+	{
+		name:    "scope_bytes_lua",
+		script:  "#//!lua\njson.trail.hello = string.rep(\"lua\", 100)",
+		options: jom.RunOptions{MaxScopeBytes: 64},
+		err:     globals.BudgetExceeded,
+	},
+	{
+		name:    "scope_bytes_es",
+		script:  "#//!es\njson.trail.hello = \"es\".repeat(100);",
+		options: jom.RunOptions{MaxScopeBytes: 64},
+		err:     globals.BudgetExceeded,
+	},
+	{
+		name:    "scope_bytes_star",
+		script:  "#//!star\njson.trail[\"hello\"] = \"star\" * 100",
+		options: jom.RunOptions{MaxScopeBytes: 64},
+		err:     globals.BudgetExceeded,
+	},
+	{
+		name:    "scope_bytes_jq",
+		script:  "#//!jq\n.hello = (\"jq\" * 100)",
+		options: jom.RunOptions{MaxScopeBytes: 64},
+		err:     globals.BudgetExceeded,
+	},
+	{
+		name:    "scope_bytes_gosrc",
+		script:  "#//!gosrc\nimport (\n\t\"strings\"\n\t\"github.com/andygello555/json-dom/jom/json_map\"\n)\n\nfunc Run(json json_map.JsonMapInt) {\n\tjson.MustSet(\"$.hello\", strings.Repeat(\"gosrc\", 100))\n}",
+		options: jom.RunOptions{MaxScopeBytes: 64},
+		err:     globals.BudgetExceeded,
+	},
+	{
+		name:    "scope_bytes_go",
+		script:  func(json json_map.JsonMapInt) {
+			json.MustSet("$.hello", strings.Repeat("go", 100))
+		},
+		options: jom.RunOptions{MaxScopeBytes: 64},
+		err:     globals.BudgetExceeded,
+	},
+	{
+		name:    "scope_bytes_expression",
+		script:  "#//!js=\nnew Array(100).join(\"js\")",
+		options: jom.RunOptions{MaxScopeBytes: 64},
+		err:     globals.BudgetExceeded,
+	},
+	{
+		name:    "scope_bytes_within",
+		script:  "#//!js\njson.trail.hello = \"js\";",
+		options: jom.RunOptions{MaxScopeBytes: 64},
+	},
+	{
+		name:    "scope_nodes_js",
+		script:  "#//!js\njson.trail.list = [];\nfor (var i = 0; i < 100; i++) { json.trail.list.push(i); }",
+		options: jom.RunOptions{MaxScopeNodes: 50},
+		err:     globals.BudgetExceeded,
+	},
+	{
+		name:    "scope_nodes_go",
+		script:  func(json json_map.JsonMapInt) {
+			list := make([]interface{}, 100)
+			for i := range list {
+				list[i] = float64(i)
+			}
+			json.MustSet("$.list", list)
+		},
+		options: jom.RunOptions{MaxScopeNodes: 50},
+		err:     globals.BudgetExceeded,
+	},
+	{
+		name:    "scope_nodes_within",
+		script:  "#//!js\njson.trail.list = [1, 2, 3];",
+		options: jom.RunOptions{MaxScopeNodes: 50},
+	},
+	{
+		name:    "instructions_star",
+		script:  "#//!star\ni = 0\nwhile True:\n\ti += 1",
+		options: jom.RunOptions{MaxInstructions: 10000},
+		err:     globals.BudgetExceeded,
+	},
+	{
+		name:    "instructions_star_within",
+		script:  "#//!star\njson.trail[\"hello\"] = \"star\"",
+		options: jom.RunOptions{MaxInstructions: 10000},
+	},
+}
+
+func TestBudgets(t *testing.T) {
+	for _, test := range budgetTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(`{"hello": "world"}`)); err != nil {
+				tt.Errorf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			jsonMap.MustSet("$.script", test.script)
+
+			defer func() {
+				caught := recover()
+				if test.err == (globals.RuntimeError{}) {
+					if caught != nil {
+						tt.Errorf("Script panicked: %v", caught)
+					}
+					return
+				}
+				if err, ok := caught.(error); !ok || !strings.HasPrefix(err.Error(), test.err.FillError().Error()) {
+					tt.Errorf("Expected \"%s\" but got: %v", test.err.FillError().Error(), caught)
+				}
+			}()
+			jsonMap.RunWithOptions(context.Background(), test.options)
+		})
+	}
+}
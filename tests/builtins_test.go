@@ -0,0 +1,247 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/andygello555/json-dom/code/js"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"github.com/robertkrimen/otto"
+	"strings"
+	"testing"
+)
+
+type builtinsPerson struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+var builtinsTable = []struct{
+	name     string
+	builtins map[string]interface{}
+	script   string
+	// The expected output. Empty if an error should be panicked
+	expected string
+	// The error that should be panicked
+	err      globals.RuntimeError
+}{
+	{
+		name:     "primitives",
+		builtins: map[string]interface{}{
+			"add": func(a int, b int) int { return a + b },
+			"upper": strings.ToUpper,
+		},
+		script:   "#//!js\njson.trail.sum = add(1, 2); json.trail.upper = upper(\"abc\");",
+		expected: `{"sum":3,"upper":"ABC"}`,
+	},
+	{
+		name:     "structs",
+		builtins: map[string]interface{}{
+			"birthday": func(person builtinsPerson) builtinsPerson {
+				person.Age++
+				return person
+			},
+		},
+		script:   "#//!js\njson.trail.person = birthday({name: \"Alice\", age: 30});",
+		expected: `{"person":{"age":31,"name":"Alice"}}`,
+	},
+	{
+		name:     "slices_and_maps",
+		builtins: map[string]interface{}{
+			"keys": func(object map[string]interface{}) []string {
+				return []string{fmt.Sprint(len(object))}
+			},
+			"sum": func(numbers ...float64) (total float64) {
+				for _, number := range numbers {
+					total += number
+				}
+				return total
+			},
+		},
+		script:   "#//!js\njson.trail.keys = keys({a: 1, b: 2}).concat([\"x\"]); json.trail.sum = sum(1, 2, 3); json.trail.empty = sum();",
+		expected: `{"empty":0,"keys":["2","x"],"sum":6}`,
+	},
+	{
+		name:     "missing_args",
+		builtins: map[string]interface{}{
+			"greet": func(name string) string { return "hello " + name },
+		},
+		script:   "#//!js\njson.trail.greeting = greet();",
+		expected: `{"greeting":"hello "}`,
+	},
+	{
+		name:     "no_result",
+		builtins: map[string]interface{}{
+			"noop": func() {},
+		},
+		script:   "#//!js\njson.trail.type = typeof noop();",
+		expected: `{"type":"undefined"}`,
+	},
+	{
+		name:     "error_thrown",
+		builtins: map[string]interface{}{
+			"fail": func(message string) (string, error) { return "", errors.New(message) },
+		},
+		script:   "#//!js\ntry { fail(\"oops\"); } catch (e) { json.trail.error = e.name + \": \" + e.message; }",
+		expected: `{"error":"BuiltinError: fail: oops"}`,
+	},
+	{
+		name:     "error_uncaught",
+		builtins: map[string]interface{}{
+			"fail": func() error { return errors.New("oops") },
+		},
+		script:   "#//!js\nfail();",
+		err:      globals.ScriptError,
+	},
+	{
+		name:     "too_many_args",
+		builtins: map[string]interface{}{
+			"one": func(a int) int { return a },
+		},
+		script:   "#//!js\none(1, 2);",
+		err:      globals.ScriptError,
+	},
+	{
+		name:     "native",
+		builtins: map[string]interface{}{
+			"native": func(call otto.FunctionCall) otto.Value {
+				value, _ := call.Otto.ToValue(call.Argument(0).String() + "!")
+				return value
+			},
+		},
+		script:   "#//!js\njson.trail.native = native(\"hi\");",
+		expected: `{"native":"hi!"}`,
+	},
+	{
+		name:     "not_a_function",
+		builtins: map[string]interface{}{
+			"value": 1,
+		},
+		script:   "#//!js\nvalue;",
+		err:      globals.InvalidBuiltin,
+	},
+	{
+		name:     "too_many_results",
+		builtins: map[string]interface{}{
+			"pair": func() (int, int) { return 1, 2 },
+		},
+		script:   "#//!js\npair();",
+		err:      globals.InvalidBuiltin,
+	},
+	{
+		name:     "overrides_json",
+		builtins: map[string]interface{}{
+			"json": func() {},
+		},
+		script:   "#//!js\njson.trail.a = 1;",
+		err:      globals.OverriddenBuiltin,
+	},
+	{
+		name:     "overrides_math",
+		builtins: map[string]interface{}{
+			"Math": func() {},
+		},
+		script:   "#//!js\njson.trail.a = 1;",
+		err:      globals.OverriddenBuiltin,
+	},
+}
+
+func TestBuiltins(t *testing.T) {
+	for _, test := range builtinsTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			jsonMap.MustSet("$.script", test.script)
+
+			defer func() {
+				caught := recover()
+				if test.err == (globals.RuntimeError{}) {
+					if caught != nil {
+						tt.Fatalf("Script panicked: %v", caught)
+					}
+					if out, err := jsonMap.Marshal(); err != nil {
+						tt.Errorf("Could not Marshal JsonMap: %v", err)
+					} else if string(out) != test.expected {
+						tt.Errorf("Expected %s but got: %s", test.expected, string(out))
+					}
+					return
+				}
+				if err, ok := caught.(error); !ok || !strings.HasPrefix(err.Error(), test.err.FillError().Error()) {
+					tt.Errorf("Expected \"%s\" but got: %v", test.err.FillError().Error(), caught)
+				}
+			}()
+			jsonMap.RunWithOptions(context.Background(), jom.RunOptions{Builtins: test.builtins})
+		})
+	}
+}
+
+// Builtins given for one evaluation should not be visible to the scripts within another evaluation, even though the
+// VMs are reused.
+func TestBuiltinsIsolation(t *testing.T) {
+	script := "#//!js\njson.trail.tenant = typeof tenant === \"function\" ? tenant() : null;"
+	for i, tenant := range []interface{}{"a", nil, "b", nil} {
+		jsonMap := jom.New()
+		jsonMap.MustSet("$.script", script)
+		options := jom.RunOptions{}
+		expected := `{"tenant":null}`
+		if tenant != nil {
+			name := tenant.(string)
+			options.Builtins = map[string]interface{}{
+				"tenant": func() string { return name },
+			}
+			expected = fmt.Sprintf(`{"tenant":"%s"}`, name)
+		}
+
+		jsonMap.RunWithOptions(context.Background(), options)
+		if out, err := jsonMap.Marshal(); err != nil {
+			t.Errorf("%d: Could not Marshal JsonMap: %v", i, err)
+		} else if string(out) != expected {
+			t.Errorf("%d: Expected %s but got: %s", i, expected, string(out))
+		}
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	if err := js.RegisterBuiltin("registeredDouble", func(a float64) float64 { return a * 2 }); err != nil {
+		t.Fatalf("Could not register builtin: %v", err)
+	}
+	for _, test := range []struct{
+		name     string
+		function interface{}
+		err      globals.RuntimeError
+	}{
+		{"registeredDouble", func() {}, globals.OverriddenBuiltin},
+		{"console", func() {}, globals.OverriddenBuiltin},
+		{"JSON", func() {}, globals.OverriddenBuiltin},
+		{"parseInt", func() {}, globals.OverriddenBuiltin},
+		{"undefined", func() {}, globals.OverriddenBuiltin},
+		{"registeredString", "string", globals.InvalidBuiltin},
+	} {
+		if err := js.RegisterBuiltin(test.name, test.function); err == nil || !strings.HasPrefix(err.Error(), test.err.FillError().Error()) {
+			t.Errorf("%s: Expected \"%s\" but got: %v", test.name, test.err.FillError().Error(), err)
+		}
+	}
+
+	// Registered builtins are available to every evaluation
+	jsonMap := jom.New()
+	jsonMap.MustSet("$.script", "#//!js\njson.trail.doubled = registeredDouble(21);")
+	jsonMap.Run()
+	expected := `{"doubled":42}`
+	if out, err := jsonMap.Marshal(); err != nil {
+		t.Errorf("Could not Marshal JsonMap: %v", err)
+	} else if string(out) != expected {
+		t.Errorf("Expected %s but got: %s", expected, string(out))
+	}
+
+	// Builtins given for an evaluation cannot override registered builtins
+	jsonMap = jom.New()
+	jsonMap.MustSet("$.script", "#//!js\njson.trail.doubled = registeredDouble(21);")
+	defer func() {
+		if err, ok := recover().(error); !ok || !strings.HasPrefix(err.Error(), globals.OverriddenBuiltin.FillError().Error()) {
+			t.Errorf("Expected \"%s\" but got: %v", globals.OverriddenBuiltin.FillError().Error(), err)
+		}
+	}()
+	jsonMap.RunWithOptions(context.Background(), jom.RunOptions{Builtins: map[string]interface{}{
+		"registeredDouble": func() {},
+	}})
+}
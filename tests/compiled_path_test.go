@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/andygello555/gotils/slices"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Compiled JSON paths select the same nodes as JsonPathSelector.
+func TestCompiledPathSelect(t *testing.T) {
+	for i, jsonPath := range exampleJsonPathInput {
+		path, err := json_map.Compile(jsonPath)
+		if err != nil {
+			t.Errorf("Could not compile %s: %v", jsonPath, err)
+			continue
+		}
+		if path.String() != jsonPath {
+			t.Errorf("Expected the source of the compiled path to be %s but got %s", jsonPath, path.String())
+		}
+
+		// Select twice to check that the compiled path is not modified by being evaluated
+		for j := 0; j < 2; j++ {
+			nodes, err := path.Select(example)
+			if err != nil {
+				t.Errorf("The following error happened whilst evaluating the JSON path %s: %v", jsonPath, err)
+				break
+			}
+			nodeVals := make([]interface{}, 0)
+			for _, node := range nodes {
+				nodeVals = append(nodeVals, node.Value)
+				// Modifying the absolute paths of the nodes should not modify the compiled path
+				for k := range node.Absolute {
+					node.Absolute[k] = json_map.AbsolutePathKey{KeyType: json_map.StringKey, Value: "modified"}
+				}
+			}
+			if !slices.SameElements(nodeVals, exampleJsonPathOutput[i]) {
+				t.Errorf("%v and %v are not equal (JSON path: %s)", nodeVals, exampleJsonPathOutput[i], jsonPath)
+			}
+		}
+	}
+}
+
+func TestCompiledPathSet(t *testing.T) {
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal(exampleBytes); err != nil {
+		t.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	path := json_map.MustCompile("$.person.friends[?(@.age > $.over-forty)].age")
+	if err := path.Set(jsonMap, 41.0); err != nil {
+		t.Fatalf("Could not set %s: %v", path, err)
+	}
+	if ages := jsonMap.MustGet("$.person.friends[*].age"); fmt.Sprint(ages) != "[24 41 36 40 21]" {
+		t.Errorf("Expected ages [24 41 36 40 21] but got %v", ages)
+	}
+
+	// Setting nil deletes the values
+	if err := json_map.MustCompile("$.person.friends[0]").Set(jsonMap, nil); err != nil {
+		t.Fatalf("Could not delete: %v", err)
+	}
+	if names := jsonMap.MustGet("$.person.friends[*].name"); fmt.Sprint(names) != "[Bob Smith Dwayne Johnson Gary Twain Elizabeth Swindon Frank Bob]" {
+		t.Errorf("Expected friends to be deleted but got %v", names)
+	}
+}
+
+func TestCompiledPathInvalid(t *testing.T) {
+	for _, jsonPath := range []string{"$.person.friends[", "$.person[?(@.age)", "$['person"} {
+		if _, err := json_map.Compile(jsonPath); err == nil || !strings.HasPrefix(err.Error(), globals.JsonPathError.FillError().Error()) {
+			t.Errorf("Expected a JsonPathError when compiling %s but got: %v", jsonPath, err)
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected MustCompile to panic for %s", jsonPath)
+				}
+			}()
+			json_map.MustCompile(jsonPath)
+		}()
+	}
+}
+
+// Compiled JSON paths are cached up to json_map.CompiledPathCacheSize, evicting the least recently used.
+func TestCompiledPathCache(t *testing.T) {
+	defer func(size int) { json_map.CompiledPathCacheSize = size }(json_map.CompiledPathCacheSize)
+	json_map.CompiledPathCacheSize = 2
+
+	a := json_map.MustCompile("$.cache.a")
+	if json_map.MustCompile("$.cache.a") != a {
+		t.Errorf("Expected $.cache.a to be cached")
+	}
+	json_map.MustCompile("$.cache.b")
+	// $.cache.a is used more recently than $.cache.b, so $.cache.b is evicted
+	json_map.MustCompile("$.cache.a")
+	json_map.MustCompile("$.cache.c")
+	if json_map.MustCompile("$.cache.a") != a {
+		t.Errorf("Expected $.cache.a to still be cached")
+	}
+
+	json_map.CompiledPathCacheSize = 0
+	if json_map.MustCompile("$.cache.d") == json_map.MustCompile("$.cache.d") {
+		t.Errorf("Expected $.cache.d to not be cached")
+	}
+}
+
+func TestCompiledPathConcurrent(t *testing.T) {
+	path := json_map.MustCompile("$..friends[?(@.age < 30)].name")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal(exampleBytes); err != nil {
+				t.Errorf("Could not Unmarshal into JsonMap: %v", err)
+				return
+			}
+			for j := 0; j < 10; j++ {
+				if nodes, err := path.Select(jsonMap); err != nil || len(nodes) != 2 {
+					t.Errorf("Expected 2 nodes but got %v: %v", nodes, err)
+				}
+				if _, err := jsonMap.JsonPathSelector("$.person.friends[0, 1].name"); err != nil {
+					t.Errorf("Could not select: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkCompiledPath(b *testing.B) {
+	const jsonPath = "$..friends[1:4].name"
+	b.Run("parse", func(bb *testing.B) {
+		for i := 0; i < bb.N; i++ {
+			paths, _ := json_map.ParseJsonPath(jsonPath)
+			if _, errs := example.GetAbsolutePaths(&paths); errs != nil {
+				bb.Fatalf("Could not select: %v", errs)
+			}
+		}
+	})
+	b.Run("compiled", func(bb *testing.B) {
+		path := json_map.MustCompile(jsonPath)
+		for i := 0; i < bb.N; i++ {
+			if _, err := path.Select(example); err != nil {
+				bb.Fatalf("Could not select: %v", err)
+			}
+		}
+	})
+}
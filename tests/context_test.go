@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"testing"
+	"time"
+)
+
+// A script for each supported language which will run until it is halted.
+var contextTable = []struct{
+	name   string
+	script interface{}
+}{
+	{
+		name:   "JS",
+		script: "#//!js\nwhile (true) {}",
+	},
+	{
+		name:   "ES",
+		script: "#//!es\nwhile (true) {}",
+	},
+	{
+		name:   "Lua",
+		script: "#//!lua\nwhile true do end",
+	},
+	{
+		name:   "Starlark",
+		script: "#//!star\ni = 0\nwhile True:\n\ti += 1",
+	},
+	{
+		name:   "JQ",
+		script: "#//!jq\nlast(range(infinite))",
+	},
+	{
+		name:   "TMPL",
+		script: "#//!tmpl\n{{range 1000000000}}.{{end}}",
+	},
+	{
+		name:   "GOSRC",
+		script: `#//!gosrc
+import (
+	"strconv"
+	"github.com/andygello555/json-dom/jom/json_map"
+)
+
+func Run(json json_map.JsonMapInt) {
+	for i := 0; ; i++ {
+		_ = json.JsonPathSetter("$." + strconv.Itoa(i), float64(i))
+	}
+}`,
+	},
+	{
+		name:   "WASM",
+		// halting.wasm encoded as base64
+		script: "#//!wasm\nAGFzbQEAAAABBAFgAAADAgEABwcBA3J1bgAACgkBBwADQAwACws=",
+	},
+	{
+		name:   "GO",
+		script: func(ctx context.Context, json json_map.JsonMapInt) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	},
+}
+
+// Checks that the given panic/error is a globals.Cancelled error which wraps the given context error.
+func checkCancelled(t *testing.T, caught interface{}, target error) {
+	err, ok := caught.(error)
+	if !ok {
+		t.Fatalf("Expected a Cancelled error but got: %v", caught)
+	}
+	var wrapped *globals.WrappedRuntimeError
+	if !errors.As(err, &wrapped) || wrapped.RuntimeError != globals.Cancelled {
+		t.Errorf("Expected a Cancelled error but got: %v", err)
+	}
+	if !errors.Is(err, target) {
+		t.Errorf("Expected error to wrap \"%v\" but got: %v", target, err)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	for _, test := range contextTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(`{"hello": "world"}`)); err != nil {
+				tt.Errorf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			jsonMap.MustSet("$.script", test.script)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			defer func() {
+				// The script should be stopped by the context well before the halting delay
+				if duration := time.Since(start); duration >= time.Duration(globals.HaltingDelay) * globals.HaltingDelayUnits {
+					tt.Errorf("Script was not stopped by the context, took: %s", duration.String())
+				}
+				checkCancelled(tt, recover(), context.DeadlineExceeded)
+			}()
+			jsonMap.RunContext(ctx)
+		})
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// No scripts should be run if the context is already done
+	out, err := jom.EvalContext(ctx, []byte(`
+	{
+		hello: world
+		script:
+			'''#//!js
+			json.trail.hello = "js";
+			'''
+	}
+	`), false)
+	if out != nil {
+		t.Errorf("Expected no output but got: %s", string(out))
+	}
+	checkCancelled(t, err, context.Canceled)
+}
@@ -16,11 +16,19 @@
 package tests
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"github.com/andygello555/gotils/maps"
+	"github.com/andygello555/json-dom/code/es"
 	_ "github.com/andygello555/json-dom/code/go"
+	"github.com/andygello555/json-dom/code/gosrc"
+	_ "github.com/andygello555/json-dom/code/jq"
 	"github.com/andygello555/json-dom/code/js"
+	"github.com/andygello555/json-dom/code/lua"
+	"github.com/andygello555/json-dom/code/star"
+	"github.com/andygello555/json-dom/code/wasm"
 	"github.com/andygello555/json-dom/jom"
 	"github.com/andygello555/json-dom/jom/json_map"
 	"github.com/andygello555/json-dom/globals"
@@ -28,14 +36,26 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 )
 
 const (
 	exampleLocation     = "../assets/tests/examples/"
 	exampleEvalLocation = "../assets/tests/example_out/"
+	exampleWasmLocation = "../assets/tests/wasm/"
 )
 
+// Returns the script for the WebAssembly module with the given name within exampleWasmLocation. The module is encoded
+// as base64 as paths can only be given when RunOptions.WasmModulePaths is set.
+func exampleWasmModule(name string) string {
+	binary, err := ioutil.ReadFile(filepath.Join(exampleWasmLocation, name))
+	if err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(binary)
+}
+
 // Lookup of all names that require a defer call to catch a panic
 var panicExampleNames = map[string]bool{
 	"halting": true,
@@ -55,7 +75,7 @@ var checkStdoutErr = map[string]map[string][]string{
 	},
 	"array_root": {
 		"stdout": []string{
-			"Print call from: <$.array.[1]>",
+			"Print call from: <$.array[1]>",
 		},
 		"stderr": []string{
 		},
@@ -210,11 +230,12 @@ var differentLanguageMarkups = []struct{
 				},
 			},
 			{
-				"$.script": func(json json_map.JsonMapInt) {
-					i := 0
-					for {
+				"$.script": func(ctx context.Context, json json_map.JsonMapInt) error {
+					// Loops until the callback's context is done so that the callback isn't leaked
+					for i := 0; ctx.Err() == nil; i++ {
 						_ = json.JsonPathSetter("$."+strconv.Itoa(i), float64(i))
 					}
+					return ctx.Err()
 				},
 			},
 			{
@@ -284,11 +305,756 @@ var differentLanguageMarkups = []struct{
 			},
 		},
 	},
+	{
+		name:        "GOSRC",
+		strip:       true,
+		checkOutErr: false,
+		markups:     []map[string]interface{} {
+			{
+				"$.script": `#//!gosrc
+import (
+	"strings"
+	"github.com/andygello555/json-dom/jom/json_map"
+)
+
+func Run(json json_map.JsonMapInt) {
+	firstLast := strings.Split(json.MustGet("$.name")[0].(string), " ")
+	json.MustSet("$.first_name", firstLast[0])
+	json.MustSet("$.last_name", firstLast[1])
+	json.MustDelete("$.name")
+}`,
+			},
+			{
+				"$.seren-scrippidy": `#//!gosrc
+import (
+	"fmt"
+	"strings"
+	"github.com/andygello555/json-dom/jom/json_map"
+)
+
+func Run(json json_map.JsonMapInt) {
+	firstLast := strings.Split(json.MustGet("$.person.name")[0].(string), " ")
+	fmt.Println(firstLast)
+	json.MustSet("$.person.first_name", firstLast[0])
+	json.MustSet("$.person.last_name", firstLast[1])
+	json.MustDelete("$.person.name")
+}`,
+				"$.person.script1": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustSet("$.age", float64(18))
+}`,
+				"$.person.pets[0].attrs.script2": `#//!gosrc
+import (
+	"strconv"
+	"github.com/andygello555/json-dom/jom/json_map"
+)
+
+func Run(json json_map.JsonMapInt) {
+	for i := 0; i < 10; i++ {
+		json.MustSet("$.Woof" + strconv.Itoa(i), "Bark")
+	}
+}`,
+				"$.person.pets[1].script3": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustSet("$.name", "Nyan Cat")
+}`,
+			},
+			{
+				"$.seren-scrippidy": `#//!gosrc
+package main
+
+import (
+	"strings"
+	"github.com/andygello555/json-dom/jom/json_map"
+)
+
+func Run(json json_map.JsonMapInt) {
+	firstLast := strings.Split(json.MustGet("$.person.name")[0].(string), " ")
+	json.MustSet("$.person.first_name", firstLast[0])
+	json.MustSet("$.person.last_name", firstLast[1])
+	json.MustDelete("$.person.name")
+}`,
+				"$.person.script1": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustSet("$.age", float64(18))
+}`,
+				"$.person.pets[2].attrs.script2": `#//!gosrc
+import (
+	"strconv"
+	"github.com/andygello555/json-dom/jom/json_map"
+)
+
+func Run(json json_map.JsonMapInt) {
+	for i := 0; i < 10; i++ {
+		json.MustSet("$.Woof" + strconv.Itoa(i), "Bark")
+	}
+}`,
+			},
+			{
+				"$.delete_attrs": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustDelete("$.attrs")
+}`,
+				"$.attrs.clown_shoe": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustSet("$.clown_shoe_size", json.MustGet("$.shoe_size")[0].(float64) + 3)
+}`,
+				"$.person.script": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustSet("$.age", float64(18))
+}`,
+				"$.person.pets[2].attrs.script": `#//!gosrc
+import (
+	"strconv"
+	"github.com/andygello555/json-dom/jom/json_map"
+)
+
+func Run(json json_map.JsonMapInt) {
+	for i := 0; i < 10; i++ {
+		json.MustSet("$.Woof" + strconv.Itoa(i), "Bark")
+	}
+}`,
+			},
+			{
+				"$.nested_boi.script": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustSet("$.Hello", "World")
+}`,
+				"$.d": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustSet("$.counter", json.MustGet("$.counter")[0].(float64) * 3)
+}`,
+				"$.a": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustSet("$.counter", json.MustGet("$.counter")[0].(float64) + 6)
+}`,
+				"$.c": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustSet("$.counter", json.MustGet("$.counter")[0].(float64) / 2)
+}`,
+				"$.b": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustSet("$.counter", json.MustGet("$.counter")[0].(float64) - 4)
+}`,
+				"$.e": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustSet("$.counter", json.MustGet("$.counter")[0].(float64) * 3)
+}`,
+			},
+			{
+				"$.script": `#//!gosrc
+import (
+	"strconv"
+	"github.com/andygello555/json-dom/jom/json_map"
+)
+
+func Run(json json_map.JsonMapInt) {
+	for i := 0; ; i++ {
+		_ = json.JsonPathSetter("$." + strconv.Itoa(i), float64(i))
+	}
+}`,
+			},
+			{
+				"$.people[0].script": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustPush("$.attrs", "Married to Nick Miller (spoilers)")
+}`,
+				"$.people[1].script": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustPush("$.attrs", "Married to Jessica Day (spoilers)")
+}`,
+				"$.scrippidy_script": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.MustPush("$.people", map[string]interface{}{
+		"name": "Winston Bishop",
+		"attrs": []interface{}{
+			"Ferguson",
+			"Married to Ally (spoilers)",
+		},
+	})
+}`,
+			},
+			{},
+			{
+				"$.array[0].script": `#//!gosrc
+import (
+	"strings"
+	"github.com/andygello555/json-dom/jom/json_map"
+)
+
+func Run(json json_map.JsonMapInt) {
+	firstLast := strings.Split(json.MustGet("$.name")[0].(string), " ")
+	json.MustSet("$.first_name", firstLast[0])
+	json.MustSet("$.last_name", firstLast[1])
+	json.MustDelete("$.name")
+}`,
+				"$.array[1].script": `#//!gosrc
+import (
+	"fmt"
+	"strings"
+	"github.com/andygello555/json-dom/jom/json_map"
+)
+
+func Run(json json_map.JsonMapInt) {
+	fmt.Println("Scope JSON path is " + json.GetCurrentScopePath())
+	firstLast := strings.Split(json.MustGet("$.name")[0].(string), " ")
+	json.MustSet("$.first_name", firstLast[0])
+	json.MustSet("$.last_name", firstLast[1])
+	json.MustDelete("$.name")
+}`,
+			},
+			{
+				"$.script": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	basePath := "$..friends"
+	defaultAge := json.MustGet("$.default_age")[0]
+
+	for _, node := range json.MustGet(basePath + "[?(typeof @ == 'string')]") {
+		json.MustSet(basePath + "[?(@ == '" + node.(string) + "')]", map[string]interface{}{
+			"name": node,
+			"age":  defaultAge,
+		})
+	}
+
+	for _, node := range json.MustGet(basePath + "[?(typeof @ == 'object')]") {
+		normalised := node.(map[string]interface{})
+		if _, ok := normalised["name"]; !ok {
+			normalised["name"] = "Bob bob"
+		}
+		if _, ok := normalised["age"]; !ok {
+			normalised["age"] = defaultAge
+		}
+		json.MustSet(basePath + "[?(@.name == '" + normalised["name"].(string) + "')]", normalised)
+	}
+
+	json.MustDelete("$..friends[0]")
+	json.MustDelete("$.default_age")
+}`,
+			},
+		},
+	},
+	{
+		name:        "Lua",
+		strip:       true,
+		checkOutErr: false,
+		markups:     []map[string]interface{} {
+			{
+				"$.script": `#//!lua
+local first, last = string.match(json.trail.name, "(%S+) (%S+)")
+json.trail.first_name = first
+json.trail.last_name = last
+json.trail.name = nil`,
+			},
+			{
+				"$.seren-scrippidy": `#//!lua
+local first, last = string.match(json.trail.person.name, "(%S+) (%S+)")
+console.log(first, last)
+json.trail.person.first_name = first
+json.trail.person.last_name = last
+json.trail.person.name = nil`,
+				"$.person.script1": `#//!lua
+json.trail.age = 18`,
+				"$.person.pets[0].attrs.script2": `#//!lua
+for i = 0, 9 do
+	json.trail["Woof" .. i] = "Bark"
+end`,
+				"$.person.pets[1].script3": `#//!lua
+json.trail.name = "Nyan Cat"`,
+			},
+			{
+				"$.seren-scrippidy": `#//!lua
+local first, last = string.match(json.trail.person.name, "(%S+) (%S+)")
+json.trail.person.first_name = first
+json.trail.person.last_name = last
+json.trail.person.name = nil`,
+				"$.person.script1": `#//!lua
+json.trail.age = 18`,
+				"$.person.pets[2].attrs.script2": `#//!lua
+for i = 0, 9 do
+	json.trail["Woof" .. i] = "Bark"
+end`,
+			},
+			{
+				"$.delete_attrs": `#//!lua
+json.trail.attrs = nil`,
+				"$.attrs.clown_shoe": `#//!lua
+json.trail.clown_shoe_size = json.trail.shoe_size + 3`,
+				"$.person.script": `#//!lua
+json.trail.age = 18`,
+				"$.person.pets[2].attrs.script": `#//!lua
+for i = 0, 9 do
+	json.trail["Woof" .. i] = "Bark"
+end`,
+			},
+			{
+				"$.nested_boi.script": `#//!lua
+json.trail.Hello = "World"`,
+				"$.d": `#//!lua
+json.trail.counter = json.trail.counter * 3`,
+				"$.a": `#//!lua
+json.trail.counter = json.trail.counter + 6`,
+				"$.c": `#//!lua
+json.trail.counter = json.trail.counter / 2`,
+				"$.b": `#//!lua
+json.trail.counter = json.trail.counter - 4`,
+				"$.e": `#//!lua
+json.trail.counter = json.trail.counter * 3`,
+			},
+			{
+				"$.script": `#//!lua
+local i = 0
+while true do
+	json.trail[tostring(i)] = i
+end`,
+			},
+			{
+				"$.people[0].script": `#//!lua
+table.insert(json.trail.attrs, "Married to Nick Miller (spoilers)")`,
+				"$.people[1].script": `#//!lua
+table.insert(json.trail.attrs, "Married to Jessica Day (spoilers)")`,
+				"$.scrippidy_script": `#//!lua
+table.insert(json.trail.people, {
+	name = "Winston Bishop",
+	attrs = {
+		"Ferguson",
+		"Married to Ally (spoilers)",
+	},
+})`,
+			},
+			{},
+			{
+				"$.array[0].script": `#//!lua
+local first, last = string.match(json.trail.name, "(%S+) (%S+)")
+json.trail.first_name = first
+json.trail.last_name = last
+json.trail.name = nil`,
+				"$.array[1].script": `#//!lua
+console.log("Scope JSON path is " .. json.scopePath)
+local first, last = string.match(json.trail.name, "(%S+) (%S+)")
+json.trail.first_name = first
+json.trail.last_name = last
+json.trail.name = nil`,
+			},
+			{
+				"$.script": `#//!lua
+local basePath = "$..friends"
+local nodes = json.jsonPathSelector(basePath .. "[?(typeof @ == 'string')]"):getValues()
+for _, node in ipairs(nodes) do
+	json.jsonPathSelector(basePath .. "[?(@ == '" .. node .. "')]"):setValues({
+		name = node,
+		age = json.trail.default_age,
+	})
+end
+
+nodes = json.jsonPathSelector(basePath .. "[?(typeof @ == 'object')]"):getValues()
+for _, node in ipairs(nodes) do
+	if node.name == nil then
+		node.name = "Bob bob"
+	end
+	if node.age == nil then
+		node.age = json.trail.default_age
+	end
+	json.jsonPathSelector(basePath .. "[?(@.name == '" .. node.name .. "')]"):setValues(node)
+end
+
+json.jsonPathSelector("$..friends[0]").setValues(nil)
+json.trail.default_age = nil`,
+			},
+		},
+	},
+	{
+		name:        "Starlark",
+		strip:       true,
+		checkOutErr: false,
+		markups:     []map[string]interface{} {
+			{
+				"$.script": `#//!star
+first_last = json.trail["name"].split(" ")
+json.trail["first_name"] = first_last[0]
+json.trail["last_name"] = first_last[1]
+json.trail.pop("name")`,
+			},
+			{
+				"$.seren-scrippidy": `#//!star
+first_last = json.trail["person"]["name"].split(" ")
+console.log(first_last)
+json.trail["person"]["first_name"] = first_last[0]
+json.trail["person"]["last_name"] = first_last[1]
+json.trail["person"].pop("name")`,
+				"$.person.script1": `#//!star
+json.trail["age"] = 18`,
+				"$.person.pets[0].attrs.script2": `#//!star
+for i in range(10):
+	json.trail["Woof" + str(i)] = "Bark"`,
+				"$.person.pets[1].script3": `#//!star
+json.trail["name"] = "Nyan Cat"`,
+			},
+			{
+				"$.seren-scrippidy": `#//!star
+first_last = json.trail["person"]["name"].split(" ")
+json.trail["person"]["first_name"] = first_last[0]
+json.trail["person"]["last_name"] = first_last[1]
+json.trail["person"].pop("name")`,
+				"$.person.script1": `#//!star
+json.trail["age"] = 18`,
+				"$.person.pets[2].attrs.script2": `#//!star
+for i in range(10):
+	json.trail["Woof" + str(i)] = "Bark"`,
+			},
+			{
+				"$.delete_attrs": `#//!star
+json.trail.pop("attrs")`,
+				"$.attrs.clown_shoe": `#//!star
+json.trail["clown_shoe_size"] = json.trail["shoe_size"] + 3`,
+				"$.person.script": `#//!star
+json.trail["age"] = 18`,
+				"$.person.pets[2].attrs.script": `#//!star
+for i in range(10):
+	json.trail["Woof" + str(i)] = "Bark"`,
+			},
+			{
+				"$.nested_boi.script": `#//!star
+json.trail["Hello"] = "World"`,
+				"$.d": `#//!star
+json.trail["counter"] *= 3`,
+				"$.a": `#//!star
+json.trail["counter"] += 6`,
+				"$.c": `#//!star
+json.trail["counter"] /= 2`,
+				"$.b": `#//!star
+json.trail["counter"] -= 4`,
+				"$.e": `#//!star
+json.trail["counter"] *= 3`,
+			},
+			{
+				"$.script": `#//!star
+i = 0
+while True:
+	json.trail[str(i)] = i`,
+			},
+			{
+				"$.people[0].script": `#//!star
+json.trail["attrs"].append("Married to Nick Miller (spoilers)")`,
+				"$.people[1].script": `#//!star
+json.trail["attrs"].append("Married to Jessica Day (spoilers)")`,
+				"$.scrippidy_script": `#//!star
+json.trail["people"].append({
+	"name": "Winston Bishop",
+	"attrs": [
+		"Ferguson",
+		"Married to Ally (spoilers)",
+	],
+})`,
+			},
+			{},
+			{
+				"$.array[0].script": `#//!star
+first_last = json.trail["name"].split(" ")
+json.trail["first_name"] = first_last[0]
+json.trail["last_name"] = first_last[1]
+json.trail.pop("name")`,
+				"$.array[1].script": `#//!star
+print("Scope JSON path is " + json.scopePath)
+first_last = json.trail["name"].split(" ")
+json.trail["first_name"] = first_last[0]
+json.trail["last_name"] = first_last[1]
+json.trail.pop("name")`,
+			},
+			{
+				"$.script": `#//!star
+base_path = "$..friends"
+for node in json.jsonPathSelector(base_path + "[?(typeof @ == 'string')]").getValues():
+	json.jsonPathSelector(base_path + "[?(@ == '" + node + "')]").setValues({
+		"name": node,
+		"age": json.trail["default_age"],
+	})
+
+for node in json.jsonPathSelector(base_path + "[?(typeof @ == 'object')]").getValues():
+	node.setdefault("name", "Bob bob")
+	node.setdefault("age", json.trail["default_age"])
+	json.jsonPathSelector(base_path + "[?(@.name == '" + node["name"] + "')]").setValues(node)
+
+json.jsonPathSelector("$..friends[0]").setValues(None)
+json.trail.pop("default_age")`,
+			},
+		},
+	},
+	{
+		name:        "ES",
+		strip:       true,
+		checkOutErr: false,
+		markups:     []map[string]interface{} {
+			{
+				"$.script": `#//!es
+const [first, last] = json.trail.name.split(' ');
+json.trail = {...json.trail, first_name: first, last_name: last};
+delete json.trail.name;`,
+			},
+			{
+				"$.seren-scrippidy": `#//!es
+const [first, last] = json.trail.person.name.split(' ');
+console.log([first, last]);
+console.error([first, last]);
+Object.assign(json.trail.person, {first_name: first, last_name: last});
+delete json.trail.person.name;`,
+				"$.person.script1": `#//!es
+json.trail.age = 18;`,
+				"$.person.pets[0].attrs.script2": `#//!es
+for (let i = 0; i < 10; i++) {
+	json.trail[` + "`Woof${i}`" + `] = 'Bark';
+}`,
+				"$.person.pets[1].script3": `#//!es
+json.trail.name = "Nyan Cat";`,
+			},
+			{
+				"$.seren-scrippidy": `#//!es
+const {name} = json.trail.person;
+const [first, last] = name.split(' ');
+Object.assign(json.trail.person, {first_name: first, last_name: last});
+delete json.trail.person.name;`,
+				"$.person.script1": `#//!es
+json.trail.age = 18;`,
+				"$.person.pets[2].attrs.script2": `#//!es
+Array.from({length: 10}, (_, i) => i).forEach(i => json.trail['Woof' + i] = 'Bark');`,
+			},
+			{
+				"$.delete_attrs": `#//!es
+delete json.trail.attrs;`,
+				"$.attrs.clown_shoe": `#//!es
+json.trail.clown_shoe_size = json.trail.shoe_size + 3;`,
+				"$.person.script": `#//!es
+json.trail.age = 18;`,
+				"$.person.pets[2].attrs.script": `#//!es
+for (const i of [...Array(10).keys()]) {
+	json.trail['Woof' + i] = 'Bark';
+}`,
+			},
+			{
+				"$.nested_boi.script": `#//!es
+json.trail.Hello = "World";`,
+				"$.d": `#//!es
+json.trail.counter *= 3;`,
+				"$.a": `#//!es
+json.trail.counter += 6;`,
+				"$.c": `#//!es
+json.trail.counter /= 2;`,
+				"$.b": `#//!es
+json.trail.counter -= 4;`,
+				"$.e": `#//!es
+json.trail.counter *= 3;`,
+			},
+			{
+				"$.script": `#//!es
+let i = 0;
+while (true) {
+	json.trail[i] = i;
+}`,
+			},
+			{
+				"$.people[0].script": `#//!es
+json.trail.attrs.push('Married to Nick Miller (spoilers)');`,
+				"$.people[1].script": `#//!es
+json.trail.attrs.push('Married to Jessica Day (spoilers)');`,
+				"$.scrippidy_script": `#//!es
+const attrs = ["Ferguson", "Married to Ally (spoilers)"];
+json.trail.people.push({name: "Winston Bishop", attrs});`,
+			},
+			{},
+			{
+				"$.array[0].script": `#//!es
+const [first, last] = json.trail.name.split(' ');
+Object.assign(json.trail, {first_name: first, last_name: last});
+delete json.trail.name;`,
+				"$.array[1].script": `#//!es
+console.log(` + "`Scope JSON path is ${json.scopePath}`" + `);
+const [first, last] = json.trail.name.split(' ');
+Object.assign(json.trail, {first_name: first, last_name: last});
+delete json.trail.name;`,
+			},
+			{
+				"$.script": `#//!es
+const basePath = "$..friends";
+for (const node of json.jsonPathSelector(basePath + "[?(typeof @ == 'string')]").getValues()) {
+	json.jsonPathSelector(basePath + "[?(@ == '" + node + "')]").setValues({name: node, age: json.trail.default_age});
 }
 
-var stdoutBuffer strings.Builder
-var stderrBuffer strings.Builder
-var buffers = map[string]*strings.Builder{
+for (const node of json.jsonPathSelector(basePath + "[?(typeof @ == 'object')]").getValues()) {
+	const normalised = {name: "Bob bob", age: json.trail.default_age, ...node};
+	json.jsonPathSelector(basePath + "[?(@.name == '" + normalised.name + "')]").setValues(normalised);
+}
+
+json.jsonPathSelector("$..friends[0]").setValues(null);
+delete json.trail.default_age;`,
+			},
+		},
+	},
+	{
+		name:        "WASM",
+		strip:       true,
+		checkOutErr: false,
+		markups:     []map[string]interface{} {
+			{
+				"$.script": "#//!wasm\n" + exampleWasmModule("first_last.wasm"),
+			},
+			{},
+			{},
+			{},
+			{},
+			{
+				// halting.wasm encoded as base64
+				"$.script": "#//!wasm\nAGFzbQEAAAABBAFgAAADAgEABwcBA3J1bgAACgkBBwADQAwACws=",
+			},
+			{},
+			{},
+			{
+				"$.array[0].script": "#//!wasm\n" + exampleWasmModule("first_last.wasm"),
+				"$.array[1].script": "#//!wasm\n" + exampleWasmModule("first_last.wasm"),
+			},
+		},
+	},
+	{
+		name:        "JQ",
+		strip:       true,
+		checkOutErr: false,
+		markups:     []map[string]interface{} {
+			{
+				"$.script": `#//!jq
+(.name | split(" ")) as [$first, $last] | del(.name) | .first_name = $first | .last_name = $last`,
+			},
+			{
+				"$.seren-scrippidy": `#//!jq
+(.person.name | split(" ")) as [$first, $last] | .person |= (del(.name) | .first_name = $first | .last_name = $last)`,
+				"$.person.script1": `#//!jq
+.age = 18`,
+				"$.person.pets[0].attrs.script2": `#//!jq
+reduce range(10) as $i (.; .["Woof\($i)"] = "Bark")`,
+				"$.person.pets[1].script3": `#//!jq
+.name = "Nyan Cat"`,
+			},
+			{
+				"$.seren-scrippidy": `#//!jq
+(.person.name | split(" ")) as [$first, $last] | .person |= (del(.name) | .first_name = $first | .last_name = $last)`,
+				"$.person.script1": `#//!jq
+.age = 18`,
+				"$.person.pets[2].attrs.script2": `#//!jq
+reduce range(10) as $i (.; .["Woof\($i)"] = "Bark")`,
+			},
+			{
+				"$.delete_attrs": `#//!jq
+del(.attrs)`,
+				"$.attrs.clown_shoe": `#//!jq
+.clown_shoe_size = .shoe_size + 3`,
+				"$.person.script": `#//!jq
+.age = 18`,
+				"$.person.pets[2].attrs.script": `#//!jq
+reduce range(10) as $i (.; .["Woof\($i)"] = "Bark")`,
+			},
+			{
+				"$.nested_boi.script": `#//!jq
+.Hello = "World"`,
+				"$.d": `#//!jq
+.counter *= 3`,
+				"$.a": `#//!jq
+.counter += 6`,
+				"$.c": `#//!jq
+.counter /= 2`,
+				"$.b": `#//!jq
+.counter -= 4`,
+				"$.e": `#//!jq
+.counter *= 3`,
+			},
+			{
+				"$.script": `#//!jq
+def loop: loop; loop`,
+			},
+			{
+				"$.people[0].script": `#//!jq
+.attrs += ["Married to Nick Miller (spoilers)"]`,
+				"$.people[1].script": `#//!jq
+.attrs += ["Married to Jessica Day (spoilers)"]`,
+				"$.scrippidy_script": `#//!jq
+.people += [{name: "Winston Bishop", attrs: ["Ferguson", "Married to Ally (spoilers)"]}]`,
+			},
+			{},
+			{
+				"$.array[0].script": `#//!jq
+(.name | split(" ")) as [$first, $last] | del(.name) | .first_name = $first | .last_name = $last`,
+				"$.array[1].script": `#//!jq
+select($scopePath == "$.array[1]") | (.name | split(" ")) as [$first, $last] | del(.name) | .first_name = $first | .last_name = $last`,
+			},
+			{
+				"$.script": `#//!jq
+.default_age as $age
+| del(.default_age)
+| (.. | objects | select(has("friends")) | .friends) |= (
+	map(if type == "string" then {name: ., age: $age} else {name: "Bob bob", age: $age} + . end)
+	| .[1:]
+)`,
+			},
+		},
+	},
+}
+
+// A strings.Builder which can be written to concurrently, as scripts can print from multiple goroutines when
+// evaluating in parallel.
+type syncBuilder struct {
+	mutex   sync.Mutex
+	builder strings.Builder
+}
+
+func (b *syncBuilder) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.builder.Write(p)
+}
+
+func (b *syncBuilder) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.builder.String()
+}
+
+func (b *syncBuilder) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.builder.Reset()
+}
+
+var stdoutBuffer syncBuilder
+var stderrBuffer syncBuilder
+var buffers = map[string]*syncBuilder{
 	"stdout": &stdoutBuffer,
 	"stderr": &stderrBuffer,
 }
@@ -327,12 +1093,32 @@ func init() {
 	// Set the streams for the js module
 	js.ExternalConsoleLogStdout = &stdoutBuffer
 	js.ExternalConsoleLogStderr = &stderrBuffer
+	gosrc.ExternalConsoleLogStdout = &stdoutBuffer
+	gosrc.ExternalConsoleLogStderr = &stderrBuffer
+	lua.ExternalConsoleLogStdout = &stdoutBuffer
+	lua.ExternalConsoleLogStderr = &stderrBuffer
+	star.ExternalConsoleLogStdout = &stdoutBuffer
+	star.ExternalConsoleLogStderr = &stderrBuffer
+	es.ExternalConsoleLogStdout = &stdoutBuffer
+	es.ExternalConsoleLogStderr = &stderrBuffer
+	wasm.ExternalConsoleLogStdout = &stdoutBuffer
+	wasm.ExternalConsoleLogStderr = &stderrBuffer
 
 	// Set the halting time delay so that the halting problem examples run a bit quicker
 	globals.HaltingDelay = 1
 }
 
 func TestExamples(t *testing.T) {
+	testExamples(t, jom.RunOptions{})
+}
+
+// Evaluating the examples in parallel should give the same output as evaluating them sequentially.
+func TestExamplesParallel(t *testing.T) {
+	testExamples(t, jom.RunOptions{Parallelism: 4})
+}
+
+// Evaluates all examples in every supported language using the given RunOptions.
+func testExamples(t *testing.T, options jom.RunOptions) {
 	// For each supported language we will run all the examples which is run in a subtest
 	for _, supportedLang := range differentLanguageMarkups {
 		t.Run(supportedLang.name, func(tt *testing.T) {
@@ -387,7 +1173,7 @@ func TestExamples(t *testing.T) {
 						}
 
 						// Evaluate the JsonMap
-						jsonMap.Run()
+						jsonMap.RunWithOptions(context.Background(), options)
 
 						if supportedLang.checkOutErr {
 							// Check stdout and stderr if needed
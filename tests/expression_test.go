@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/andygello555/gotils/maps"
+	_ "github.com/andygello555/json-dom/code/tmpl"
+	"github.com/andygello555/json-dom/jom"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"testing"
+)
+
+// An expression script for each supported language which evaluates to a value computed from its scope.
+var expressionTable = []struct{
+	name   string
+	script interface{}
+	out    interface{}
+}{
+	{
+		name:   "JS",
+		script: "#//!js=\njson.trail.a + json.trail.b",
+		out:    float64(42),
+	},
+	{
+		name:   "ES",
+		script: "#//!es=\njson.trail.a + json.trail.b",
+		out:    float64(42),
+	},
+	{
+		name:   "Lua",
+		script: "#//!lua=\njson.trail.a + json.trail.b",
+		out:    float64(42),
+	},
+	{
+		name:   "Starlark",
+		script: "#//!star=\njson.trail[\"a\"] + json.trail[\"b\"]",
+		out:    float64(42),
+	},
+	{
+		name:   "JQ",
+		script: "#//!jq=\n.a + .b",
+		out:    float64(42),
+	},
+	{
+		name:   "GOSRC",
+		script: "#//!gosrc=\n(*json.GetInsides())[\"a\"].(float64) + (*json.GetInsides())[\"b\"].(float64)",
+		out:    float64(42),
+	},
+	{
+		name:   "TMPL",
+		script: "#//!tmpl=\n{{.a}}+{{.b}}",
+		out:    "40+2",
+	},
+	{
+		name:   "WASM",
+		script: "#//!wasm=\n" + exampleWasmModule("path_get_result.wasm"),
+		out:    []interface{}{float64(40)},
+	},
+	{
+		name:   "GO",
+		script: func(json json_map.JsonMapInt) interface{} {
+			insides := *json.GetInsides()
+			return insides["a"].(float64) + insides["b"].(float64)
+		},
+		out:    float64(42),
+	},
+}
+
+func TestExpression(t *testing.T) {
+	for _, test := range expressionTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(`{a: 40, b: 2, nested: {c: 1}}`)); err != nil {
+				tt.Errorf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			if err := jsonMap.JsonPathSetter("$.sum", test.script); err != nil {
+				tt.Errorf("Could not set path \"$.sum\" to script: %v", err)
+			}
+			jsonMap.Run()
+
+			// The script's key should be kept and its value replaced with the value of the expression
+			expected := map[string]interface{}{
+				"a":      float64(40),
+				"b":      float64(2),
+				"nested": map[string]interface{}{"c": float64(1)},
+				"sum":    test.out,
+			}
+			maps.JsonMapEqualTest(tt, *jsonMap.GetInsides(), expected, fmt.Sprintf("\"%s\"", test.name))
+		})
+	}
+}
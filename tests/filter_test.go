@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"strings"
+	"testing"
+)
+
+var filterDocument = map[string]interface{}{
+	"threshold": 30.0,
+	"names":     []interface{}{"Jane", "Bob"},
+	"people": []interface{}{
+		map[string]interface{}{"name": "Jane", "age": 24.0, "tags": []interface{}{"a", "b"}, "email": "jane@example.com"},
+		map[string]interface{}{"name": "Bob", "age": 55.0, "tags": []interface{}{}, "address": map[string]interface{}{"city": "London"}},
+		map[string]interface{}{"name": "O'Brien", "age": 36, "nickname": nil},
+		map[string]interface{}{"name": "$.threshold @", "admin": true},
+	},
+}
+
+// Filter expressions and the names of the people in filterDocument they should match. If err is true then the filter
+// expression should not parse.
+var filterTable = []struct{
+	name       string
+	expression string
+	expected   []string
+	err        bool
+}{
+	{name: "equal_number", expression: "@.age == 24", expected: []string{"Jane"}},
+	{name: "equal_int", expression: "@.age == 36", expected: []string{"O'Brien"}},
+	{name: "strict_equal", expression: "@.age === 55", expected: []string{"Bob"}},
+	{name: "not_equal", expression: "@.name != 'Jane'", expected: []string{"Bob", "O'Brien", "$.threshold @"}},
+	{name: "equal_missing", expression: "@.age == @.missing", expected: []string{"$.threshold @"}},
+	{name: "equal_null", expression: "@.nickname == null", expected: []string{"O'Brien"}},
+	{name: "equal_array", expression: "@.tags == ['a', 'b']", expected: []string{"Jane"}},
+	{name: "equal_object", expression: "@.address == $.people[1].address", expected: []string{"Bob"}},
+	{name: "less", expression: "@.age < 30", expected: []string{"Jane"}},
+	{name: "less_equal", expression: "@.age <= 36", expected: []string{"Jane", "O'Brien"}},
+	{name: "greater", expression: "@.age > $.threshold", expected: []string{"Bob", "O'Brien"}},
+	{name: "greater_equal", expression: "@.age >= 55", expected: []string{"Bob"}},
+	{name: "less_strings", expression: "@.name < 'C'", expected: []string{"Bob", "$.threshold @"}},
+	{name: "less_mismatch", expression: "@.name < 100", expected: []string{}},
+	{name: "and", expression: "@.age > 20 && @.age < 40", expected: []string{"Jane", "O'Brien"}},
+	{name: "or", expression: "@.age < 30 || @.admin", expected: []string{"Jane", "$.threshold @"}},
+	{name: "not", expression: "!@.age", expected: []string{"$.threshold @"}},
+	{name: "precedence", expression: "@.name == 'Bob' || @.age > 20 && @.age < 30", expected: []string{"Jane", "Bob"}},
+	{name: "parentheses", expression: "(@.name == 'Bob' || @.age > 20) && @.age < 30", expected: []string{"Jane"}},
+	{name: "exists", expression: "@.address", expected: []string{"Bob"}},
+	{name: "exists_null", expression: "@.nickname", expected: []string{"O'Brien"}},
+	{name: "exists_nested", expression: "@.address.city", expected: []string{"Bob"}},
+	{name: "in", expression: "@.name in ['Jane', 'Bob']", expected: []string{"Jane", "Bob"}},
+	{name: "in_path", expression: "@.name in $.names", expected: []string{"Jane", "Bob"}},
+	{name: "in_object", expression: "'city' in @.address", expected: []string{"Bob"}},
+	{name: "nin", expression: "@.name nin $.names", expected: []string{"O'Brien", "$.threshold @"}},
+	{name: "regex", expression: "@.name =~ /^j/i", expected: []string{"Jane"}},
+	{name: "regex_string", expression: "@.email =~ '@example\\\\.com$'", expected: []string{"Jane"}},
+	{name: "regex_not_string", expression: "@.age =~ /2/", expected: []string{}},
+	{name: "length_string", expression: "length(@.name) == 3", expected: []string{"Bob"}},
+	{name: "length_array", expression: "length(@.tags) == 2", expected: []string{"Jane"}},
+	{name: "length_object", expression: "length(@) == 4", expected: []string{"Jane", "Bob"}},
+	{name: "length_number", expression: "length(@.age) == 2", expected: []string{}},
+	{name: "length_property", expression: "@.name.length == 3", expected: []string{"Bob"}},
+	{name: "count", expression: "count(@.tags[*]) == 2", expected: []string{"Jane"}},
+	{name: "count_descendants", expression: "count(@..*) > 4", expected: []string{"Jane", "Bob"}},
+	{name: "match", expression: "match(@.name, 'B.b')", expected: []string{"Bob"}},
+	{name: "match_partial", expression: "match(@.name, 'B')", expected: []string{}},
+	{name: "search", expression: "search(@.name, 'B')", expected: []string{"Bob", "O'Brien"}},
+	{name: "search_path", expression: "search(@.name, $.names[0])", expected: []string{"Jane"}},
+	{name: "value", expression: "value(@..city) == 'London'", expected: []string{"Bob"}},
+	{name: "typeof", expression: "typeof @.age == 'number'", expected: []string{"Jane", "Bob", "O'Brien"}},
+	{name: "typeof_undefined", expression: "typeof @.age == 'undefined'", expected: []string{"$.threshold @"}},
+	{name: "string_with_path", expression: "@.name == '$.threshold @'", expected: []string{"$.threshold @"}},
+	{name: "string_with_quote", expression: "@.name == \"O'Brien\"", expected: []string{"O'Brien"}},
+	{name: "string_escaped_quote", expression: "@.name == 'O\\'Brien'", expected: []string{"O'Brien"}},
+	{name: "nested_filter", expression: "@.tags[?(@ == 'b')]", expected: []string{"Jane"}},
+	{name: "nested_filter_rfc", expression: "$.names[?@ == 'Bob']", expected: []string{"Jane", "Bob", "O'Brien", "$.threshold @"}},
+	{name: "index", expression: "@.tags[-1] == 'b'", expected: []string{"Jane"}},
+	{name: "slice", expression: "@.tags[0:1] == 'a'", expected: []string{"Jane"}},
+	{name: "bracket_name", expression: "@['name'] == 'Bob'", expected: []string{"Bob"}},
+	{name: "unterminated_string", expression: "@.name == 'Bob", err: true},
+	{name: "missing_operand", expression: "@.age ==", err: true},
+	{name: "unbalanced", expression: "(@.age == 24", err: true},
+	{name: "unknown_function", expression: "foo(@.age)", err: true},
+	{name: "wrong_arity", expression: "length(@.name, 1)", err: true},
+	{name: "count_not_query", expression: "count(1) == 1", err: true},
+	{name: "invalid_regex", expression: "@.name =~ /(/", err: true},
+	{name: "trailing", expression: "@.age == 24 24", err: true},
+}
+
+func TestFilter(t *testing.T) {
+	for _, test := range filterTable {
+		t.Run(test.name, func(tt *testing.T) {
+			filter, err := json_map.ParseFilter(test.expression)
+			if test.err {
+				if err == nil || !strings.HasPrefix(err.Error(), globals.JsonPathError.FillError().Error()) {
+					tt.Errorf("Expected a JsonPathError but got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("Could not parse filter expression %q: %v", test.expression, err)
+			}
+
+			matched := make([]string, 0)
+			for _, person := range filterDocument["people"].([]interface{}) {
+				if filter.Match(person, filterDocument) {
+					matched = append(matched, person.(map[string]interface{})["name"].(string))
+				}
+			}
+			if fmt.Sprint(matched) != fmt.Sprint(test.expected) {
+				tt.Errorf("Expected %q to match %v but matched %v", test.expression, test.expected, matched)
+			}
+		})
+	}
+}
+
+// String literals which contain path-like text are not substituted when filter expressions are evaluated natively.
+func TestFilterStringLiterals(t *testing.T) {
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal([]byte(`{"items": [{"label": "$.items"}, {"label": "@"}, {"label": "it's \"quoted\""}]}`)); err != nil {
+		t.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	for _, label := range []string{"$.items", "@", `it's "quoted"`} {
+		literal := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(label)
+		nodes, err := jsonMap.JsonPathSelector(fmt.Sprintf("$.items[?(@.label == '%s')].label", literal))
+		if err != nil {
+			t.Errorf("Could not select label %s: %v", label, err)
+		} else if len(nodes) != 1 || nodes[0].Value != label {
+			t.Errorf("Expected to select %s but selected %v", label, nodes)
+		}
+	}
+}
+
+// Filter expressions are evaluated natively by default, so Javascript which is not part of the filter expression syntax
+// causes a parse error unless the previous behaviour is opted into.
+func TestFilterNativeDefault(t *testing.T) {
+	if globals.FilterScriptLang != globals.NativeFilterScriptLang {
+		t.Fatalf("Expected filter expressions to be evaluated natively by default but they are evaluated using %q", globals.FilterScriptLang)
+	}
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal([]byte(`{"items": [{"v": 2}, {"v": 3}]}`)); err != nil {
+		t.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+
+	_, err := jsonMap.JsonPathSelector("$.items[?(@.v * 2 == 4)]")
+	if err == nil || !strings.HasPrefix(err.Error(), globals.JsonPathError.FillError().Error()) {
+		t.Fatalf("Expected a JsonPathError but got: %v", err)
+	}
+	if expected := `Could not parse the filter expression "@.v * 2 == 4": unexpected "* 2 == 4"`; !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected the error to contain %q but got: %v", expected, err)
+	}
+
+	// Javascript filter expressions can still be evaluated using otto
+	globals.FilterScriptLang = "js"
+	defer func() { globals.FilterScriptLang = globals.NativeFilterScriptLang }()
+	if nodes, err := jsonMap.JsonPathSelector("$.items[?(@.v * 2 == 4)].v"); err != nil {
+		t.Errorf("Could not select using Javascript: %v", err)
+	} else if len(nodes) != 1 || nodes[0].Value != 2.0 {
+		t.Errorf("Expected to select 2 but selected %v", nodes)
+	}
+}
+
+func BenchmarkFilter(b *testing.B) {
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal(exampleBytes); err != nil {
+		b.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	defer func() { globals.FilterScriptLang = globals.NativeFilterScriptLang }()
+	for _, filterLang := range []string{globals.NativeFilterScriptLang, "js"} {
+		b.Run(filterLang, func(bb *testing.B) {
+			globals.FilterScriptLang = filterLang
+			for i := 0; i < bb.N; i++ {
+				if _, err := jsonMap.JsonPathSelector("$..friends[?(@.age < 30 || @.age > $.over-forty)]"); err != nil {
+					bb.Fatalf("Could not select: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/andygello555/gotils/maps"
+	_go "github.com/andygello555/json-dom/code/go"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+var goCallbackTable = []struct{
+	name     string
+	callback interface{}
+	out      map[string]interface{}
+	// The error that should be panicked. Empty if no error should be panicked
+	err      globals.RuntimeError
+}{
+	{
+		name: "context",
+		callback: func(ctx context.Context, json json_map.JsonMapInt) error {
+			json.MustSet("$.hello", "go")
+			return nil
+		},
+		out:  map[string]interface{}{"hello": "go"},
+	},
+	{
+		name: "context_expression",
+		callback: func(ctx context.Context, json json_map.JsonMapInt) (interface{}, error) {
+			return json.MustGet("$.hello")[0], nil
+		},
+		out:  map[string]interface{}{"hello": "world", "script": "world"},
+	},
+	{
+		name: "context_error",
+		callback: func(ctx context.Context, json json_map.JsonMapInt) error {
+			return errors.New("callback error")
+		},
+		err:  globals.ScriptError,
+	},
+	{
+		name: "context_halting",
+		callback: func(ctx context.Context, json json_map.JsonMapInt) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		err:  globals.HaltingProblem,
+	},
+	{
+		name: "context_halting_error",
+		// Errors returned within the LeakGracePeriod are still reported
+		callback: func(ctx context.Context, json json_map.JsonMapInt) error {
+			<-ctx.Done()
+			return errors.New("callback error")
+		},
+		err:  globals.ScriptError,
+	},
+	{
+		name: "context_halting_panic",
+		// Panics within the LeakGracePeriod are still re-panicked
+		callback: func(ctx context.Context, json json_map.JsonMapInt) error {
+			<-ctx.Done()
+			panic(globals.JsonPathError.FillError("callback panic"))
+		},
+		err:  globals.JsonPathError,
+	},
+}
+
+func TestGoCallback(t *testing.T) {
+	for _, test := range goCallbackTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(`{"hello": "world"}`)); err != nil {
+				tt.Errorf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			jsonMap.MustSet("$.script", test.callback)
+
+			defer func() {
+				caught := recover()
+				if test.err == (globals.RuntimeError{}) {
+					if caught != nil {
+						tt.Errorf("Callback panicked: %v", caught)
+					}
+					maps.JsonMapEqualTest(tt, *jsonMap.GetInsides(), test.out, fmt.Sprintf("\"%s\"", test.name))
+					return
+				}
+				if err, ok := caught.(error); !ok || !strings.HasPrefix(err.Error(), test.err.FillError().Error()) {
+					tt.Errorf("Expected \"%s\" but got: %v", test.err.FillError().Error(), caught)
+				}
+			}()
+			jsonMap.RunWithOptions(context.Background(), jom.RunOptions{ScriptTimeout: 50 * time.Millisecond})
+		})
+	}
+}
+
+func TestGoCallbackLeak(t *testing.T) {
+	// Only events for the callback in this test are recorded
+	events := make(chan _go.LeakEvent, 2)
+	_go.LeakHook = func(event _go.LeakEvent) {
+		if event.ScopePath == "$.leak" {
+			events <- event
+		}
+	}
+	defer func() {
+		_go.LeakHook = nil
+	}()
+
+	// A callback which does not take a context cannot be stopped so it will be abandoned
+	returned := make(chan struct{})
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal([]byte(`{"leak": {"hello": "world"}}`)); err != nil {
+		t.Errorf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	before := _go.Leaked()
+	jsonMap.MustSet("$.leak.script", func(json json_map.JsonMapInt) {
+		<-returned
+	})
+
+	func() {
+		defer func() {
+			if caught := recover(); caught == nil {
+				t.Errorf("Callback did not halt")
+			}
+		}()
+		jsonMap.RunWithOptions(context.Background(), jom.RunOptions{ScriptTimeout: 50 * time.Millisecond})
+	}()
+
+	if event := <-events; event.Returned || event.Err == nil {
+		t.Errorf("Expected an abandoned LeakEvent but got: %+v", event)
+	}
+	if leaked := _go.Leaked(); leaked != before + 1 {
+		t.Errorf("Expected %d leaked callbacks but there are %d", before + 1, leaked)
+	}
+
+	// Once the callback returns the leak should be reported as returned
+	close(returned)
+	select {
+	case event := <-events:
+		if !event.Returned {
+			t.Errorf("Expected a returned LeakEvent but got: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Abandoned callback's return was not reported")
+	}
+	if leaked := _go.Leaked(); leaked != before {
+		t.Errorf("Expected %d leaked callbacks but there are %d", before, leaked)
+	}
+}
+
+func TestGoCallbackNoGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		jsonMap := jom.New()
+		if err := jsonMap.Unmarshal([]byte(`{"hello": "world"}`)); err != nil {
+			t.Errorf("Could not Unmarshal into JsonMap: %v", err)
+		}
+		jsonMap.MustSet("$.script", func(json json_map.JsonMapInt) {})
+		jsonMap.Run()
+	}
+
+	// Callbacks that finish should not leave any goroutines (or timers) behind. The callback goroutines may take a
+	// moment to exit after sending their results
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Expected at most %d goroutines but there are %d", before, after)
+	}
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"context"
+	"github.com/andygello555/json-dom/code/gosrc"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Records the LeakEvents for scripts within the scope at the given path until the returned function is called.
+func recordGosrcLeaks(scopePath string) (events chan gosrc.LeakEvent, stop func()) {
+	events = make(chan gosrc.LeakEvent, 2)
+	gosrc.LeakHook = func(event gosrc.LeakEvent) {
+		if event.ScopePath == scopePath {
+			events <- event
+		}
+	}
+	return events, func() {
+		gosrc.LeakHook = nil
+	}
+}
+
+// Runs the given Go source at $.<scopePath>.script and checks that it halts.
+func runGosrcHalting(t *testing.T, scopePath string, script string) {
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal([]byte(`{"` + scopePath + `": {"hello": "world"}}`)); err != nil {
+		t.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	jsonMap.MustSet("$." + scopePath + ".script", "#//!gosrc\n" + script)
+
+	defer func() {
+		if err, ok := recover().(error); !ok || !strings.HasPrefix(err.Error(), globals.HaltingProblem.FillError().Error()) {
+			t.Errorf("Expected \"%s\" but got: %v", globals.HaltingProblem.FillError().Error(), err)
+		}
+	}()
+	jsonMap.RunWithOptions(context.Background(), jom.RunOptions{ScriptTimeout: 50 * time.Millisecond})
+}
+
+// Scripts which are stopped by the interpreter are not abandoned and leave no goroutines behind.
+func TestGosrcHaltingNoLeak(t *testing.T) {
+	events, stop := recordGosrcLeaks("$.spin")
+	defer stop()
+
+	before, leaked := runtime.NumGoroutine(), gosrc.Leaked()
+	runGosrcHalting(t, "spin", `import (
+	"strconv"
+	"github.com/andygello555/json-dom/jom/json_map"
+)
+
+func Run(json json_map.JsonMapInt) {
+	for i := 0; ; i++ {
+		_ = json.JsonPathSetter("$." + strconv.Itoa(i), float64(i))
+	}
+}`)
+
+	select {
+	case event := <-events:
+		t.Errorf("Expected no LeakEvents but got: %+v", event)
+	default:
+	}
+	if after := gosrc.Leaked(); after != leaked {
+		t.Errorf("Expected %d leaked scripts but there are %d", leaked, after)
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Expected at most %d goroutines but there are %d", before, after)
+	}
+}
+
+// Scripts which are blocked within a call to a package cannot be stopped so they are abandoned.
+func TestGosrcLeak(t *testing.T) {
+	allowedPackages := gosrc.AllowedPackages
+	gosrc.AllowedPackages = append(append([]string{}, allowedPackages...), "time")
+	defer func() {
+		gosrc.AllowedPackages = allowedPackages
+	}()
+	events, stop := recordGosrcLeaks("$.leak")
+	defer stop()
+
+	before := gosrc.Leaked()
+	runGosrcHalting(t, "leak", `import (
+	"time"
+	"github.com/andygello555/json-dom/jom/json_map"
+)
+
+func Run(json json_map.JsonMapInt) {
+	time.Sleep(500 * time.Millisecond)
+}`)
+
+	if event := <-events; event.Returned || event.Err == nil {
+		t.Errorf("Expected an abandoned LeakEvent but got: %+v", event)
+	}
+	if leaked := gosrc.Leaked(); leaked != before + 1 {
+		t.Errorf("Expected %d leaked scripts but there are %d", before + 1, leaked)
+	}
+
+	// Once the script returns the leak should be reported as returned
+	select {
+	case event := <-events:
+		if !event.Returned {
+			t.Errorf("Expected a returned LeakEvent but got: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Abandoned script's return was not reported")
+	}
+	if leaked := gosrc.Leaked(); leaked != before {
+		t.Errorf("Expected %d leaked scripts but there are %d", before, leaked)
+	}
+}
@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/andygello555/gotils/maps"
+	"github.com/andygello555/json-dom/code/js"
+	"github.com/andygello555/json-dom/jom"
+	"strings"
+	"testing"
+)
+
+// Scripts which leave something behind in their VM. The checker is run after the polluter and should not be able to
+// see anything left behind by it.
+var jsPoolTable = []struct{
+	name     string
+	polluter string
+	checker  string
+	expected interface{}
+}{
+	{
+		name:     "global_var",
+		polluter: "var leaked = 1;",
+		checker:  "typeof leaked",
+		expected: "undefined",
+	},
+	{
+		name:     "implicit_global",
+		polluter: "leaked = 1;",
+		checker:  "typeof leaked",
+		expected: "undefined",
+	},
+	{
+		name:     "global_function",
+		polluter: "function leaked() {}",
+		checker:  "typeof leaked",
+		expected: "undefined",
+	},
+	{
+		name:     "prototype_added",
+		polluter: "Array.prototype.leaked = 1;",
+		checker:  "typeof [].leaked",
+		expected: "undefined",
+	},
+	{
+		name:     "prototype_modified",
+		polluter: "Array.prototype.join = function() { return 'leaked'; };",
+		checker:  "[1, 2].join('-')",
+		expected: "1-2",
+	},
+	{
+		name:     "builtin_modified",
+		polluter: "JSON.stringify = function() { return '{}'; };",
+		checker:  "JSON.stringify({a: 1})",
+		expected: `{"a":1}`,
+	},
+	{
+		name:     "console_modified",
+		polluter: "console.log = null;",
+		checker:  "typeof console.log",
+		expected: "function",
+	},
+	{
+		name:     "non_enumerable_global",
+		polluter: "Object.defineProperty(this, 'leaked', {value: 1, enumerable: false});",
+		checker:  "typeof leaked",
+		expected: "undefined",
+	},
+	{
+		name:     "non_enumerable_prototype",
+		polluter: "Object.defineProperty(Array.prototype, 'leaked', {value: 1, enumerable: false});",
+		checker:  "typeof [].leaked",
+		expected: "undefined",
+	},
+	{
+		name:     "non_enumerable_builtin",
+		polluter: "Object.defineProperty(Math, 'leaked', {value: 1, enumerable: false});",
+		checker:  "typeof Math.leaked",
+		expected: "undefined",
+	},
+	{
+		name:     "non_enumerable_properties",
+		polluter: "Object.defineProperties(this, {leaked: {value: 1, enumerable: false}});",
+		checker:  "typeof leaked",
+		expected: "undefined",
+	},
+	{
+		name:     "non_enumerable_aliased",
+		polluter: "var o = Object; o['define' + 'Property'].call(null, this, 'leaked', {value: 1});",
+		checker:  "typeof leaked",
+		expected: "undefined",
+	},
+	{
+		name:     "jom_modified",
+		polluter: "json.scopePath = 1;",
+		checker:  "typeof json.scopePath",
+		expected: "string",
+	},
+}
+
+func TestJSPool(t *testing.T) {
+	for _, test := range jsPoolTable {
+		t.Run(test.name, func(tt *testing.T) {
+			// Each script is run multiple times so that VMs are reused
+			var b strings.Builder
+			b.WriteString("[")
+			for i := 0; i < 10; i++ {
+				if i > 0 {
+					b.WriteString(",")
+				}
+				_, _ = fmt.Fprintf(&b, `{"a": %q, "b": %q}`, "#//!js\n" + test.polluter, "#//!js=\n" + test.checker)
+			}
+			b.WriteString("]")
+
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(b.String())); err != nil {
+				tt.Errorf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			jsonMap.Run()
+			for i, element := range (*jsonMap.GetInsides())["array"].([]interface{}) {
+				maps.JsonMapEqualTest(tt, element, map[string]interface{}{"b": test.expected}, fmt.Sprintf("\"%s\"[%d]", test.name, i))
+			}
+		})
+	}
+}
+
+// Nothing left behind by a script in one document, including non-enumerable globals, can be seen by scripts in other
+// documents.
+func TestJSPoolSeparateDocuments(t *testing.T) {
+	polluter := []byte(`{"script": "#//!js\nObject.defineProperty(this, \"secret\", {value: \"tenantA\", enumerable: false});"}`)
+	checker := []byte(`{"leak": "#//!js=\ntypeof secret === \"undefined\" ? null : secret"}`)
+	for i := 0; i < 10; i++ {
+		if _, err := jom.Eval(polluter, false); err != nil {
+			t.Fatalf("Could not evaluate polluter: %v", err)
+		}
+		out, err := jom.Eval(checker, false)
+		if err != nil {
+			t.Fatalf("Could not evaluate checker: %v", err)
+		}
+		if string(out) != `{"leak":null}` {
+			t.Fatalf("Expected {\"leak\":null} but got: %s", string(out))
+		}
+	}
+}
+
+// Scripts which override JSON.stringify still have their trail written back, as the trail is stringified using the
+// VM's own JSON.stringify.
+func TestJSStringifyOverridden(t *testing.T) {
+	for _, script := range []string{
+		"JSON.stringify = function() { return '{}'; }; json.trail.b = 2;",
+		"JSON = null; json.trail.b = 2;",
+	} {
+		out, err := jom.Eval([]byte(fmt.Sprintf(`{"a": 1, "script": %q}`, "#//!js\n" + script)), false)
+		if err != nil {
+			t.Fatalf("Could not evaluate %q: %v", script, err)
+		}
+		if string(out) != `{"a":1,"b":2}` {
+			t.Errorf("Expected {\"a\":1,\"b\":2} for %q but got: %s", script, string(out))
+		}
+	}
+}
+
+// Creates a document with an array of the given number of elements, each of which contain the same script.
+func jsArrayDocument(elements int) []byte {
+	var b strings.Builder
+	b.WriteString("[")
+	for i := 0; i < elements; i++ {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		_, _ = fmt.Fprintf(&b, `{"i": %d, "script": "#//!js\nif (json.trail.i %% 2 === 0) { json.trail.even = true; }\njson.trail.i *= 2;"}`, i)
+	}
+	b.WriteString("]")
+	return []byte(b.String())
+}
+
+func BenchmarkJSArray(b *testing.B) {
+	document := jsArrayDocument(10000)
+	for _, benchmark := range []struct{
+		name            string
+		useVMPool       bool
+		scriptCacheSize int
+	}{
+		{"no_pool_no_cache", false, 0},
+		{"cache", false, 1024},
+		{"pool", true, 0},
+		{"pool_and_cache", true, 1024},
+	} {
+		b.Run(benchmark.name, func(bb *testing.B) {
+			useVMPool, scriptCacheSize := js.UseVMPool, js.ScriptCacheSize
+			js.UseVMPool, js.ScriptCacheSize = benchmark.useVMPool, benchmark.scriptCacheSize
+			defer func() {
+				js.UseVMPool, js.ScriptCacheSize = useVMPool, scriptCacheSize
+			}()
+
+			for i := 0; i < bb.N; i++ {
+				if _, err := jom.Eval(document, false); err != nil {
+					bb.Fatalf("Could not evaluate document: %v", err)
+				}
+			}
+		})
+	}
+}
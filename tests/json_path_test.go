@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 var exampleBytes = []byte(`
@@ -468,24 +469,285 @@ func TestAbsolutePath(t *testing.T) {
 }
 
 func TestJsonPathSelector(t *testing.T) {
-	// Iterate over all example JSON path expressions and see if it matches it's expected output
-	for i, jsonPath := range exampleJsonPathInput {
-		nodes, err := example.JsonPathSelector(jsonPath)
+	// Filter expressions are evaluated using each of the languages that support them
+	defer func() { globals.FilterScriptLang = globals.NativeFilterScriptLang }()
+	for _, filterLang := range []string{globals.NativeFilterScriptLang, "js", "es"} {
+		globals.FilterScriptLang = filterLang
+		t.Run(filterLang, func(tt *testing.T) {
+			// Iterate over all example JSON path expressions and see if it matches it's expected output
+			for i, jsonPath := range exampleJsonPathInput {
+				nodes, err := example.JsonPathSelector(jsonPath)
+				if err != nil {
+					tt.Errorf("The following error happened whilst evaluating the JSON path %s: %v", jsonPath, err)
+					continue
+				}
+
+				// Create a new array which contains just the value of each returned JsonPathNode
+				nodeVals := make([]interface{}, 0)
+				for _, node := range nodes {
+					nodeVals = append(nodeVals, node.Value)
+				}
+				// Use reflect.DeepEqual to check equality between expected and array of nodeVals
+				if !slices.SameElements(nodeVals, exampleJsonPathOutput[i]) {
+					tt.Errorf("%v and %v are not equal (JSON path: %s)", nodeVals, exampleJsonPathOutput[i], jsonPath)
+				}
+			}
+		})
+	}
+}
+
+// Filter expressions which never finish are halted after the same limit by each of the languages that support them.
+func TestJsonPathSelectorFilterHalting(t *testing.T) {
+	defer func() { globals.FilterScriptLang = globals.NativeFilterScriptLang }()
+	for _, filterLang := range []string{"js", "es"} {
+		globals.FilterScriptLang = filterLang
+		t.Run(filterLang, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(`{"list": [1]}`)); err != nil {
+				tt.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+			}
+
+			start := time.Now()
+			_, err := jsonMap.JsonPathSelector("$.list[?(@ > 0 && (function () { while (true) {} })())]")
+			if duration := time.Since(start); duration >= 2 * globals.HaltingDelayUnits {
+				tt.Errorf("Filter expression was not halted after %s, took: %s", globals.HaltingDelayUnits.String(), duration.String())
+			}
+			if err == nil || !strings.Contains(err.Error(), globals.HaltingProblem.FillError().Error()) {
+				tt.Errorf("Expected \"%s\" but got: %v", globals.HaltingProblem.FillError().Error(), err)
+			}
+		})
+	}
+}
+
+// The location of the JSONPath compliance test suite cases (in the format of the jsonpath-compliance-test-suite's
+// cts.json) which JSON paths parsed in strict mode should conform to.
+const jsonPathComplianceLocation = "../assets/tests/jsonpath_cts/cts.json"
+
+// A test case within the JSONPath compliance test suite.
+type jsonPathComplianceTest struct {
+	Name            string          `json:"name"`
+	Selector        string          `json:"selector"`
+	Document        interface{}     `json:"document"`
+	// The expected values, or a list of the possible expected values if the order is not deterministic
+	Result          []interface{}   `json:"result"`
+	Results         [][]interface{} `json:"results"`
+	// The expected normalized paths, if given
+	ResultPaths     []string        `json:"result_paths"`
+	InvalidSelector bool            `json:"invalid_selector"`
+}
+
+func TestJsonPathStrictCompliance(t *testing.T) {
+	ctsBytes, err := ioutil.ReadFile(jsonPathComplianceLocation)
+	if err != nil {
+		t.Fatalf("Could not read compliance test suite: %v", err)
+	}
+	var cts struct {
+		Tests []jsonPathComplianceTest `json:"tests"`
+	}
+	if err = json.Unmarshal(ctsBytes, &cts); err != nil {
+		t.Fatalf("Could not unmarshal compliance test suite: %v", err)
+	}
+
+	for _, test := range cts.Tests {
+		t.Run(test.Name, func(tt *testing.T) {
+			path, err := json_map.ParseJsonPathStrict(test.Selector)
+			if test.InvalidSelector {
+				if err == nil {
+					tt.Errorf("Expected selector %q to be invalid", test.Selector)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("Could not parse selector %q: %v", test.Selector, err)
+			}
+
+			nodes := path.Select(test.Document)
+			values := make([]interface{}, 0)
+			paths := make([]string, 0)
+			for _, node := range nodes {
+				values = append(values, node.Value)
+				normalized, err := json_map.NormalizedPath(node.Absolute)
+				if err != nil {
+					tt.Fatalf("Could not format the path of %v: %v", node.Value, err)
+				}
+				paths = append(paths, normalized)
+			}
+
+			actual, _ := json.Marshal(values)
+			expected := test.Results
+			if test.Results == nil {
+				expected = [][]interface{}{test.Result}
+			}
+			matched := false
+			for _, result := range expected {
+				if expectedBytes, _ := json.Marshal(result); string(expectedBytes) == string(actual) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				tt.Errorf("Selector %q selected %s but expected one of %v", test.Selector, string(actual), expected)
+			}
+			if test.ResultPaths != nil && fmt.Sprint(paths) != fmt.Sprint(test.ResultPaths) {
+				tt.Errorf("Selector %q selected paths %v but expected %v", test.Selector, paths, test.ResultPaths)
+			}
+		})
+	}
+}
+
+// Strict mode JSON paths on the example document. If expected is nil then the JSON path should not parse.
+var exampleJsonPathStrictTable = []struct{
+	jsonPath string
+	expected []interface{}
+}{
+	{"$.person.friends[?@.age > $['over-forty']].name", []interface{}{"Bob Smith"}},
+	{"$.person.friends[?(@.age > $['over-forty'])].name", []interface{}{"Bob Smith"}},
+	{"$.person.friends[::2].name", []interface{}{"Jane Doe", "Dwayne Johnson", "Elizabeth Swindon"}},
+	{"$.person.friends[-2:].name", []interface{}{"Elizabeth Swindon", "Frank Bob"}},
+	{"$.person['name', 'age']", []interface{}{"John Smith", 18.0}},
+	{"$.person.friends[?!@.age].name", []interface{}{"Frank Bob"}},
+	{"$.person.friends[?length(@.name) >= 14].name", []interface{}{"Dwayne Johnson", "Elizabeth Swindon"}},
+	{"$.person.children", []interface{}{}},
+	{"$..friends[?(@.age > $.over-forty)]", nil},
+	{"$...friends", nil},
+	{"$.person.friends.[0]", nil},
+	{"$.person.friends[?(typeof @.age == 'number')]", nil},
+}
+
+func TestJsonPathSelectorStrict(t *testing.T) {
+	for _, test := range exampleJsonPathStrictTable {
+		nodes, err := example.JsonPathSelectorStrict(test.jsonPath)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("Expected JSON path %s to be invalid in strict mode", test.jsonPath)
+			}
+			continue
+		}
 		if err != nil {
-			t.Errorf("The following error happened whilst evaluating the JSON path %s: %v", jsonPath, err)
+			t.Errorf("The following error happened whilst evaluating the JSON path %s: %v", test.jsonPath, err)
 			continue
 		}
 
-		// Create a new array which contains just the value of each returned JsonPathNode
 		nodeVals := make([]interface{}, 0)
 		for _, node := range nodes {
 			nodeVals = append(nodeVals, node.Value)
 		}
-		// Use reflect.DeepEqual to check equality between expected and array of nodeVals
-		if !slices.SameElements(nodeVals, exampleJsonPathOutput[i]) {
-			t.Errorf("%v and %v are not equal (JSON path: %s)", nodeVals, exampleJsonPathOutput[i], jsonPath)
+		if fmt.Sprint(nodeVals) != fmt.Sprint(test.expected) {
+			t.Errorf("%v and %v are not equal (JSON path: %s)", nodeVals, test.expected, test.jsonPath)
 		}
 	}
+
+	// The root of the JSON path is the array when the JsonMap is an array root
+	arrayRoot := jom.New()
+	if err := arrayRoot.Unmarshal([]byte(`[{"a": 1}, {"a": 2}]`)); err != nil {
+		t.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	if nodes, err := arrayRoot.JsonPathSelectorStrict("$[?@.a > 1].a"); err != nil {
+		t.Errorf("Could not evaluate JSON path on array root: %v", err)
+	} else if path, _ := json_map.NormalizedPath(nodes[0].Absolute); len(nodes) != 1 || nodes[0].Value != 2.0 || path != "$[1]['a']" {
+		t.Errorf("Expected 2 at $[1]['a'] but got %v", nodes)
+	}
+}
+
+// A document with member names that cannot be given as properties in JSON paths.
+var quotedBytes = []byte(`{
+	"first name": "John",
+	"a.b": {"$": 1, "2nd": [10, 20]},
+	"it's": {"\\": "backslash", "\"": "quote"},
+	"ключ": {"значение": "value", "name": "nested"},
+	"नाम": "naam",
+	"cafe\u0301": "decomposed",
+	"people": [{"first name": "Jane"}, {"first name": "Bob"}]
+}`)
+
+// JSON paths with quoted property names and the values they should select from quotedBytes. If expected is nil then
+// the JSON path should not parse.
+var quotedJsonPathTable = []struct{
+	jsonPath string
+	expected []interface{}
+}{
+	{`$['first name']`, []interface{}{"John"}},
+	{`$["first name"]`, []interface{}{"John"}},
+	{`$['a.b']['$']`, []interface{}{1.0}},
+	{`$['a.b']['2nd'][1]`, []interface{}{20.0}},
+	{`$['a.b'].['2nd'].[0]`, []interface{}{10.0}},
+	{`$['it\'s']['\\']`, []interface{}{"backslash"}},
+	{`$["it's"]["\""]`, []interface{}{"quote"}},
+	{`$['\u043a\u043b\u044e\u0447'].name`, []interface{}{"nested"}},
+	{`$.ключ.значение`, []interface{}{"value"}},
+	{`$.ключ.name`, []interface{}{"nested"}},
+	{`$.ключ['name']`, []interface{}{"nested"}},
+	{`$.नाम`, []interface{}{"naam"}},
+	{`$['नाम']`, []interface{}{"naam"}},
+	{"$.cafe\u0301", []interface{}{"decomposed"}},
+	{`$..значение`, []interface{}{"value"}},
+	{`$["ключ"]['значение']`, []interface{}{"value"}},
+	{`$.people[*]['first name']`, []interface{}{"Jane", "Bob"}},
+	{`$['first name', "ключ"]`, []interface{}{"John", map[string]interface{}{"значение": "value", "name": "nested"}}},
+	{`$.people..['first name']`, []interface{}{"Jane", "Bob"}},
+	{`$.people[?(@['first name'] == 'Bob')]['first name']`, []interface{}{"Bob"}},
+	{`$['first name`, nil},
+	{`$['first name'`, nil},
+	{`$[first name]`, nil},
+	{`$['\u12']`, nil},
+}
+
+func TestQuotedJsonPathSelector(t *testing.T) {
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal(quotedBytes); err != nil {
+		t.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	for _, test := range quotedJsonPathTable {
+		nodes, err := jsonMap.JsonPathSelector(test.jsonPath)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("Expected JSON path %s to be invalid", test.jsonPath)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("The following error happened whilst evaluating the JSON path %s: %v", test.jsonPath, err)
+			continue
+		}
+
+		nodeVals := make([]interface{}, 0)
+		for _, node := range nodes {
+			nodeVals = append(nodeVals, node.Value)
+		}
+		if !slices.SameElements(nodeVals, test.expected) {
+			t.Errorf("%v and %v are not equal (JSON path: %s)", nodeVals, test.expected, test.jsonPath)
+		}
+	}
+}
+
+// Quoted property names can be set, and can be selected using json.jsonPathSelector. Scope paths quote member names
+// that cannot be given as properties.
+func TestQuotedJsonPathSetter(t *testing.T) {
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal([]byte(`{"名前": {"last name": "Smith"}, "list": [{"a b": {}}]}`)); err != nil {
+		t.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	jsonMap.MustSet(`$['名前']['first name']`, "John")
+	jsonMap.MustSet(`$.list[0]['a b']['script']`, "#//!js\njson.trail['c.d'] = json.scopePath;")
+	jsonMap.MustSet(`$['script']`, `#//!js
+json.jsonPathSelector("$['名前']['last name', 'first name']").setValues("Doe");
+json.trail.selected = json.jsonPathSelector("$..['last name']").getValues();`)
+	jsonMap.Run()
+
+	expected := `{"list":[{"a b":{"c.d":"$.list[0]['a b']"}}],"selected":["Doe"],"名前":{"first name":"Doe","last name":"Doe"}}`
+	if out, err := jsonMap.Marshal(); err != nil {
+		t.Errorf("Could not Marshal JsonMap: %v", err)
+	} else if string(out) != expected {
+		t.Errorf("Expected %s but got: %s", expected, string(out))
+	}
+
+	// Scope paths can be used as JSON paths in both dialects
+	if nodes, err := jsonMap.JsonPathSelector(`$.list[0]['a b']['c.d']`); err != nil || len(nodes) != 1 {
+		t.Errorf("Could not select the scope path: %v", err)
+	}
+	if nodes, err := jsonMap.JsonPathSelectorStrict(`$.list[0]['a b']['c.d']`); err != nil || len(nodes) != 1 {
+		t.Errorf("Could not select the scope path in strict mode: %v", err)
+	}
 }
 
 func TestSetAbsolutePaths(t *testing.T) {
@@ -0,0 +1,270 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// The example document from section 5 of RFC 6901.
+var pointerBytes = []byte(`{
+	"foo": ["bar", "baz"],
+	"": 0,
+	"a/b": 1,
+	"c%d": 2,
+	"e^f": 3,
+	"g|h": 4,
+	"i\\j": 5,
+	"k\"l": 6,
+	" ": 7,
+	"m~n": 8,
+	"01": 9,
+	"10": {"2": "ten two"}
+}`)
+
+// JSON pointers and the JSON of the values they should point to within pointerBytes. If expected is empty then the JSON
+// pointer should not point to a value.
+var pointerGetTable = []struct{
+	pointer  string
+	expected string
+}{
+	{"", `{"":0," ":7,"01":9,"10":{"2":"ten two"},"a/b":1,"c%d":2,"e^f":3,"foo":["bar","baz"],"g|h":4,"i\\j":5,"k\"l":6,"m~n":8}`},
+	{"/foo", `["bar","baz"]`},
+	{"/foo/0", `"bar"`},
+	{"/", `0`},
+	{"/a~1b", `1`},
+	{"/c%d", `2`},
+	{"/e^f", `3`},
+	{"/g|h", `4`},
+	{"/i\\j", `5`},
+	{"/k\"l", `6`},
+	{"/ ", `7`},
+	{"/m~0n", `8`},
+	{"/01", `9`},
+	{"/10/2", `"ten two"`},
+	{"/foo/2", ""},
+	{"/foo/-", ""},
+	{"/foo/01", ""},
+	{"/foo/0/bar", ""},
+	{"/missing", ""},
+	{"foo", ""},
+	{"/m~2n", ""},
+	{"/m~", ""},
+}
+
+func TestPointerGet(t *testing.T) {
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal(pointerBytes); err != nil {
+		t.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	for _, test := range pointerGetTable {
+		value, err := jsonMap.PointerGet(test.pointer)
+		if test.expected == "" {
+			if err == nil || !strings.HasPrefix(err.Error(), globals.JsonPointerError.FillError().Error()) {
+				t.Errorf("Expected a JsonPointerError for %q but got: %v", test.pointer, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Could not get %q: %v", test.pointer, err)
+			continue
+		}
+		if out, _ := json.Marshal(value); string(out) != test.expected {
+			t.Errorf("Expected %q to point to %s but got: %s", test.pointer, test.expected, string(out))
+		}
+	}
+}
+
+// JSON pointers which are set (or deleted if value is nil) in order, and the expected document afterwards. If expected
+// is empty then setting should fail.
+var pointerSetTable = []struct{
+	name     string
+	document string
+	pointers []string
+	values   []interface{}
+	expected string
+}{
+	{"replace", `{"a": {"b": 1}}`, []string{"/a/b"}, []interface{}{2.0}, `{"a":{"b":2}}`},
+	{"add_member", `{"a": {}}`, []string{"/a/b c"}, []interface{}{"d"}, `{"a":{"b c":"d"}}`},
+	{"numeric_member", `{"a": {}}`, []string{"/a/0"}, []interface{}{"zero"}, `{"a":{"0":"zero"}}`},
+	{"replace_element", `{"a": [1, 2]}`, []string{"/a/1"}, []interface{}{3.0}, `{"a":[1,3]}`},
+	{"append", `{"a": [1]}`, []string{"/a/-", "/a/2"}, []interface{}{2.0, 3.0}, `{"a":[1,2,3]}`},
+	{"append_nested", `{"a": [[1]]}`, []string{"/a/0/-"}, []interface{}{2.0}, `{"a":[[1,2]]}`},
+	{"null", `{"a": 1}`, []string{"/a"}, []interface{}{json.RawMessage("null")}, `{"a":null}`},
+	{"delete_member", `{"a": 1, "b": 2}`, []string{"/a"}, []interface{}{nil}, `{"b":2}`},
+	{"delete_element", `{"a": [1, 2, 3]}`, []string{"/a/0", "/a/1"}, []interface{}{nil, nil}, `{"a":[2]}`},
+	{"delete_nested", `{"a": [{"b": [1, 2]}]}`, []string{"/a/0/b/1"}, []interface{}{nil}, `{"a":[{"b":[1]}]}`},
+	{"root", `{"a": 1}`, []string{""}, []interface{}{map[string]interface{}{"b": 2.0}}, `{"b":2}`},
+	{"root_array", `{"a": 1}`, []string{"", "/-"}, []interface{}{[]interface{}{1.0}, 2.0}, `[1,2]`},
+	{"array_root", `[[1], 2]`, []string{"/0/-", "/1"}, []interface{}{3.0, nil}, `[[1,3]]`},
+	{"missing_parent", `{"a": {}}`, []string{"/b/c"}, []interface{}{1.0}, ""},
+	{"out_of_range", `{"a": [1]}`, []string{"/a/2"}, []interface{}{1.0}, ""},
+	{"not_index", `{"a": [1]}`, []string{"/a/b"}, []interface{}{1.0}, ""},
+	{"delete_end", `{"a": [1]}`, []string{"/a/-"}, []interface{}{nil}, ""},
+	{"delete_missing", `{"a": {}}`, []string{"/a/b"}, []interface{}{nil}, ""},
+	{"delete_root", `{"a": 1}`, []string{""}, []interface{}{nil}, ""},
+	{"scalar_parent", `{"a": 1}`, []string{"/a/b"}, []interface{}{1.0}, ""},
+}
+
+func TestPointerSet(t *testing.T) {
+	for _, test := range pointerSetTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(test.document)); err != nil {
+				tt.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			var err error
+			for i, pointer := range test.pointers {
+				switch value := test.values[i].(type) {
+				case nil:
+					err = jsonMap.PointerDelete(pointer)
+				case json.RawMessage:
+					err = jsonMap.PointerSet(pointer, nil)
+				default:
+					err = jsonMap.PointerSet(pointer, value)
+				}
+				if err != nil {
+					break
+				}
+			}
+			if test.expected == "" {
+				if err == nil || !strings.HasPrefix(err.Error(), globals.JsonPointerError.FillError().Error()) {
+					tt.Errorf("Expected a JsonPointerError but got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("Could not set %v: %v", test.pointers, err)
+			}
+			if out, err := jsonMap.Marshal(); err != nil {
+				tt.Errorf("Could not Marshal JsonMap: %v", err)
+			} else if string(out) != test.expected {
+				tt.Errorf("Expected %s but got: %s", test.expected, string(out))
+			}
+		})
+	}
+}
+
+// The absolute paths of nodes selected using JSON paths can be formatted as JSON pointers which point to the same
+// nodes.
+func TestPointerFromJsonPath(t *testing.T) {
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal(pointerBytes); err != nil {
+		t.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	nodes, err := jsonMap.JsonPathSelectorStrict("$..*")
+	if err != nil {
+		t.Fatalf("Could not select nodes: %v", err)
+	}
+	for _, node := range nodes {
+		pointer, err := json_map.JsonPointer(node.Absolute)
+		if err != nil {
+			t.Errorf("Could not format %v as a JSON pointer: %v", node.Absolute, err)
+			continue
+		}
+		if value, err := jsonMap.PointerGet(pointer); err != nil {
+			t.Errorf("Could not get %q: %v", pointer, err)
+		} else if fmt.Sprint(value) != fmt.Sprint(node.Value) {
+			t.Errorf("Expected %q to point to %v but got: %v", pointer, node.Value, value)
+		}
+	}
+
+	// Arrays selected by the default dialect are unwrapped into a node for each element
+	if nodes, err = jsonMap.JsonPathSelector("$.foo"); err != nil {
+		t.Errorf("Could not select nodes: %v", err)
+	}
+	for i, node := range nodes {
+		if pointer, err := json_map.JsonPointer(node.Absolute); err != nil || pointer != fmt.Sprintf("/foo/%d", i) {
+			t.Errorf("Expected /foo/%d but got %q: %v", i, pointer, err)
+		}
+	}
+
+	// Absolute paths which are not made up of member names and indices, such as the ones that JSON paths are parsed
+	// into, cannot be formatted
+	if _, err = json_map.JsonPointer([]json_map.AbsolutePathKey{{KeyType: json_map.Wildcard, Value: nil}}); err == nil {
+		t.Errorf("Expected a wildcard to not be formatted as a JSON pointer")
+	}
+}
+
+// JSON paths and the JSON pointers (in any order) of the nodes they select within pointerSelectorBytes.
+var pointerSelectorBytes = []byte(`{
+	"arr": [{"q r": 1, "n": 1}, {"q r": 2, "n": 2, "in": {"x y": [5, 6]}}, {"q r": 3, "n": 3}],
+	"obj": {"a": 1, "b": {"x y": 4}}
+}`)
+
+var pointerSelectorTable = []struct{
+	jsonPath string
+	pointers []string
+}{
+	{"$.arr[*]['q r']", []string{"/arr/0/q r", "/arr/1/q r", "/arr/2/q r"}},
+	{"$.obj.*", []string{"/obj/a", "/obj/b"}},
+	{"$..['x y']", []string{"/arr/1/in/x y/0", "/arr/1/in/x y/1", "/obj/b/x y"}},
+	{"$..n", []string{"/arr/0/n", "/arr/1/n", "/arr/2/n"}},
+	{"$.arr[1:]", []string{"/arr/1", "/arr/2"}},
+	{"$.arr[-1:]['q r']", []string{"/arr/2/q r"}},
+	{"$.arr[?(@.n > 1)].n", []string{"/arr/1/n", "/arr/2/n"}},
+	{"$.obj[?(@ == 1)]", []string{"/obj/a"}},
+	{"$.arr[1].in['x y']", []string{"/arr/1/in/x y/0", "/arr/1/in/x y/1"}},
+}
+
+// The absolute paths of nodes selected using the default dialect only contain member names and indices, so they can
+// be formatted as JSON pointers which point to the same nodes.
+func TestPointerFromJsonPathSelector(t *testing.T) {
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal(pointerSelectorBytes); err != nil {
+		t.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	for _, test := range pointerSelectorTable {
+		t.Run(test.jsonPath, func(tt *testing.T) {
+			nodes, err := jsonMap.JsonPathSelector(test.jsonPath)
+			if err != nil {
+				tt.Fatalf("Could not select nodes: %v", err)
+			}
+			pointers := make([]string, 0)
+			for _, node := range nodes {
+				pointer, err := json_map.JsonPointer(node.Absolute)
+				if err != nil {
+					tt.Errorf("Could not format %v as a JSON pointer: %v", node.Absolute, err)
+					continue
+				}
+				if value, err := jsonMap.PointerGet(pointer); err != nil {
+					tt.Errorf("Could not get %q: %v", pointer, err)
+				} else if fmt.Sprint(value) != fmt.Sprint(node.Value) {
+					tt.Errorf("Expected %q to point to %v but got: %v", pointer, node.Value, value)
+				}
+				pointers = append(pointers, pointer)
+			}
+			sort.Strings(pointers)
+			if fmt.Sprint(pointers) != fmt.Sprint(test.pointers) {
+				tt.Errorf("Expected %q but got: %q", test.pointers, pointers)
+			}
+		})
+	}
+}
+
+func TestPointerJS(t *testing.T) {
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal([]byte(`{"people": [{"name": "Jane"}, {"name": "Bob"}], "a/b": {"~": 1}}`)); err != nil {
+		t.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	jsonMap.MustSet("$.script", `#//!js
+json.trail.first = json.pointer("/people/0/name").getValue();
+json.trail.escaped = json.pointer("/a~1b/~0").getValue();
+json.pointer("/people/-").setValue({name: "Gary"});
+json.pointer("/people/1").deleteValue();
+json.trail.invalid = false;
+try { json.pointer("/people/5").getValue(); } catch (e) { json.trail.invalid = e.name; }`)
+	jsonMap.Run()
+
+	expected := `{"a/b":{"~":1},"escaped":1,"first":"Jane","invalid":"JSONPointerError","people":[{"name":"Jane"},{"name":"Gary"}]}`
+	if out, err := jsonMap.Marshal(); err != nil {
+		t.Errorf("Could not Marshal JsonMap: %v", err)
+	} else if string(out) != expected {
+		t.Errorf("Expected %s but got: %s", expected, string(out))
+	}
+}
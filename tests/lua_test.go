@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"github.com/andygello555/json-dom/jom"
+	"testing"
+)
+
+// Documents containing arrays with null elements, and what they should evaluate to once the given Lua script is run.
+var luaNullTable = []struct{
+	name     string
+	document string
+	script   string
+	expected string
+}{
+	{
+		name:     "trailing_null",
+		document: `{"a": [1, null]}`,
+		expected: `{"a":[1,null]}`,
+	},
+	{
+		name:     "trailing_nulls",
+		document: `{"a": [1, null, null]}`,
+		expected: `{"a":[1,null,null]}`,
+	},
+	{
+		name:     "interior_null",
+		document: `{"a": [1, null, 3]}`,
+		expected: `{"a":[1,null,3]}`,
+	},
+	{
+		name:     "only_nulls",
+		document: `{"a": [null, null]}`,
+		expected: `{"a":[null,null]}`,
+	},
+	{
+		name:     "nested_trailing_nulls",
+		document: `{"a": [[null], {"b": [true, null]}, null]}`,
+		expected: `{"a":[[null],{"b":[true,null]},null]}`,
+	},
+	{
+		name:     "read_trailing_null",
+		document: `{"a": [1, null]}`,
+		script:   "json.trail.b = json.trail.a[2] == nil",
+		expected: `{"a":[1,null],"b":true}`,
+	},
+	{
+		name:     "set_trailing_null",
+		document: `{"a": [1, null]}`,
+		script:   "json.trail.a[2] = 2",
+		expected: `{"a":[1,2]}`,
+	},
+	{
+		name:     "append_after_trailing_null",
+		document: `{"a": [1, null]}`,
+		script:   "json.trail.a[3] = 3",
+		expected: `{"a":[1,null,3]}`,
+	},
+	{
+		name:     "remove_before_trailing_null",
+		document: `{"a": [1, 2, null]}`,
+		script:   "table.remove(json.trail.a, 1)",
+		expected: `{"a":[2]}`,
+	},
+	{
+		name:     "shorten",
+		document: `{"a": [1, 2]}`,
+		script:   "json.trail.a[2] = nil",
+		expected: `{"a":[1]}`,
+	},
+	{
+		name:     "object_null",
+		document: `{"a": {"b": null, "c": 1}}`,
+		script:   "json.trail.a.c = 2",
+		expected: `{"a":{"b":null,"c":2}}`,
+	},
+	{
+		// Setting a key to nil cannot be told apart from leaving it as null
+		name:     "object_null_set_nil",
+		document: `{"a": {"b": null}}`,
+		script:   "json.trail.a.b = nil",
+		expected: `{"a":{"b":null}}`,
+	},
+	{
+		name:     "object_null_set",
+		document: `{"a": {"b": null}}`,
+		script:   "json.trail.a.b = 1",
+		expected: `{"a":{"b":1}}`,
+	},
+	{
+		name:     "get_values_nulls",
+		document: `{"a": [1, null]}`,
+		script:   "json.trail.b = json.jsonPathSelector(\"$.a[*]\"):getValues()",
+		expected: `{"a":[1,null],"b":[1,null]}`,
+	},
+}
+
+func TestLuaNulls(t *testing.T) {
+	for _, test := range luaNullTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(test.document)); err != nil {
+				tt.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			jsonMap.MustSet("$.script", "#//!lua\n" + test.script)
+			jsonMap.Run()
+
+			if out, err := jsonMap.Marshal(); err != nil {
+				tt.Errorf("Could not Marshal JsonMap: %v", err)
+			} else if string(out) != test.expected {
+				tt.Errorf("Expected %s but got: %s", test.expected, string(out))
+			}
+		})
+	}
+}
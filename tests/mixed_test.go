@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"context"
+	"github.com/andygello555/json-dom/code"
+	"github.com/andygello555/json-dom/jom"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"testing"
+)
+
+// The Go callbacks that are inserted into every document within mixedTable.
+var mixedCallbacks = map[string]interface{}{
+	// Run after the script on the same level, so it is hidden from the script
+	"$.z_hook": func(json json_map.JsonMapInt) {
+		json.MustSet("$.go", true)
+	},
+	"$.nested.hook": func(json json_map.JsonMapInt) {
+		json.MustSet("$.go", json.MustGet("$.x")[0])
+	},
+	"$.list[0].hook": func(json json_map.JsonMapInt) interface{} {
+		return "go"
+	},
+}
+
+var mixedTable = []struct{
+	name     string
+	script   string
+	expected string
+}{
+	{
+		name:     "js",
+		script:   "#//!js\njson.trail.lang = \"js\"; json.trail.list.push(2);",
+		expected: `{"go":true,"lang":"js","list":[{"hook":"go"},2],"nested":{"go":1,"x":1}}`,
+	},
+	{
+		name:     "js_delete",
+		script:   "#//!js\ndelete json.trail.nested;",
+		expected: `{"go":true,"list":[{"hook":"go"}]}`,
+	},
+	{
+		name:     "js_replace",
+		script:   "#//!js\njson.trail.nested.hook = \"js\";",
+		expected: `{"go":true,"list":[{"hook":"go"}],"nested":{"hook":"js","x":1}}`,
+	},
+	{
+		// Scripts can delete the keys of callbacks, which are null within their scope
+		name:     "js_delete_callback",
+		script:   "#//!js\ndelete json.trail.nested.hook; delete json.trail.list[0].hook;",
+		expected: `{"go":true,"list":[{}],"nested":{"x":1}}`,
+	},
+	{
+		name:     "js_expression",
+		script:   "#//!js=\nObject.keys(json.trail).sort().join(\",\") + \":\" + json.trail.z_hook",
+		expected: `{"go":true,"list":[{"hook":"go"}],"nested":{"go":1,"x":1},"script":"list,nested,script,z_hook:null"}`,
+	},
+	{
+		name:     "es",
+		script:   "#//!es\njson.trail = {...json.trail, lang: \"es\"};",
+		expected: `{"go":true,"lang":"es","list":[{"hook":"go"}],"nested":{"go":1,"x":1}}`,
+	},
+	{
+		name:     "lua",
+		script:   "#//!lua\njson.trail.lang = \"lua\"",
+		expected: `{"go":true,"lang":"lua","list":[{"hook":"go"}],"nested":{"go":1,"x":1}}`,
+	},
+	{
+		name:     "star",
+		script:   "#//!star\njson.trail[\"lang\"] = \"star\"",
+		expected: `{"go":true,"lang":"star","list":[{"hook":"go"}],"nested":{"go":1,"x":1}}`,
+	},
+	{
+		name:     "jq_delete_callback",
+		script:   "#//!jq\ndel(.nested.hook)",
+		expected: `{"go":true,"list":[{"hook":"go"}],"nested":{"x":1}}`,
+	},
+	{
+		name:     "jq",
+		script:   "#//!jq\n.lang = \"jq\"",
+		expected: `{"go":true,"lang":"jq","list":[{"hook":"go"}],"nested":{"go":1,"x":1}}`,
+	},
+	{
+		name:     "tmpl",
+		script:   "#//!tmpl\n{{.nested.x}}",
+		expected: `{"go":true,"list":[{"hook":"go"}],"nested":{"go":1,"x":1},"script":"1"}`,
+	},
+}
+
+func TestMixed(t *testing.T) {
+	for _, test := range mixedTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(`{"nested": {"x": 1}, "list": [{}]}`)); err != nil {
+				tt.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			for path, callback := range mixedCallbacks {
+				jsonMap.MustSet(path, callback)
+			}
+			jsonMap.MustSet("$.script", test.script)
+
+			defer func() {
+				if caught := recover(); caught != nil {
+					tt.Fatalf("Script panicked: %v", caught)
+				}
+			}()
+			jsonMap.Run()
+			if out, err := jsonMap.Marshal(); err != nil {
+				tt.Errorf("Could not Marshal JsonMap: %v", err)
+			} else if string(out) != test.expected {
+				tt.Errorf("Expected %s but got: %s", test.expected, string(out))
+			}
+		})
+	}
+}
+
+// Go callbacks are hidden from the root and parent of a scope, and are kept when a script writes to them. The root's
+// callback is run after the nested script, so that it is within the root when the script runs.
+func TestMixedOuterScopes(t *testing.T) {
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal([]byte(`{"nested": {}, "count": 0}`)); err != nil {
+		t.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	jsonMap.MustSet("$.z_hook", func(json json_map.JsonMapInt) {
+		json.MustSet("$.go", json.MustGet("$.count")[0])
+	})
+	jsonMap.MustSet("$.nested.script", "#//!js write=root\njson.root.count += 1; json.trail.keys = Object.keys(json.root).sort().join(\",\");")
+
+	defer func() {
+		if caught := recover(); caught != nil {
+			t.Fatalf("Script panicked: %v", caught)
+		}
+	}()
+	jsonMap.RunWithOptions(context.Background(), jom.RunOptions{Phase: code.Post})
+	expected := `{"count":1,"go":1,"nested":{"keys":"count,nested"}}`
+	if out, err := jsonMap.Marshal(); err != nil {
+		t.Errorf("Could not Marshal JsonMap: %v", err)
+	} else if string(out) != expected {
+		t.Errorf("Expected %s but got: %s", expected, string(out))
+	}
+}
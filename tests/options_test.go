@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"strings"
+	"testing"
+	"time"
+)
+
+var optionsTable = []struct{
+	name    string
+	script  string
+	options jom.RunOptions
+	// The longest the script should be able to run for
+	within  time.Duration
+	// The error that should be panicked
+	err     globals.RuntimeError
+}{
+	{
+		name:    "script_timeout",
+		script:  "#//!js\nwhile (true) {}",
+		options: jom.RunOptions{ScriptTimeout: 100 * time.Millisecond},
+		within:  500 * time.Millisecond,
+		err:     globals.HaltingProblem,
+	},
+	{
+		name:    "shebang_timeout",
+		script:  "#//!js timeout=100ms\nwhile (true) {}",
+		options: jom.RunOptions{},
+		within:  500 * time.Millisecond,
+		err:     globals.HaltingProblem,
+	},
+	{
+		name:    "shebang_timeout_expression",
+		script:  "#//!lua= timeout=100ms\n(function() while true do end end)()",
+		options: jom.RunOptions{},
+		within:  500 * time.Millisecond,
+		err:     globals.HaltingProblem,
+	},
+	{
+		name:    "shebang_timeout_ceiling",
+		script:  "#//!js timeout=1h\nwhile (true) {}",
+		options: jom.RunOptions{ScriptTimeout: 50 * time.Millisecond, MaxScriptTimeout: 100 * time.Millisecond},
+		within:  500 * time.Millisecond,
+		err:     globals.HaltingProblem,
+	},
+	{
+		name:    "shebang_timeout_default_ceiling",
+		script:  "#//!js timeout=1h\nwhile (true) {}",
+		options: jom.RunOptions{ScriptTimeout: 100 * time.Millisecond},
+		within:  500 * time.Millisecond,
+		err:     globals.HaltingProblem,
+	},
+	{
+		name:    "total_timeout",
+		script:  "#//!js\nwhile (true) {}",
+		options: jom.RunOptions{ScriptTimeout: time.Hour, TotalTimeout: 100 * time.Millisecond},
+		within:  500 * time.Millisecond,
+		err:     globals.Cancelled,
+	},
+	{
+		name:    "invalid_attribute",
+		script:  "#//!js timeout\nwhile (true) {}",
+		options: jom.RunOptions{},
+		within:  500 * time.Millisecond,
+		err:     globals.InvalidAttribute,
+	},
+	{
+		name:    "unknown_attribute",
+		script:  "#//!js foo=bar\nwhile (true) {}",
+		options: jom.RunOptions{},
+		within:  500 * time.Millisecond,
+		err:     globals.InvalidAttribute,
+	},
+}
+
+func TestRunWithOptions(t *testing.T) {
+	for _, test := range optionsTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(`{"hello": "world"}`)); err != nil {
+				tt.Errorf("Could not Unmarshal into JsonMap: %v", err)
+			}
+
+			start := time.Now()
+			defer func() {
+				if duration := time.Since(start); duration >= test.within {
+					tt.Errorf("Script was not stopped within %s, took: %s", test.within.String(), duration.String())
+				}
+				caught := recover()
+				err, ok := caught.(error)
+				if !ok {
+					tt.Fatalf("Expected an error to be panicked but got: %v", caught)
+				}
+				if !strings.HasPrefix(err.Error(), test.err.FillError().Error()) {
+					tt.Errorf("Expected \"%s\" but got: %v", test.err.FillError().Error(), err)
+				}
+				if test.err == globals.Cancelled && !errors.Is(err, context.DeadlineExceeded) {
+					tt.Errorf("Expected error to wrap \"%v\" but got: %v", context.DeadlineExceeded, err)
+				}
+			}()
+			// Attributes are parsed when the script is set
+			jsonMap.MustSet("$.script", test.script)
+			jsonMap.RunWithOptions(context.Background(), test.options)
+		})
+	}
+}
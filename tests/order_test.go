@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"strings"
+	"testing"
+)
+
+var orderTable = []struct{
+	name    string
+	// The script keys mapped to the attributes in their shebangs. Each script appends its key to $.nested.order
+	scripts map[string]string
+	// The order the scripts should be run in. Nil if an error should be panicked
+	order   []string
+	// The error that should be panicked
+	err     globals.RuntimeError
+	// A string that should be contained within the error
+	contains string
+}{
+	{
+		name:    "lexicographical",
+		scripts: map[string]string{"c": "", "a": "", "b": ""},
+		order:   []string{"a", "b", "c"},
+	},
+	{
+		name:    "after",
+		scripts: map[string]string{"a": "after=c", "b": "", "c": ""},
+		order:   []string{"b", "c", "a"},
+	},
+	{
+		name:    "after_chain",
+		scripts: map[string]string{"a": "after=b", "b": "after=c", "c": ""},
+		order:   []string{"c", "b", "a"},
+	},
+	{
+		name:    "after_list",
+		scripts: map[string]string{"validate": "after=normalize", "save": "after=normalize,validate", "normalize": "", "a": ""},
+		order:   []string{"a", "normalize", "validate", "save"},
+	},
+	{
+		name:    "priority",
+		scripts: map[string]string{"a": "", "b": "priority=10", "c": "priority=-1", "d": "priority=10"},
+		order:   []string{"b", "d", "a", "c"},
+	},
+	{
+		name:    "priority_after",
+		scripts: map[string]string{"a": "priority=10 after=c", "b": "priority=5", "c": ""},
+		order:   []string{"b", "c", "a"},
+	},
+	{
+		name:     "after_missing",
+		scripts:  map[string]string{"a": "after=z", "b": ""},
+		err:      globals.ScriptOrderError,
+		contains: "$.nested",
+	},
+	{
+		name:     "after_cycle",
+		scripts:  map[string]string{"a": "after=c", "b": "after=a", "c": "after=b", "d": ""},
+		err:      globals.ScriptOrderError,
+		contains: "\"a\", \"b\", \"c\"",
+	},
+	{
+		name:     "after_self",
+		scripts:  map[string]string{"a": "after=a"},
+		err:      globals.ScriptOrderError,
+		contains: "$.nested",
+	},
+	{
+		name:    "after_empty",
+		scripts: map[string]string{"a": "after=b,", "b": ""},
+		err:     globals.InvalidAttribute,
+	},
+	{
+		name:    "priority_invalid",
+		scripts: map[string]string{"a": "priority=high"},
+		err:     globals.InvalidAttribute,
+	},
+}
+
+func TestOrder(t *testing.T) {
+	for _, test := range orderTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(`{"nested": {"order": []}}`)); err != nil {
+				tt.Errorf("Could not Unmarshal into JsonMap: %v", err)
+			}
+
+			defer func() {
+				caught := recover()
+				if test.err == (globals.RuntimeError{}) {
+					if caught != nil {
+						tt.Fatalf("Script panicked: %v", caught)
+					}
+					order := jsonMap.MustGet("$.nested.order")
+					if fmt.Sprint(order) != fmt.Sprint(test.order) {
+						tt.Errorf("Expected scripts to run in order %v but got: %v", test.order, order)
+					}
+					return
+				}
+				err, ok := caught.(error)
+				if !ok || !strings.HasPrefix(err.Error(), test.err.FillError().Error()) {
+					tt.Fatalf("Expected \"%s\" but got: %v", test.err.FillError().Error(), caught)
+				}
+				if !strings.Contains(err.Error(), test.contains) {
+					tt.Errorf("Expected error to contain \"%s\" but got: %v", test.contains, err)
+				}
+			}()
+			// Attributes are parsed when the script is set
+			for key, attributes := range test.scripts {
+				jsonMap.MustSet(
+					"$.nested." + key,
+					fmt.Sprintf("#//!js %s\njson.trail.order.push(\"%s\");", attributes, key),
+				)
+			}
+			jsonMap.Run()
+		})
+	}
+}
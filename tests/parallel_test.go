@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"github.com/andygello555/gotils/maps"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"strings"
+	"testing"
+)
+
+// Creates a document with the given number of array elements, each of which contain a nested object. Every element and
+// nested object contain a script.
+func parallelDocument(elements int) []byte {
+	var b strings.Builder
+	b.WriteString(`{"counter": 1, "script": "#//!js\njson.trail.counter += 1;", "elements": [`)
+	for i := 0; i < elements; i++ {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		_, _ = fmt.Fprintf(&b, `{"i": %d, "a": "#//!js\njson.trail.i *= 2;", "b": "#//!lua\njson.trail.i = json.trail.i + 1", "nested": {"j": %d, "script": "#//!star\njson.trail[\"j\"] += 1"}}`, i, i)
+	}
+	b.WriteString("]}")
+	return []byte(b.String())
+}
+
+func TestParallel(t *testing.T) {
+	document := parallelDocument(50)
+
+	expected, err := jom.Eval(document, false)
+	if err != nil {
+		t.Fatalf("Could not evaluate document sequentially: %v", err)
+	}
+	for _, parallelism := range []int{2, 4, 16} {
+		t.Run(fmt.Sprintf("parallelism_%d", parallelism), func(tt *testing.T) {
+			out, err := jom.EvalWithOptions(context.Background(), document, false, jom.RunOptions{Parallelism: parallelism})
+			if err != nil {
+				tt.Fatalf("Could not evaluate document in parallel: %v", err)
+			}
+
+			sequential, parallel := jom.New(), jom.New()
+			if err = sequential.Unmarshal(expected); err != nil {
+				tt.Errorf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			if err = parallel.Unmarshal(out); err != nil {
+				tt.Errorf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			maps.JsonMapEqualTest(tt, *parallel.GetInsides(), *sequential.GetInsides(), "parallel")
+		})
+	}
+}
+
+func TestParallelError(t *testing.T) {
+	document := parallelDocument(50)
+	// The halting script is placed within one of the elements. All the other subtrees should be cancelled
+	document = []byte(strings.Replace(string(document), `{"i": 25,`, `{"halt": "#//!js\nwhile (true) {}", "i": 25,`, 1))
+
+	_, err := jom.EvalWithOptions(context.Background(), document, false, jom.RunOptions{Parallelism: 4})
+	if err == nil || !strings.Contains(err.Error(), globals.HaltingProblem.FillError().Error()) {
+		t.Errorf("Expected \"%s\" but got: %v", globals.HaltingProblem.FillError().Error(), err)
+	}
+}
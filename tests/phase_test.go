@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"context"
+	"github.com/andygello555/json-dom/code"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"strings"
+	"testing"
+)
+
+// A document where each line item computes its own total and the order sums the totals of its line items.
+const lineItemsDocument = `{
+	items: [
+		{
+			price: 2,
+			quantity: 3,
+			total: "#//!js=\njson.trail.price * json.trail.quantity"
+		},
+		{
+			price: 5,
+			quantity: 1,
+			total: "#//!js=\njson.trail.price * json.trail.quantity"
+		}
+	],
+	total: "#//!js= %s\njson.trail.items.reduce(function(sum, item) { return sum + item.total; }, 0)"
+}`
+
+var phaseTable = []struct{
+	name       string
+	// The attributes of the order's total script
+	attributes string
+	options    jom.RunOptions
+	// The expected output. Empty if an error should be panicked
+	expected   string
+	// The error that should be panicked
+	err        globals.RuntimeError
+}{
+	{
+		name:       "pre",
+		attributes: "",
+		options:    jom.RunOptions{},
+		// The line item totals are still scripts when the order's total is evaluated
+		expected:   `{"items":[{"price":2,"quantity":3,"total":6},{"price":5,"quantity":1,"total":5}],"total":"0#//!js=\njson.trail.price * json.trail.quantity#//!js=\njson.trail.price * json.trail.quantity"}`,
+	},
+	{
+		name:       "post_attribute",
+		attributes: "phase=post",
+		options:    jom.RunOptions{},
+		expected:   `{"items":[{"price":2,"quantity":3,"total":6},{"price":5,"quantity":1,"total":5}],"total":11}`,
+	},
+	{
+		name:       "post_option",
+		attributes: "",
+		options:    jom.RunOptions{Phase: code.Post},
+		expected:   `{"items":[{"price":2,"quantity":3,"total":6},{"price":5,"quantity":1,"total":5}],"total":11}`,
+	},
+	{
+		name:       "pre_attribute_overrides_option",
+		attributes: "phase=pre",
+		options:    jom.RunOptions{Phase: code.Post},
+		expected:   `{"items":[{"price":2,"quantity":3,"total":6},{"price":5,"quantity":1,"total":5}],"total":"0#//!js=\njson.trail.price * json.trail.quantity#//!js=\njson.trail.price * json.trail.quantity"}`,
+	},
+	{
+		name:       "post_parallel",
+		attributes: "phase=post",
+		options:    jom.RunOptions{Parallelism: 4},
+		expected:   `{"items":[{"price":2,"quantity":3,"total":6},{"price":5,"quantity":1,"total":5}],"total":11}`,
+	},
+	{
+		name:       "invalid_phase",
+		attributes: "phase=in",
+		options:    jom.RunOptions{},
+		err:        globals.InvalidAttribute,
+	},
+}
+
+func TestPhase(t *testing.T) {
+	for _, test := range phaseTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			defer func() {
+				caught := recover()
+				if test.err == (globals.RuntimeError{}) {
+					if caught != nil {
+						tt.Fatalf("Script panicked: %v", caught)
+					}
+					if out, err := jsonMap.Marshal(); err != nil {
+						tt.Errorf("Could not Marshal JsonMap: %v", err)
+					} else if string(out) != test.expected {
+						tt.Errorf("Expected %s but got: %s", test.expected, string(out))
+					}
+					return
+				}
+				if err, ok := caught.(error); !ok || !strings.HasPrefix(err.Error(), test.err.FillError().Error()) {
+					tt.Errorf("Expected \"%s\" but got: %v", test.err.FillError().Error(), caught)
+				}
+			}()
+			// Attributes are parsed when the scripts are found
+			if err := jsonMap.Unmarshal([]byte(strings.Replace(lineItemsDocument, "%s", test.attributes, 1))); err != nil {
+				tt.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			jsonMap.RunWithOptions(context.Background(), test.options)
+		})
+	}
+}
+
+// Scripts in the pre phase run before the subtrees of their scope are evaluated, so they cannot run after scripts in the
+// post phase.
+func TestPhaseOrder(t *testing.T) {
+	jsonMap := jom.New()
+	if err := jsonMap.Unmarshal([]byte(`{"counter": 0}`)); err != nil {
+		t.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+	}
+	jsonMap.MustSet("$.a", "#//!js phase=post\njson.trail.counter += 1;")
+	jsonMap.MustSet("$.b", "#//!js after=a\njson.trail.counter *= 2;")
+
+	defer func() {
+		err, ok := recover().(error)
+		if !ok || !strings.HasPrefix(err.Error(), globals.ScriptOrderError.FillError().Error()) {
+			t.Errorf("Expected \"%s\" but got: %v", globals.ScriptOrderError.FillError().Error(), err)
+		}
+	}()
+	jsonMap.Run()
+}
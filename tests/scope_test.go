@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"context"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"strings"
+	"testing"
+)
+
+var scopeTable = []struct{
+	name     string
+	document string
+	// Scripts set at the given paths once the document has been unmarshalled
+	scripts  map[string]interface{}
+	options  jom.RunOptions
+	// The expected output. Empty if an error should be panicked
+	expected string
+	// The error that should be panicked
+	err      globals.RuntimeError
+}{
+	{
+		name:     "js_root",
+		document: `{"config": {"currency": "GBP"}, "people": [{"name": "Alice"}]}`,
+		scripts:  map[string]interface{}{
+			"$.people[0].script": "#//!js\njson.trail.currency = json.root.config.currency;",
+		},
+		expected: `{"config":{"currency":"GBP"},"people":[{"currency":"GBP","name":"Alice"}]}`,
+	},
+	{
+		name:     "js_parent",
+		document: `{"a": {"x": 1, "b": {}}}`,
+		scripts:  map[string]interface{}{
+			"$.a.b.script": "#//!js\njson.trail.y = json.parent.x + 1;",
+		},
+		expected: `{"a":{"b":{"y":2},"x":1}}`,
+	},
+	{
+		name:     "js_parent_array",
+		document: `{"x": 1, "list": [{}]}`,
+		scripts:  map[string]interface{}{
+			"$.list[0].script": "#//!js\njson.trail.y = json.parent.x;",
+		},
+		expected: `{"list":[{"y":1}],"x":1}`,
+	},
+	{
+		name:     "js_root_is_scope",
+		document: `{"x": 1}`,
+		scripts:  map[string]interface{}{
+			"$.script": "#//!js\njson.trail.root = json.root.x; json.trail.parent = json.parent;",
+		},
+		expected: `{"parent":null,"root":1,"x":1}`,
+	},
+	{
+		name:     "js_root_parallel",
+		document: `{"config": {"currency": "GBP"}, "people": [{"name": "Alice"}, {"name": "Bob"}]}`,
+		scripts:  map[string]interface{}{
+			"$.people[0].script": "#//!js\njson.trail.currency = json.root.config.currency;",
+			"$.people[1].script": "#//!js\njson.trail.currency = json.root.config.currency;",
+		},
+		options:  jom.RunOptions{Parallelism: 4},
+		expected: `{"config":{"currency":"GBP"},"people":[{"currency":"GBP","name":"Alice"},{"currency":"GBP","name":"Bob"}]}`,
+	},
+	{
+		name:     "js_root_read_only",
+		document: `{"config": {"count": 0}, "a": {}}`,
+		scripts:  map[string]interface{}{
+			"$.a.script": "#//!js\njson.root.config.count += 1;",
+		},
+		expected: `{"a":{},"config":{"count":0}}`,
+	},
+	{
+		name:     "js_write_root",
+		document: `{"config": {"count": 0}, "a": {}}`,
+		scripts:  map[string]interface{}{
+			"$.a.script": "#//!js write=root\njson.root.config.count += 1;",
+		},
+		expected: `{"a":{},"config":{"count":1}}`,
+	},
+	{
+		name:     "js_write_parent",
+		document: `{"a": {"count": 0, "b": {}}}`,
+		scripts:  map[string]interface{}{
+			"$.a.b.script": "#//!js write=parent\njson.parent.count += 1; json.parent.b.ignored = true; json.trail.done = true;",
+		},
+		// The scope returned by the script takes precedence over the changes made to it through the parent
+		expected: `{"a":{"b":{"done":true},"count":1}}`,
+	},
+	{
+		// Sibling scopes within an array see the changes made to them through the parent, as the array is updated in place
+		name:     "js_write_parent_array_siblings",
+		document: `{"list": [{}, {}], "n": [1]}`,
+		scripts:  map[string]interface{}{
+			"$.list[0].script": "#//!js write=parent\njson.parent.list[1].c = 3; json.parent.n.push(2); json.trail.a = 1;",
+			"$.list[1].script": "#//!js\njson.trail.b = json.trail.c - 1;",
+		},
+		expected: `{"list":[{"a":1},{"b":2,"c":3}],"n":[1,2]}`,
+	},
+	{
+		// The sibling scopes would otherwise be joined back into the replaced array
+		name:     "js_write_parent_array_grow",
+		document: `{"list": [{}, {}]}`,
+		scripts:  map[string]interface{}{
+			"$.list[0].script": "#//!js write=parent\njson.parent.list.push({c: 3}); json.trail.a = 1;",
+			"$.list[1].script": "#//!js\njson.trail.b = 2;",
+		},
+		err:      globals.ScriptError,
+	},
+	{
+		name:     "js_write_root_array_remove",
+		document: `{"list": [{}, {}], "a": {}}`,
+		scripts:  map[string]interface{}{
+			"$.a.script": "#//!js write=root\ndelete json.root.list;",
+		},
+		err:      globals.ScriptError,
+	},
+	{
+		name:     "js_write_parallel",
+		document: `{"a": {}}`,
+		scripts:  map[string]interface{}{
+			"$.a.script": "#//!js write=root\njson.root.b = 1;",
+		},
+		options:  jom.RunOptions{Parallelism: 4},
+		err:      globals.InvalidAttribute,
+	},
+	{
+		name:     "js_write_invalid",
+		document: `{"a": {}}`,
+		scripts:  map[string]interface{}{
+			"$.a.script": "#//!js write=sibling\njson.root.b = 1;",
+		},
+		err:      globals.InvalidAttribute,
+	},
+	{
+		name:     "lua_write_unsupported",
+		document: `{"a": {}}`,
+		scripts:  map[string]interface{}{
+			"$.a.script": "#//!lua write=root\njson.trail.b = 1",
+		},
+		err:      globals.InvalidAttribute,
+	},
+	{
+		name:     "es_write_unsupported",
+		document: `{"a": {}}`,
+		scripts:  map[string]interface{}{
+			"$.a.script": "#//!es write=parent\njson.trail.b = 1;",
+		},
+		err:      globals.InvalidAttribute,
+	},
+	{
+		name:     "jq_write_unsupported",
+		document: `{"a": {}}`,
+		scripts:  map[string]interface{}{
+			"$.a.script": "#//!jq write=root\n.b = 1",
+		},
+		err:      globals.InvalidAttribute,
+	},
+	{
+		name:     "go_root_parent",
+		document: `{"config": {"currency": "GBP"}, "a": {"x": 1, "b": {}}}`,
+		scripts:  map[string]interface{}{
+			"$.a.b.script": func(json json_map.JsonMapInt) {
+				json.MustSet("$.currency", json.Root().MustGet("$.config.currency")[0])
+				json.MustSet("$.y", json.Parent().MustGet("$.x")[0])
+			},
+		},
+		expected: `{"a":{"b":{"currency":"GBP","y":1},"x":1},"config":{"currency":"GBP"}}`,
+	},
+	{
+		name:     "go_root_is_scope",
+		document: `{"x": 1}`,
+		scripts:  map[string]interface{}{
+			"$.script": func(json json_map.JsonMapInt) {
+				json.MustSet("$.root", json.Root().MustGet("$.x")[0])
+				json.MustSet("$.parent", json.Parent() == nil)
+			},
+		},
+		expected: `{"parent":true,"root":1,"x":1}`,
+	},
+	{
+		// Go source scripts are given a copy of their scope which is detached from the document
+		name:     "gosrc_root_parent_detached",
+		document: `{"x": 1, "a": {"y": 2}}`,
+		scripts:  map[string]interface{}{
+			"$.a.script": `#//!gosrc
+import "github.com/andygello555/json-dom/jom/json_map"
+
+func Run(json json_map.JsonMapInt) {
+	json.Root().MustSet("$.z", 3)
+	json.Clone(false).Root().MustSet("$.w", 4)
+	json.MustSet("$.parent", json.Parent() == nil)
+}`,
+		},
+		expected: `{"a":{"parent":true,"w":4,"y":2,"z":3},"x":1}`,
+	},
+}
+
+func TestScope(t *testing.T) {
+	for _, test := range scopeTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(test.document)); err != nil {
+				tt.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+			}
+
+			defer func() {
+				caught := recover()
+				if test.err == (globals.RuntimeError{}) {
+					if caught != nil {
+						tt.Fatalf("Script panicked: %v", caught)
+					}
+					if out, err := jsonMap.Marshal(); err != nil {
+						tt.Errorf("Could not Marshal JsonMap: %v", err)
+					} else if string(out) != test.expected {
+						tt.Errorf("Expected %s but got: %s", test.expected, string(out))
+					}
+					return
+				}
+				if err, ok := caught.(error); !ok || !strings.HasPrefix(err.Error(), test.err.FillError().Error()) {
+					tt.Errorf("Expected \"%s\" but got: %v", test.err.FillError().Error(), caught)
+				}
+			}()
+			for path, script := range test.scripts {
+				jsonMap.MustSet(path, script)
+			}
+			jsonMap.RunWithOptions(context.Background(), test.options)
+		})
+	}
+}
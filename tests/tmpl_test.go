@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"context"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"strings"
+	"testing"
+	"time"
+)
+
+var tmplTable = []struct{
+	name     string
+	// The template that is set at $.out within the document
+	script   string
+	options  jom.RunOptions
+	// The expected value of $.out once rendered. Ignored if an error should be panicked
+	expected string
+	// The error that should be panicked
+	err      globals.RuntimeError
+}{
+	{
+		name:     "render",
+		script:   "{{upper .name}}: {{len .list}}",
+		expected: "API: 3",
+	},
+	{
+		name:   "parse_error",
+		script: "{{.name",
+		err:    globals.ScriptError,
+	},
+	{
+		name:   "parse_error_function",
+		script: "{{missing .name}}",
+		err:    globals.ScriptError,
+	},
+	{
+		name:   "execute_error",
+		script: "{{index .list 5}}",
+		err:    globals.ScriptError,
+	},
+	{
+		name:   "execute_error_function",
+		script: "{{upper .list}}",
+		err:    globals.ScriptError,
+	},
+	{
+		name:     "missing_key",
+		script:   "{{.nickname}}",
+		expected: "<no value>",
+	},
+	{
+		name:     "missing_key_default",
+		script:   "{{default \"none\" .nickname}}",
+		expected: "none",
+	},
+	{
+		name:     "present_key_default",
+		script:   "{{default \"none\" .name}}",
+		expected: "api",
+	},
+	{
+		name:     "json_path",
+		script:   "{{join \",\" (jsonPath \"$.list[*]\")}}",
+		expected: "1,2,3",
+	},
+	{
+		name:   "json_path_missing",
+		script: "{{toJson (jsonPath \"$.missing\")}}",
+		err:    globals.ScriptError,
+	},
+	{
+		name:   "json_path_error",
+		script: "{{jsonPath \"$.list[\"}}",
+		err:    globals.ScriptError,
+	},
+	{
+		name:     "vars",
+		script:   "{{.name}}.{{(vars).region}}.example.com",
+		options:  jom.RunOptions{Vars: map[string]interface{}{"region": "eu"}},
+		expected: "api.eu.example.com",
+	},
+	{
+		name:     "vars_default",
+		script:   "{{default \"dev\" (vars).env}}",
+		expected: "dev",
+	},
+	{
+		name:    "timeout",
+		script:  "{{range 1000000000}}.{{end}}",
+		options: jom.RunOptions{ScriptTimeout: 100 * time.Millisecond},
+		err:     globals.HaltingProblem,
+	},
+}
+
+func TestTmpl(t *testing.T) {
+	for _, test := range tmplTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(`{"name": "api", "list": [1, 2, 3]}`)); err != nil {
+				tt.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			jsonMap.MustSet("$.out", "#//!tmpl\n" + test.script)
+
+			defer func() {
+				caught := recover()
+				if test.err == (globals.RuntimeError{}) {
+					if caught != nil {
+						tt.Fatalf("Script panicked: %v", caught)
+					}
+					if out := jsonMap.MustGet("$.out")[0]; out != test.expected {
+						tt.Errorf("Expected %q but got: %v", test.expected, out)
+					}
+					return
+				}
+				if err, ok := caught.(error); !ok || !strings.HasPrefix(err.Error(), test.err.FillError().Error()) {
+					tt.Errorf("Expected \"%s\" but got: %v", test.err.FillError().Error(), caught)
+				}
+			}()
+			jsonMap.RunWithOptions(context.Background(), test.options)
+		})
+	}
+}
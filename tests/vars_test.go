@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"context"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"github.com/andygello555/json-dom/jom/json_map"
+	"strings"
+	"testing"
+)
+
+var varsTable = []struct{
+	name     string
+	document string
+	// Scripts set at the given paths once the document has been unmarshalled
+	scripts  map[string]interface{}
+	options  jom.RunOptions
+	// The expected output. Empty if an error should be panicked
+	expected string
+	// The error that should be panicked
+	err      globals.RuntimeError
+}{
+	{
+		name:     "js",
+		document: `{"a": {}}`,
+		scripts:  map[string]interface{}{
+			"$.a.script": "#//!js\njson.trail.env = json.vars.env; json.trail.replicas = json.vars.replicas;",
+		},
+		options:  jom.RunOptions{Vars: map[string]interface{}{"env": "prod", "replicas": 3}},
+		expected: `{"a":{"env":"prod","replicas":3}}`,
+	},
+	{
+		name:     "js_empty",
+		document: `{}`,
+		scripts:  map[string]interface{}{
+			"$.script": "#//!js\njson.trail.env = json.vars.env || \"dev\";",
+		},
+		expected: `{"env":"dev"}`,
+	},
+	{
+		name:     "js_modified",
+		document: `{"a": {}, "b": {}}`,
+		scripts:  map[string]interface{}{
+			// Changes made to the vars by one script are not seen by another
+			"$.a.script": "#//!js\njson.vars.env = \"dev\"; json.trail.env = json.vars.env;",
+			"$.b.script": "#//!js\njson.trail.env = json.vars.env;",
+		},
+		options:  jom.RunOptions{Vars: map[string]interface{}{"env": "prod"}},
+		expected: `{"a":{"env":"dev"},"b":{"env":"prod"}}`,
+	},
+	{
+		name:     "es",
+		document: `{}`,
+		scripts:  map[string]interface{}{
+			"$.script": "#//!es\nconst {env, region} = json.vars; json.trail.where = `${env}-${region}`;",
+		},
+		options:  jom.RunOptions{Vars: map[string]interface{}{"env": "prod", "region": "eu"}},
+		expected: `{"where":"prod-eu"}`,
+	},
+	{
+		name:     "lua",
+		document: `{}`,
+		scripts:  map[string]interface{}{
+			"$.script": "#//!lua\njson.trail.env = json.vars.env .. \"-\" .. json.vars.region",
+		},
+		options:  jom.RunOptions{Vars: map[string]interface{}{"env": "prod", "region": "eu"}},
+		expected: `{"env":"prod-eu"}`,
+	},
+	{
+		name:     "star",
+		document: `{}`,
+		scripts:  map[string]interface{}{
+			"$.script": "#//!star\njson.trail[\"env\"] = json.vars[\"env\"] + \"-\" + json.vars[\"region\"]",
+		},
+		options:  jom.RunOptions{Vars: map[string]interface{}{"env": "prod", "region": "eu"}},
+		expected: `{"env":"prod-eu"}`,
+	},
+	{
+		name:     "jq",
+		document: `{}`,
+		scripts:  map[string]interface{}{
+			"$.script": "#//!jq\n.env = $vars.env",
+		},
+		options:  jom.RunOptions{Vars: map[string]interface{}{"env": "prod"}},
+		expected: `{"env":"prod"}`,
+	},
+	{
+		name:     "tmpl",
+		document: `{"name": "api"}`,
+		scripts:  map[string]interface{}{
+			"$.script": "#//!tmpl\n{{.name}}.{{(vars).region}}.example.com",
+		},
+		options:  jom.RunOptions{Vars: map[string]interface{}{"region": "eu"}},
+		expected: `{"name":"api","script":"api.eu.example.com"}`,
+	},
+	{
+		name:     "go",
+		document: `{"a": {"b": {}}}`,
+		scripts:  map[string]interface{}{
+			"$.a.b.script": func(json json_map.JsonMapInt) {
+				json.MustSet("$.env", json.Vars()["env"])
+			},
+		},
+		options:  jom.RunOptions{Vars: map[string]interface{}{"env": "prod"}},
+		expected: `{"a":{"b":{"env":"prod"}}}`,
+	},
+	{
+		name:     "gosrc",
+		document: `{}`,
+		scripts:  map[string]interface{}{
+			"$.script": "#//!gosrc\nimport \"github.com/andygello555/json-dom/jom/json_map\"\nfunc Run(json json_map.JsonMapInt) { json.MustSet(\"$.env\", json.Vars()[\"env\"]) }",
+		},
+		options:  jom.RunOptions{Vars: map[string]interface{}{"env": "prod"}},
+		expected: `{"env":"prod"}`,
+	},
+	{
+		name:     "go_empty",
+		document: `{}`,
+		scripts:  map[string]interface{}{
+			"$.script": func(json json_map.JsonMapInt) {
+				json.MustSet("$.count", float64(len(json.Vars())))
+			},
+		},
+		expected: `{"count":0}`,
+	},
+	{
+		name:     "normalised",
+		document: `{}`,
+		scripts:  map[string]interface{}{
+			"$.script": func(json json_map.JsonMapInt) {
+				json.MustSet("$.region", json.Vars()["config"].(map[string]interface{})["region"])
+			},
+		},
+		options:  jom.RunOptions{Vars: map[string]interface{}{"config": struct{
+			Region string `json:"region"`
+		}{"eu"}}},
+		expected: `{"region":"eu"}`,
+	},
+	{
+		name:     "parallel",
+		document: `{"list": [{}, {}, {}]}`,
+		scripts:  map[string]interface{}{
+			"$.list[0].script": "#//!js\njson.trail.env = json.vars.env;",
+			"$.list[1].script": "#//!lua\njson.trail.env = json.vars.env",
+			"$.list[2].script": "#//!jq\n.env = $vars.env",
+		},
+		options:  jom.RunOptions{Parallelism: 4, Vars: map[string]interface{}{"env": "prod"}},
+		expected: `{"list":[{"env":"prod"},{"env":"prod"},{"env":"prod"}]}`,
+	},
+	{
+		name:     "invalid",
+		document: `{}`,
+		scripts:  map[string]interface{}{
+			"$.script": "#//!js\njson.trail.env = json.vars.env;",
+		},
+		options:  jom.RunOptions{Vars: map[string]interface{}{"callback": func() {}}},
+		err:      globals.InvalidVars,
+	},
+}
+
+func TestVars(t *testing.T) {
+	for _, test := range varsTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(test.document)); err != nil {
+				tt.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+			}
+
+			defer func() {
+				caught := recover()
+				if test.err == (globals.RuntimeError{}) {
+					if caught != nil {
+						tt.Fatalf("Script panicked: %v", caught)
+					}
+					if out, err := jsonMap.Marshal(); err != nil {
+						tt.Errorf("Could not Marshal JsonMap: %v", err)
+					} else if string(out) != test.expected {
+						tt.Errorf("Expected %s but got: %s", test.expected, string(out))
+					}
+					return
+				}
+				if err, ok := caught.(error); !ok || !strings.HasPrefix(err.Error(), test.err.FillError().Error()) {
+					tt.Errorf("Expected \"%s\" but got: %v", test.err.FillError().Error(), caught)
+				}
+			}()
+			for path, script := range test.scripts {
+				jsonMap.MustSet(path, script)
+			}
+			jsonMap.RunWithOptions(context.Background(), test.options)
+		})
+	}
+}
+
+// The same document can be evaluated with different vars.
+func TestVarsEval(t *testing.T) {
+	document := []byte(`{"host": "#//!js=\n\"api.\" + json.vars.region + \".example.com\""}`)
+	for _, region := range []string{"eu", "us"} {
+		out, err := jom.EvalWithOptions(context.Background(), document, false, jom.RunOptions{
+			Vars: map[string]interface{}{"region": region},
+		})
+		expected := `{"host":"api.` + region + `.example.com"}`
+		if err != nil {
+			t.Errorf("%s: Could not evaluate document: %v", region, err)
+		} else if string(out) != expected {
+			t.Errorf("%s: Expected %s but got: %s", region, expected, string(out))
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"github.com/andygello555/gotils/maps"
+	"github.com/andygello555/json-dom/code"
+	"github.com/andygello555/json-dom/globals"
+	"github.com/andygello555/json-dom/jom"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var wasmModuleTable = []struct{
+	name    string
+	script  string
+	options jom.RunOptions
+	// The error that should be panicked. Empty if no error should be panicked
+	err     globals.RuntimeError
+}{
+	{
+		name:   "base64",
+		script: "#//!wasm\n" + exampleWasmModule("first_last.wasm"),
+	},
+	{
+		name:    "base64_paths",
+		script:  "#//!wasm\n" + exampleWasmModule("first_last.wasm"),
+		options: jom.RunOptions{WasmModulePaths: true},
+	},
+	{
+		name:    "path",
+		script:  "#//!wasm\n" + filepath.Join(exampleWasmLocation, "first_last.wasm"),
+		options: jom.RunOptions{WasmModulePaths: true},
+	},
+	{
+		// Paths are not read unless WasmModulePaths is set
+		name:   "path_disallowed",
+		script: "#//!wasm\n" + filepath.Join(exampleWasmLocation, "first_last.wasm"),
+		err:    globals.ScriptError,
+	},
+	{
+		name:   "path_disallowed_not_module",
+		script: "#//!wasm\n/etc/passwd",
+		err:    globals.ScriptError,
+	},
+	{
+		name:    "path_not_module",
+		script:  "#//!wasm\n" + filepath.Join(exampleWasmLocation, "first_last.wat"),
+		options: jom.RunOptions{WasmModulePaths: true},
+		err:     globals.ScriptError,
+	},
+}
+
+func TestWasmModules(t *testing.T) {
+	for _, test := range wasmModuleTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(`{"name": "John Smith"}`)); err != nil {
+				tt.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			jsonMap.MustSet("$.script", test.script)
+
+			defer func() {
+				caught := recover()
+				if test.err == (globals.RuntimeError{}) {
+					if caught != nil {
+						tt.Fatalf("Script panicked: %v", caught)
+					}
+					maps.JsonMapEqualTest(tt, *jsonMap.GetInsides(), map[string]interface{}{
+						"first_name": "John",
+						"last_name":  "Smith",
+					}, fmt.Sprintf("\"%s\"", test.name))
+					return
+				}
+				if err, ok := caught.(error); !ok || !strings.HasPrefix(err.Error(), test.err.FillError().Error()) {
+					tt.Errorf("Expected \"%s\" but got: %v", test.err.FillError().Error(), caught)
+				}
+			}()
+			jsonMap.RunWithOptions(context.Background(), test.options)
+		})
+	}
+}
+
+var wasmArrayScopeTable = []struct{
+	name     string
+	document string
+	module   string
+	// The expected scope once the module has run. Ignored if an error should be returned
+	expected string
+	// The error that should be returned. Empty if no error should be returned
+	err      globals.RuntimeError
+}{
+	{
+		name:     "array_root",
+		document: `[1, 2]`,
+		module:   "prepend_zero.wasm",
+		expected: `[0,1,2]`,
+	},
+	{
+		name:     "array_root_nested",
+		document: `[{"a": [1]}, "b"]`,
+		module:   "prepend_zero.wasm",
+		expected: `[0,{"a":[1]},"b"]`,
+	},
+	{
+		// Array roots are not read or written as the object that wraps them
+		name:     "array_root_object",
+		document: `["John Smith"]`,
+		module:   "first_last.wasm",
+		err:      globals.ScriptError,
+	},
+	{
+		name:     "object_array",
+		document: `{"name": "John Smith"}`,
+		module:   "prepend_zero.wasm",
+		err:      globals.ScriptError,
+	},
+}
+
+func TestWasmArrayScope(t *testing.T) {
+	for _, test := range wasmArrayScopeTable {
+		t.Run(test.name, func(tt *testing.T) {
+			jsonMap := jom.New()
+			if err := jsonMap.Unmarshal([]byte(test.document)); err != nil {
+				tt.Fatalf("Could not Unmarshal into JsonMap: %v", err)
+			}
+			script, _ := code.NewFrom("#//!wasm\n" + exampleWasmModule(test.module))
+
+			data, err := code.Run(script, jsonMap)
+			if test.err != (globals.RuntimeError{}) {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err.FillError().Error()) {
+					tt.Errorf("Expected \"%s\" but got: %v", test.err.FillError().Error(), err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("Module returned an error: %v", err)
+			}
+			if out, err := data.Marshal(); err != nil {
+				tt.Errorf("Could not Marshal JsonMap: %v", err)
+			} else if string(out) != test.expected {
+				tt.Errorf("Expected %s but got: %s", test.expected, string(out))
+			}
+		})
+	}
+}